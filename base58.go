@@ -23,7 +23,8 @@ func Base58Encode(input []byte) []byte {
 	}
 
 	// https://en.bitcoin.it/wiki/Base58Check_encoding#Version_bytes
-	if input[0] == 0x00 {
+	// every leading zero byte is encoded as a leading '1'
+	for i := 0; i < len(input) && input[i] == 0x00; i++ {
 		result = append(result, b58Alphabet[0])
 	}
 
@@ -44,9 +45,22 @@ func Base58Decode(input []byte) []byte {
 
 	decoded := result.Bytes()
 
-	if input[0] == b58Alphabet[0] {
+	for i := 0; i < len(input) && input[i] == b58Alphabet[0]; i++ {
 		decoded = append([]byte{0x00}, decoded...)
 	}
 
 	return decoded
 }
+
+func isBase58(input string) bool {
+	if len(input) == 0 {
+		return false
+	}
+	for i := 0; i < len(input); i++ {
+		if bytes.IndexByte(b58Alphabet, input[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
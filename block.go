@@ -3,8 +3,10 @@ package crickchain
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"log"
 	"fmt"
+	"io"
 	"strconv"
 	"time"
 	"math/big"
@@ -24,23 +26,31 @@ type Block struct {
 	SolutionHash []byte
 	Solution	  []int
 	ProblemGraphHash []byte
+	// Problem is set when the problem graph is generated from the seed of
+	// the parent block, see GenerateProblemGraph
+	Problem       *ProblemParams
 }
 
 // NewBlock creates and returns Block
 func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int, target *big.Int, solHash []byte, solution []int, pgHash []byte) *Block {
-	block := &Block{time.Now().UnixNano(), transactions, prevBlockHash, []byte{}, 0, height, target, solHash, solution, pgHash}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	block := &Block{time.Now().UnixNano(), transactions, prevBlockHash, []byte{}, 0, height, target, solHash, solution, pgHash, nil}
+	block.mine()
 
 	return block
 }
 
-// NewGenesisBlock creates and returns genesis Block
-func NewGenesisBlock(coinbase *Transaction) *Block {
-	target := targetFromTargetBits(initialTargetBits)
+// mine runs the proof-of-work of the block and sets its nonce and hash
+func (b *Block) mine() {
+	pow := NewProofOfWork(b)
+	nonce, hash := pow.Run()
+
+	b.Hash = hash[:]
+	b.Nonce = nonce
+}
+
+// NewGenesisBlock creates and returns the genesis Block of a network
+func NewGenesisBlock(coinbase *Transaction, params NetworkParams) *Block {
+	target := targetFromTargetBits(params.InitialTargetBits)
 	
 	return NewBlock([]*Transaction{coinbase}, []byte{}, 0, target, []byte{}, []int{}, []byte{})
 }
@@ -59,24 +69,39 @@ func (b *Block) HashTransactions() []byte {
 }
 
 func (b *Block) HasValidSolution(bc *Blockchain) bool {
+	return b.solvedProblem(bc, nil) != nil
+}
+
+// solvedProblem returns the problem graph the block validly solves, nil if it
+// doesn't. The graph is looked up in fetched, see Blockchain.problemGraph.
+func (b *Block) solvedProblem(bc *Blockchain, fetched map[string]*ProblemGraph) *ProblemGraph {
 	if len(b.SolutionHash) == 0 {
-		return false
+		return nil
 	}
 	//check that is not the initial solution posted with the problem
 	if Equal(b.ProblemGraphHash, b.SolutionHash) {
-		return false
+		return nil
 	}
-	pg, err := bc.GetProblemGraphFromHash(b.SolutionHash)
+	pg, err := bc.problemGraph(b.SolutionHash, fetched)
 	if err != nil {
-		return false
+		return nil
 	}
-	bestSolution := bc.GetBestSolution(&pg, b.Height - 1)
-	if len(b.Solution) <= len(bestSolution) {
-		return false
+	//check that an ancestor of the block introduced the graph, stored graphs
+	//no block introduced don't lower the target
+	if !bc.problemIntroducedBefore(canonicalProblemHash(bc.problemAliases(), b.SolutionHash), b.PrevBlockHash) {
+		return nil
+	}
+	bestSolution, err := bc.GetBestSolution(&pg, b.Height - 1)
+	if err != nil || len(b.Solution) <= len(bestSolution) {
+		return nil
 	}
 
 	//verify that solution is valid
-	return pg.ValidateClique(b.Solution)
+	if !pg.ValidateClique(b.Solution) {
+		return nil
+	}
+
+	return &pg
 }
 
 // Serialize serializes the block
@@ -92,80 +117,136 @@ func (b *Block) Serialize() []byte {
 	return result.Bytes()
 }
 
+// Validate tells if the block is valid, see Check
 func (b *Block) Validate(bc *Blockchain) bool {
-	var chainTarget *big.Int
-	if b.HasValidSolution(bc) {
-		chainTarget = bc.CalculateTarget(b.Height, true)
-	} else {
-		chainTarget = bc.CalculateTarget(b.Height, false)
+	return b.Check(bc) == nil
+}
+
+// Check validates the block against the chain and returns why it is not
+// valid: its proof-of-work, its target, the problem graph it introduces and
+// the locks and signatures of its transactions
+func (b *Block) Check(bc *Blockchain) error {
+	_, err := b.check(bc, nil)
+
+	return err
+}
+
+// check checks the block like Check, with the problem graphs fetched for it,
+// and returns the problem graphs it introduces or solves
+func (b *Block) check(bc *Blockchain, fetched map[string]*ProblemGraph) ([]*ProblemGraph, error) {
+	//check the proof-of-work first, it is cheap and covers everything else
+	pow := NewProofOfWork(b)
+	if !pow.Validate() {
+		return nil, errors.New("proof-of-work is not valid")
+	}
+
+	solved := b.solvedProblem(bc, fetched)
+	chainTarget, err := bc.CalculateTarget(b.Height, solved != nil)
+	if err != nil {
+		return nil, err
 	}
 	
 	//check that the targetBits is correct
 	if b.Target.Cmp(chainTarget) != 0 {
-		return false
+		return nil, fmt.Errorf("target %064x is not the target %064x of the chain", b.Target, chainTarget)
 	}
-	pow := NewProofOfWork(b)
-	return pow.Validate()
+
+	//check that a new problem graph is admitted
+	var graphs []*ProblemGraph
+	if len(b.ProblemGraphHash) > 0 {
+		pg, err := bc.checkNewProblem(b, fetched)
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, pg)
+	}
+	if solved != nil {
+		graphs = append(graphs, solved)
+	}
+
+	//check that transactions are unlocked at this height and correctly signed
+	locks := bc.newLockContext(b.PrevBlockHash, b.Height, b.Transactions)
+	for _, tx := range b.Transactions {
+		if err := locks.check(tx); err != nil {
+			return nil, err
+		}
+	}
+	for i, valid := range bc.VerifyTransactions(b.Transactions) {
+		if !valid {
+			return nil, fmt.Errorf("transaction %x is not correctly signed", b.Transactions[i].ID)
+		}
+	}
+
+	return graphs, nil
 }
 
 //NicePrint print nicely the block properties
-func (b *Block) NicePrint(bc *Blockchain) {
-	fmt.Printf("\n")
-	printGreen(fmt.Sprintf("============ Block %d ============\n", b.Height))
-	printBlue(fmt.Sprintf("Hash:   %064x\n", b.Hash))
-	fmt.Printf("Prev:   %064x\n", b.PrevBlockHash)
-	fmt.Printf("Target: %064x\n", b.Target)
-	fmt.Printf("Difficulty: %d\n", targetToDifficulty(b.Target))
+func (b *Block) NicePrint(w io.Writer, bc *Blockchain) {
+	fmt.Fprintf(w, "\n")
+	printGreen(w, fmt.Sprintf("============ Block %d ============\n", b.Height))
+	printBlue(w, fmt.Sprintf("Hash:   %064x\n", b.Hash))
+	fmt.Fprintf(w, "Prev:   %064x\n", b.PrevBlockHash)
+	fmt.Fprintf(w, "Target: %064x\n", b.Target)
+	fmt.Fprintf(w, "Difficulty: %d\n", targetToDifficulty(b.Target))
 	prevBlock, _ := bc.GetBlockFromHash(b.PrevBlockHash)
 	time := (b.Timestamp - prevBlock.Timestamp) / 1e9
-	fmt.Printf("Time: %d seconds\n", time)
+	fmt.Fprintf(w, "Time: %d seconds\n", time)
 	validBlock := b.Validate(bc)
 	if validBlock {
-		printGreen(fmt.Sprintf("PoW: %s\n", strconv.FormatBool(validBlock)))
+		printGreen(w, fmt.Sprintf("PoW: %s\n", strconv.FormatBool(validBlock)))
 	} else {
-		printRed(fmt.Sprintf("PoW: %s\n", strconv.FormatBool(validBlock)))
+		printRed(w, fmt.Sprintf("PoW: %s\n", strconv.FormatBool(validBlock)))
 	}
 
 	if len(b.SolutionHash) > 0 {
-		printGreen(fmt.Sprintf("Solution to %x: ", b.SolutionHash))
-		fmt.Println(b.Solution)
+		printGreen(w, fmt.Sprintf("Solution to %x: ", b.SolutionHash))
+		fmt.Fprintln(w, b.Solution)
 		validSol := b.HasValidSolution(bc)
 		if validSol {
-			printGreen("Valid Solution\n")
+			printGreen(w, "Valid Solution\n")
 		} else {
-			printRed("Not Valid\n")
+			printRed(w, "Not Valid\n")
 		}
 	} else {
-		printRed("No solution\n")
+		printRed(w, "No solution\n")
 	}
 
 	if len(b.ProblemGraphHash) > 0 {
-		printGreen(fmt.Sprintf("New Problem %x \n", b.ProblemGraphHash))
+		printGreen(w, fmt.Sprintf("New Problem %x \n", b.ProblemGraphHash))
 		// pg, err := bc.GetProblemGraphFromHash(b.ProblemGraphHash)
 		// if err == nil {
 		// 	pg.NicePrint()
 		// }
 		
 	} else {
-		printRed("No problem ;)\n")
+		printRed(w, "No problem ;)\n")
 	}
 
 	for _, tx := range b.Transactions {
-		printYellow(fmt.Sprintln(tx))
+		printYellow(w, fmt.Sprintln(tx))
 	}
-	fmt.Printf("\n")
+	fmt.Fprintf(w, "\n")
 }
 
-// DeserializeBlock deserializes a block
+// DeserializeBlock deserializes a block read from the DB
 func DeserializeBlock(d []byte) *Block {
+	block, err := DecodeBlock(d)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return block
+}
+
+// DecodeBlock deserializes a block from an untrusted source, such as a peer
+func DecodeBlock(d []byte) (*Block, error) {
 	var block Block
 
 	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
-	if err != nil {
-		log.Panic(err)
+	if err := decoder.Decode(&block); err != nil {
+		return nil, err
 	}
 
-	return &block
+	return &block, nil
 }
 
@@ -3,12 +3,13 @@ package crickchain
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"encoding/gob"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"log"
 	"os"
 	"math/big"
+	"sync"
+	"time"
 	"github.com/boltdb/bolt"
 )
 
@@ -17,110 +18,173 @@ const (
 	blocksBucket = "blocks"
 	problemsBucket = "problems"
 	genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
-	blocksPerTargetUpdate = 64
-	initialTargetBits = 16
-	initialReducedTargetBits = 12
 	maxTargetLength = 78
-	targetBlocksPerMinute = 6
 	nanosecondsPerMinute = 60 * 1e9
-	maxTargetChange = 4.0
-	eta = 0.25
 )
 
-var targetTable = map[int]map[string]*big.Int{
-	0 : map[string]*big.Int{
-		"normal" : targetFromTargetBits(initialTargetBits),
-		"reduced": targetFromTargetBits(initialReducedTargetBits),
-	},
-}
-
 // Blockchain implements interactions with a DB
 type Blockchain struct {
-	tip []byte
-	db  *bolt.DB
+	tip    []byte
+	db     *bolt.DB
+	params NetworkParams
+
+	// targetTable caches the targets of each target update, without and with
+	// a solution
+	targetMu    sync.Mutex
+	targetTable map[int]map[string]*big.Int
+
+	// rehashed is the number of problem graphs rekeyed by their canonical
+	// hash when the DB was opened
+	rehashed int
+
+	// verifiers caches the clique verifiers of the problem graphs by hash, so
+	// that each is built once however many times the graph is read
+	verifierMu sync.Mutex
+	verifiers  map[string]*lazyVerifier
+}
+
+func newBlockchain(tip []byte, db *bolt.DB, params NetworkParams) *Blockchain {
+	bc := &Blockchain{tip: tip, db: db, params: params, verifiers: make(map[string]*lazyVerifier)}
+	bc.targetTable = map[int]map[string]*big.Int{
+		0 : map[string]*big.Int{
+			"normal" : targetFromTargetBits(params.InitialTargetBits),
+			"reduced": targetFromTargetBits(params.InitialReducedTargetBits),
+		},
+	}
+
+	return bc
+}
+
+// CreateBlockchain creates a new blockchain DB on the main network. It fails
+// with ErrBlockchainExists if the DB is already there.
+func CreateBlockchain(address, filename string) (*Blockchain, error) {
+	return CreateBlockchainWithParams(address, filename, Networks[DefaultNetwork])
 }
 
-// CreateBlockchain creates a new blockchain DB
-func CreateBlockchain(address, filename string) *Blockchain {
+// CreateBlockchainWithParams creates a new blockchain DB following the
+// consensus parameters params
+func CreateBlockchainWithParams(address, filename string, params NetworkParams) (*Blockchain, error) {
+	if err := checkAddress(address); err != nil {
+		return nil, err
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
 	if dbExists(filename) {
-		fmt.Println("Blockchain already exists.")
-		bc := NewBlockchain(filename)
-		return bc
+		return nil, ErrBlockchainExists
 	}
 
 	var tip []byte
 
-	cbtx := NewCoinbaseTX(address, genesisCoinbaseData)
+	cbtx, err := NewCoinbaseTX(address, genesisCoinbaseData)
+	if err != nil {
+		return nil, err
+	}
 	//pg := NewProblemGraph(20, 85)//remember to add it to the blockchain db at the end!
-	genesis := NewGenesisBlock(cbtx)
+	genesis := NewGenesisBlock(cbtx, params)
 	
 	db, err := bolt.Open(filename, 0600, nil)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucket([]byte(blocksBucket))
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		err = b.Put(genesis.Hash, genesis.Serialize())
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		err = b.Put([]byte("l"), genesis.Hash)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		tip = genesis.Hash
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
-	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucket([]byte(problemsBucket))
+		_, err = tx.CreateBucket([]byte(problemsBucket))
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		return nil
+		_, err = tx.CreateBucket([]byte(problemAliasesBucket))
+		if err != nil {
+			return err
+		}
+		index, err := tx.CreateBucket([]byte(solutionIndexBucket))
+		if err != nil {
+			return err
+		}
+		err = index.Put(solutionIndexTipKey, genesis.Hash)
+		if err != nil {
+			return err
+		}
+
+		return putNetworkParams(tx, params)
 	})
 	if err != nil {
-		log.Panic(err)
+		db.Close()
+		return nil, err
 	}
 
-	bc := Blockchain{tip, db}
+	bc := newBlockchain(tip, db, params)
 	//bc.AddProblemGraph(pg)
 
-	return &bc
+	return bc, nil
 }
 
-// NewBlockchain creates a new Blockchain with genesis Block
-func NewBlockchain(filename string) *Blockchain {
+// NewBlockchain opens an existing blockchain DB. It fails with
+// ErrNoBlockchain if there is none, and ErrLegacyBlockchain if its blocks
+// have outputs without scripts.
+func NewBlockchain(filename string) (*Blockchain, error) {
 	if dbExists(filename) == false {
-		fmt.Println("No existing blockchain found. Create one first.")
-		os.Exit(1)
+		return nil, ErrNoBlockchain
 	}
 
 	var tip []byte
+	var params NetworkParams
 	db, err := bolt.Open(filename, 0600, nil)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("l"))
+		if b == nil {
+			return ErrNoBlockchain
+		}
+		// values returned by Get are only valid in the transaction
+		tip = append([]byte{}, b.Get([]byte("l"))...)
+		if isLegacyChain(b, tip) {
+			return ErrLegacyBlockchain
+		}
 
-		return nil
+		stored, err := getNetworkParams(tx)
+		params = stored
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		db.Close()
+		return nil, err
+	}
+	moved, err := migrateProblemGraphs(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := reindexSolutions(db); err != nil {
+		db.Close()
+		return nil, err
 	}
+	bc := newBlockchain(tip, db, params)
+	bc.rehashed = moved
 
-	bc := Blockchain{tip, db}
+	return bc, nil
+}
 
-	return &bc
+// RehashedProblemGraphs returns the number of problem graphs of an older DB
+// rekeyed by their canonical hash when it was opened
+func (bc *Blockchain) RehashedProblemGraphs() int {
+	return bc.rehashed
 }
 
 //CloseDB exposes the close database function
@@ -128,41 +192,61 @@ func (bc *Blockchain) CloseDB() {
 	bc.db.Close()
 }
 
-// AddBlock saves the block into the blockchain
-func (bc *Blockchain) AddBlock(block *Block) {
-	if block.Validate(bc) {
-		err := bc.db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(blocksBucket))
-			blockInDb := b.Get(block.Hash)
+// AddBlock saves the block into the blockchain. It fails with ErrInvalidBlock
+// if the block doesn't validate.
+func (bc *Blockchain) AddBlock(block *Block) error {
+	return bc.addBlock(block, nil)
+}
 
-			if blockInDb != nil {
-				return nil
-			}
+// addBlock adds a block like AddBlock, with the problem graphs fetched for it
+func (bc *Blockchain) addBlock(block *Block, fetched map[string]*ProblemGraph) error {
+	graphs, err := block.check(bc, fetched)
+	if err != nil {
+		return fmt.Errorf("%w: %x: %w", ErrInvalidBlock, block.Hash, err)
+	}
 
-			blockData := block.Serialize()
-			err := b.Put(block.Hash, blockData)
-			if err != nil {
-				log.Panic(err)
-			}
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		blockInDb := b.Get(block.Hash)
 
-			lastHash := b.Get([]byte("l"))
-			lastBlockData := b.Get(lastHash)
-			lastBlock := DeserializeBlock(lastBlockData)
+		if blockInDb != nil {
+			return nil
+		}
 
-			if block.Height > lastBlock.Height {
-				err = b.Put([]byte("l"), block.Hash)
-				if err != nil {
-					log.Panic(err)
+		blockData := block.Serialize()
+		err := b.Put(block.Hash, blockData)
+		if err != nil {
+			return err
+		}
+
+		// the problem graphs generated from the parameters of the block or
+		// fetched for it are stored with it
+		problems := tx.Bucket([]byte(problemsBucket))
+		for _, pg := range graphs {
+			if problems.Get(pg.Hash) == nil {
+				if err := problems.Put(pg.Hash, pg.Serialize()); err != nil {
+					return err
 				}
-				bc.tip = block.Hash
 			}
+		}
 
-			return nil
-		})
-		if err != nil {
-			log.Panic(err)
+		lastHash := b.Get([]byte("l"))
+		lastBlockData := b.Get(lastHash)
+		lastBlock := DeserializeBlock(lastBlockData)
+
+		if block.Height > lastBlock.Height {
+			err = b.Put([]byte("l"), block.Hash)
+			if err != nil {
+				return err
+			}
+			if err := updateSolutionIndex(tx, lastBlock.Hash, block.Hash); err != nil {
+				return err
+			}
+			bc.tip = block.Hash
 		}
-	}	
+
+		return nil
+	})
 }
 
 // FindTransaction finds a transaction by its ID
@@ -183,11 +267,11 @@ func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
 		}
 	}
 
-	return Transaction{}, errors.New("Transaction is not found")
+	return Transaction{}, ErrTransactionNotFound
 }
 
 func (bc *Blockchain) GetBlocksPerTargetUpdate() int {
-	return blocksPerTargetUpdate
+	return bc.params.BlocksPerTargetUpdate
 }
 
 
@@ -244,22 +328,25 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 }
 
 // GetBestHeight returns the height of the latest block
-func (bc *Blockchain) GetBestHeight() int {
+func (bc *Blockchain) GetBestHeight() (int, error) {
 	var lastBlock Block
 
 	err := bc.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		lastHash := b.Get([]byte("l"))
 		blockData := b.Get(lastHash)
+		if blockData == nil {
+			return &BlockNotFoundError{Hash: lastHash}
+		}
 		lastBlock = *DeserializeBlock(blockData)
 
 		return nil
 	})
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
 
-	return lastBlock.Height
+	return lastBlock.Height, nil
 }
 
 // GetBlockFromHash finds a block by its hash and returns it
@@ -272,7 +359,7 @@ func (bc *Blockchain) GetBlockFromHash(blockHash []byte) (Block, error) {
 		blockData := b.Get(blockHash)
 
 		if blockData == nil {
-			return errors.New("Block is not found.")
+			return &BlockNotFoundError{Hash: blockHash}
 		}
 
 		block = *DeserializeBlock(blockData)
@@ -291,8 +378,8 @@ func (bc *Blockchain) GetBlockFromHeight(height int) (Block, error) {
 	var block Block
 
 	hashes := bc.GetBlockHashes()
-	if height > len(hashes) - 1 {
-		return block, errors.New("Block is not found.")
+	if height < 0 || height > len(hashes) - 1 {
+		return block, &BlockNotFoundError{Height: height}
 	}
 	blockHash := hashes[len(hashes) - 1 - height]
 	err := bc.db.View(func(tx *bolt.Tx) error {
@@ -301,7 +388,7 @@ func (bc *Blockchain) GetBlockFromHeight(height int) (Block, error) {
 		blockData := b.Get(blockHash)
 
 		if blockData == nil {
-			return errors.New("Block is not found.")
+			return &BlockNotFoundError{Height: height}
 		}
 
 		block = *DeserializeBlock(blockData)
@@ -332,7 +419,8 @@ func (bc *Blockchain) GetBlockHashes() [][]byte {
 	return blocks
 }
 
-// GetProlemGraphFromHash finds a Problemgraph by its hash and returns it
+// GetProlemGraphFromHash finds a Problemgraph by its hash, or the hash it had
+// before canonical hashing, and returns it
 func (bc *Blockchain) GetProblemGraphFromHash(pgHash []byte) (ProblemGraph, error) {
 	var pg ProblemGraph
 
@@ -340,9 +428,14 @@ func (bc *Blockchain) GetProblemGraphFromHash(pgHash []byte) (ProblemGraph, erro
 		b := tx.Bucket([]byte(problemsBucket))
 
 		pgData := b.Get(pgHash)
+		if aliases := tx.Bucket([]byte(problemAliasesBucket)); pgData == nil && aliases != nil {
+			if canonical := aliases.Get(pgHash); canonical != nil {
+				pgData = b.Get(canonical)
+			}
+		}
 
 		if pgData == nil {
-			return errors.New("Problem is not found.")
+			return ErrProblemNotFound
 		}
 
 		pg = *DeserializeProblemGraph(pgData)
@@ -352,19 +445,51 @@ func (bc *Blockchain) GetProblemGraphFromHash(pgHash []byte) (ProblemGraph, erro
 	if err != nil {
 		return pg, err
 	}
+	pg.verifier = bc.problemVerifier(pg.Hash)
 
 	return pg, nil
 }
 
-// GetProblemGraphHashes returns a list of hashes of all the problems in the chain
+// problemGraph returns the problem graph with hash pgHash from fetched, the
+// graphs fetched for a block by the hashes it refers to them with, or from
+// the DB
+func (bc *Blockchain) problemGraph(pgHash []byte, fetched map[string]*ProblemGraph) (ProblemGraph, error) {
+	if pg, ok := fetched[string(pgHash)]; ok {
+		return *pg, nil
+	}
+
+	return bc.GetProblemGraphFromHash(pgHash)
+}
+
+// HasProblemGraph tells whether the problem graph of hash, canonical or not,
+// is in the DB
+func (bc *Blockchain) HasProblemGraph(pgHash []byte) bool {
+	found := false
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(problemsBucket)).Get(pgHash) != nil {
+			found = true
+		} else if aliases := tx.Bucket([]byte(problemAliasesBucket)); aliases != nil {
+			found = aliases.Get(pgHash) != nil
+		}
+		return nil
+	})
+
+	return found
+}
+
+// GetProblemGraphHashes returns the canonical hashes of the problems
+// introduced by the blocks of the active chain, latest first. Stored graphs no
+// block introduced are not in it.
 func (bc *Blockchain) GetProblemGraphHashes() [][]byte {
 	var problems [][]byte
+	aliases := bc.problemAliases()
 	bci := bc.Iterator()
 
 	for {
 		block := bci.Next()
 		if len(block.ProblemGraphHash) > 0 {
-			problems = append(problems, block.ProblemGraphHash)
+			problems = append(problems, canonicalProblemHash(aliases, block.ProblemGraphHash))
 		}
 
 		if len(block.PrevBlockHash) == 0 {
@@ -378,99 +503,118 @@ func (bc *Blockchain) GetProblemGraphHashes() [][]byte {
 
 
 
-// GetAllSolutions returns the all solutions found in the blockchain for the given problemgraph
-func (bc *Blockchain) GetAllSolutions(pg *ProblemGraph) [][]int {
-	bci := bc.Iterator()
+// GetAllSolutions returns the all solutions found in the blockchain for the given problemgraph, latest first
+func (bc *Blockchain) GetAllSolutions(pg *ProblemGraph) ([][]int, error) {
 	allSolutions := [][]int{}
-	for {
-		block := bci.Next()
-		if Equal(block.SolutionHash, pg.Hash) {
-			allSolutions = append(allSolutions, block.Solution)
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+	history, err := bc.SolutionHistory(pg.Hash)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		allSolutions = append(allSolutions, history[i].Clique)
 	}
 
-	return allSolutions
+	return allSolutions, nil
 }
 
-// GetBestSolution returns the best solution found in the blockchain for the given problemgraph
-func (bc *Blockchain) GetBestSolution(pg *ProblemGraph, height int) []int {
-	bci := bc.Iterator()
-	bestSol := []int{}
-	for {
-		block := bci.Next()
-		if Equal(block.SolutionHash, pg.Hash) && (len(block.Solution) > len(bestSol) && (block.Height <= height)) {
-			bestSol = block.Solution
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+// GetBestSolution returns the best solution found in the blockchain for the given problemgraph up to height
+func (bc *Blockchain) GetBestSolution(pg *ProblemGraph, height int) ([]int, error) {
+	best, found, err := bc.bestSolution(pg.Hash, height)
+	if err != nil {
+		return nil, err
+	}
+	if !found || best.Clique == nil {
+		return []int{}, nil
 	}
 
-	return bestSol
+	return best.Clique, nil
 }
 
 
 
 //GetNumberOfBlocks returns the number of blocks without solution. If reduced is true, returns the number of blocks with solution.
-func (bc *Blockchain) GetNumberOfBlocks(from int, to int, reduced bool) int {
+func (bc *Blockchain) GetNumberOfBlocks(from int, to int, reduced bool) (int, error) {
 	n := 0
-	if (from > to) || (to > bc.GetBestHeight()) || (from < 0) {
-		fmt.Println("Invalid parameters.", from, to, bc.GetBestHeight())
-		os.Exit(1)
-	} 
-	for h := to; h >= from; h-- {
-		block, err := bc.GetBlockFromHeight(h)
-		if err != nil {
-			log.Panic(err)
-		}
-		if (block.HasValidSolution(bc) && reduced) ||  (!reduced && !block.HasValidSolution(bc)) {
+	blocks, err := bc.blocksInRange(from, to)
+	if err != nil {
+		return 0, err
+	}
+	for _, block := range blocks {
+		if block.HasValidSolution(bc) == reduced {
 			n += 1
 		} 		
 	}
-	return n	
+	return n, nil
 }
 
 //TimeForBlocks returns the time spent mining block. If reduced is true, returns time sent for blocks at reduced difficulty
-func (bc *Blockchain) TimeForBlocks(from int, to int, reduced bool) int64 {
+func (bc *Blockchain) TimeForBlocks(from int, to int, reduced bool) (int64, error) {
 	t := int64(0)
-	if (from > to) || (to > bc.GetBestHeight()) || (from < 0) {
-		fmt.Println("Invalid parameters.", from, to, bc.GetBestHeight())
-		os.Exit(1)
-	} 
-	for h := to; h > from; h-- {
-		block, err := bc.GetBlockFromHeight(h)
-		if err != nil {
-			log.Panic(err)
-		}
-		if (block.HasValidSolution(bc) && reduced) ||  (!reduced && !block.HasValidSolution(bc)) {
-			prevBlock, err := bc.GetBlockFromHeight(h-1)
-			if err != nil {
-				log.Panic(err)
-		}
-			t += block.Timestamp - prevBlock.Timestamp
+	blocks, err := bc.blocksInRange(from, to)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(blocks) - 1; i > 0; i-- {
+		if blocks[i].HasValidSolution(bc) == reduced {
+			t += blocks[i].Timestamp - blocks[i-1].Timestamp
 		} 		
 	}
-	return t	
+	return t, nil
+}
+
+// blocksInRange returns the blocks of the active chain from height from to
+// height to, walking the chain once
+func (bc *Blockchain) blocksInRange(from int, to int) ([]*Block, error) {
+	if err := bc.checkHeightRange(from, to); err != nil {
+		return nil, err
+	}
+	hashes := bc.GetBlockHashes()
+	blocks := make([]*Block, 0, to-from+1)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		for h := from; h <= to; h++ {
+			blockData := b.Get(hashes[len(hashes)-1-h])
+			if blockData == nil {
+				return &BlockNotFoundError{Height: h}
+			}
+			blocks = append(blocks, DeserializeBlock(blockData))
+		}
+		return nil
+	})
+
+	return blocks, err
+}
+
+// checkHeightRange checks that from..to is a range of heights of the chain
+func (bc *Blockchain) checkHeightRange(from int, to int) error {
+	best, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	if (from > to) || (to > best) || (from < 0) {
+		return fmt.Errorf("invalid block range %d..%d, best height is %d", from, to, best)
+	}
+
+	return nil
 }
 
 
 //CalculateTarget return the new target. If reduced is true, returns the reduced target
-func (bc *Blockchain) CalculateTarget(height int, reduced bool) *big.Int {
+func (bc *Blockchain) CalculateTarget(height int, reduced bool) (*big.Int, error) {
 	var prevTarget *big.Int
 	var newTarget *big.Int
 	//var tBits int
 
+	blocksPerTargetUpdate := bc.params.BlocksPerTargetUpdate
 	base := height/blocksPerTargetUpdate
-	if val, ok := targetTable[base]; ok {
+	bc.targetMu.Lock()
+	val, ok := bc.targetTable[base]
+	bc.targetMu.Unlock()
+	if ok {
 		if reduced {
-			return val["reduced"] 
+			return val["reduced"], nil
 		}
-	    return val["normal"] 
+	    return val["normal"], nil
 	}
 
 	// if height < blocksPerTargetUpdate {
@@ -486,26 +630,54 @@ func (bc *Blockchain) CalculateTarget(height int, reduced bool) *big.Int {
 	hashes := bc.GetBlockHashes()
 	total := len(hashes)
 	index := ((height-1)/blocksPerTargetUpdate) * blocksPerTargetUpdate //this return only integer part of ratio since i'm divindg two integers
-	baseBlock, _ := bc.GetBlockFromHash(hashes[total -1 - index])//this block is the first block in the batch of blocks we need to calculate difficulty
+	if total - 1 - index < 0 {
+		return nil, &BlockNotFoundError{Height: index}
+	}
+	baseBlock, err := bc.GetBlockFromHash(hashes[total -1 - index])//this block is the first block in the batch of blocks we need to calculate difficulty
+	if err != nil {
+		return nil, err
+	}
 	//This iw rong now
 	rest := height%blocksPerTargetUpdate
 	if rest != 0 {
 		return bc.CalculateTarget(height - rest, reduced)
 	}
 	
-	lastBlock, _ := bc.GetBlockFromHash(hashes[total - 1 - (blocksPerTargetUpdate + index - 1)])//this block is the last block in the batch of blocks we need to calculate difficulty
-	tReduced := bc.TimeForBlocks(baseBlock.Height, lastBlock.Height, true)
-	tNormal := bc.TimeForBlocks(baseBlock.Height, lastBlock.Height, false)
+	lastIndex := blocksPerTargetUpdate + index - 1
+	if total - 1 - lastIndex < 0 {
+		return nil, &BlockNotFoundError{Height: lastIndex}
+	}
+	lastBlock, err := bc.GetBlockFromHash(hashes[total - 1 - lastIndex])//this block is the last block in the batch of blocks we need to calculate difficulty
+	if err != nil {
+		return nil, err
+	}
+	tReduced, err := bc.TimeForBlocks(baseBlock.Height, lastBlock.Height, true)
+	if err != nil {
+		return nil, err
+	}
+	tNormal, err := bc.TimeForBlocks(baseBlock.Height, lastBlock.Height, false)
+	if err != nil {
+		return nil, err
+	}
 	etaStar := float64(tReduced)/float64(tNormal)
 	
-	r := float64(bc.GetNumberOfBlocks(baseBlock.Height, lastBlock.Height, false))/blocksPerTargetUpdate //this is b in the paper
+	nNormal, err := bc.GetNumberOfBlocks(baseBlock.Height, lastBlock.Height, false)
+	if err != nil {
+		return nil, err
+	}
+	r := float64(nNormal)/float64(blocksPerTargetUpdate) //this is b in the paper
 
 	t := lastBlock.Timestamp - baseBlock.Timestamp
 	
-	prevTarget = bc.CalculateTarget(height - blocksPerTargetUpdate, false)
+	prevTarget, err = bc.CalculateTarget(height - blocksPerTargetUpdate, false)
+	if err != nil {
+		return nil, err
+	}
 	prevDiff := targetToDifficulty(prevTarget)
 
-	timeTarget := nanosecondsPerMinute * blocksPerTargetUpdate / targetBlocksPerMinute
+	timeTarget := nanosecondsPerMinute * int64(blocksPerTargetUpdate) / int64(bc.params.TargetBlocksPerMinute)
+	eta := bc.params.Eta
+	maxTargetChange := bc.params.MaxTargetChange
 
 
 	retarget := (r + (1 - r) * etaStar)/(r + (1 - r) * eta) * (float64(timeTarget) / float64(t))
@@ -525,7 +697,10 @@ func (bc *Blockchain) CalculateTarget(height int, reduced bool) *big.Int {
 
 	
 	//calculate reduced newtarget
-	prevTargetReduced := bc.CalculateTarget(height - blocksPerTargetUpdate, true)
+	prevTargetReduced, err := bc.CalculateTarget(height - blocksPerTargetUpdate, true)
+	if err != nil {
+		return nil, err
+	}
 	prevDiffReduced := targetToDifficulty(prevTargetReduced)
 	
 	retargetReduced := eta * retarget - etaStar
@@ -550,41 +725,49 @@ func (bc *Blockchain) CalculateTarget(height int, reduced bool) *big.Int {
 		fmt.Printf("Rescaling factor reduced: %5f\n", retargetReduced)
 		fmt.Printf("new diff reduced %d\n", newDiffReduced)
 	}
-	targetTable[base] = map[string]*big.Int{}
-	targetTable[base]["normal"] = newTarget
-	targetTable[base]["reduced"] = newTargetReduced
+	bc.targetMu.Lock()
+	bc.targetTable[base] = map[string]*big.Int{
+		"normal": newTarget,
+		"reduced": newTargetReduced,
+	}
+	bc.targetMu.Unlock()
 	if !reduced {
-		return newTarget
+		return newTarget, nil
 	}
-	return newTargetReduced		
+	return newTargetReduced, nil
 }
 
 //Calculate the new target bits
-func (bc *Blockchain) CurrentTarget(reduced bool) *big.Int {
-	height := bc.GetBestHeight() + 1
-	return bc.CalculateTarget(height, reduced)
-}
-
-//GetBlockTarget returns the target for a block
-func (bc *Blockchain) GetBlockTarget(height int, solHash []byte, solution []int, pgHash []byte) *big.Int {
-	//if solution is valid, use reduced difficulty
-	if len(solHash) > 0 && !Equal(pgHash, solHash) {
-		pg, err := bc.GetProblemGraphFromHash(solHash)
-		if err == nil {
-			bestSol := bc.GetBestSolution(&pg, height)
-			if (len(solution) > len(bestSol)) && pg.ValidateClique(solution) {
-				return bc.CalculateTarget(height+1, true)
-			}
-		}
+func (bc *Blockchain) CurrentTarget(reduced bool) (*big.Int, error) {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
 	}
-	return bc.CalculateTarget(height+1, false)
+	return bc.CalculateTarget(height+1, reduced)
+}
+
+//GetBlockTarget returns the target for a block on top of the block at height
+//of the chain, reduced if its solution is valid as HasValidSolution decides
+func (bc *Blockchain) GetBlockTarget(height int, solHash []byte, solution []int, pgHash []byte) (*big.Int, error) {
+	prev, err := bc.GetBlockFromHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{PrevBlockHash: prev.Hash, Height: height + 1, SolutionHash: solHash, Solution: solution, ProblemGraphHash: pgHash}
+
+	return bc.CalculateTarget(height+1, block.HasValidSolution(bc))
 }
 
 func (bc *Blockchain) GetVerifiedTransactions(transactions []*Transaction) []*Transaction {
+	valid := bc.VerifyTransactions(transactions)
 	for i := len(transactions) - 1; i >= 0; i-- {
 	    tx := transactions[i]
-	    if bc.VerifyTransaction(tx) != true {
-			fmt.Println("ERROR: Invalid transaction\n", tx)
+	    if valid[i] != true {
+			fmt.Fprintln(os.Stderr, "ERROR: Invalid transaction\n", tx)
+			transactions = append(transactions[:i],
+	                transactions[i+1:]...)
+		} else if err := bc.CheckTransactionLocksAtTip(tx); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Locked transaction:", err)
 			transactions = append(transactions[:i],
 	                transactions[i+1:]...)
 		}
@@ -595,17 +778,25 @@ func (bc *Blockchain) GetVerifiedTransactions(transactions []*Transaction) []*Tr
 
 
 // MineBlock mines a new block with the provided transactions
-func (bc *Blockchain) MineBlock(transactions []*Transaction, solHash []byte, solution []int,  pgHash []byte) *Block {
-	// bci := bc.Iterator()
-	// lastBlock := bci.Next()
-	// lastHash := lastBlock.Hash
-	// lastHeight := lastBlock.Height
+func (bc *Blockchain) MineBlock(transactions []*Transaction, solHash []byte, solution []int,  pgHash []byte) (*Block, error) {
+	return bc.mineBlock(transactions, solHash, solution, pgHash, nil)
+}
+
+// MineProblemBlock mines a new block introducing pg, generated from the seed
+// of the tip by NextProblemGraph, with an initial solution
+func (bc *Blockchain) MineProblemBlock(transactions []*Transaction, pg *ProblemGraph, solution []int) (*Block, error) {
+	params := &ProblemParams{pg.Graph.Order(), pg.Graph.Size()}
+
+	return bc.mineBlock(transactions, pg.Hash, solution, pg.Hash, params)
+}
+
+func (bc *Blockchain) mineBlock(transactions []*Transaction, solHash []byte, solution []int,  pgHash []byte, params *ProblemParams) (*Block, error) {
 	var lastHash []byte
 	var lastHeight int
 
 	err := bc.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+		lastHash = append([]byte{}, b.Get([]byte("l"))...)
 
 		blockData := b.Get(lastHash)
 		block := DeserializeBlock(blockData)
@@ -616,73 +807,182 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction, solHash []byte, sol
 	})
 
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	verifiedTxs := bc.GetVerifiedTransactions(transactions)
 	//fmt.Println(verifiedTxs)
-	target := bc.GetBlockTarget(lastHeight, solHash, solution, pgHash)	
-
-	newBlock := NewBlock(verifiedTxs, lastHash, lastHeight+1, target, solHash, solution, pgHash)
+	newBlock := &Block{time.Now().UnixNano(), verifiedTxs, lastHash, []byte{}, 0, lastHeight+1, nil, solHash, solution, pgHash, params}
+	newBlock.Target, err = bc.CalculateTarget(newBlock.Height, newBlock.HasValidSolution(bc))
+	if err != nil {
+		return nil, err
+	}
+	if len(pgHash) > 0 {
+		if _, err := bc.checkNewProblem(newBlock, nil); err != nil {
+			return nil, err
+		}
+	}
+	newBlock.mine()
 
-	return newBlock
+	return newBlock, nil
 }
 
 
 // SignTransaction signs inputs of a Transaction
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
-	prevTXs := make(map[string]Transaction)
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
+	prevTXs, err := bc.findInputTransactions(tx)
+	if err != nil {
+		return err
+	}
 
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			log.Panic(err)
-		}
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	return tx.Sign(privKey, prevTXs)
+}
+
+// SignMultisigTransaction signs inputs of a Transaction spending a multisig redeem script
+func (bc *Blockchain) SignMultisigTransaction(tx *Transaction, privKeys []ecdsa.PrivateKey, redeemScript []byte) error {
+	prevTXs, err := bc.findInputTransactions(tx)
+	if err != nil {
+		return err
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return tx.SignMultisig(privKeys, redeemScript, prevTXs)
 }
 
-// VerifyTransaction verifies transaction input signatures
+// VerifyTransaction verifies transaction input signatures. A transaction
+// spending outputs that are not in the chain is not valid.
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
+	prevTXs, err := bc.findInputTransactions(tx)
+	if err != nil {
+		return false
+	}
+
+	return verifyInputsParallel([]*Transaction{tx}, prevTXs, sigCache, true)[0]
+}
+
+// VerifyTransactions verifies the input signatures of a batch of transactions,
+// such as the ones of a block, checking all inputs in parallel. Signatures
+// already verified on mempool acceptance are not checked again.
+func (bc *Blockchain) VerifyTransactions(txs []*Transaction) []bool {
+	prevTXs := bc.findPrevTransactions(txs)
+
+	return verifyInputsParallel(txs, prevTXs, sigCache, false)
+}
+
+// findInputTransactions finds the transactions spent by the inputs of tx
+func (bc *Blockchain) findInputTransactions(tx *Transaction) (map[string]Transaction, error) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
 		prevTX, err := bc.FindTransaction(vin.Txid)
 		if err != nil {
-			log.Panic(err)
+			return nil, fmt.Errorf("input spends %x: %w", vin.Txid, err)
 		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return tx.Verify(prevTXs)
+	return prevTXs, nil
+}
+
+// findPrevTransactions collects the transactions spent by txs, taking them
+// from txs itself first and then from a single walk over the chain
+func (bc *Blockchain) findPrevTransactions(txs []*Transaction) map[string]Transaction {
+	prevTXs := make(map[string]Transaction)
+	missing := make(map[string]bool)
+
+	for _, tx := range txs {
+		prevTXs[hex.EncodeToString(tx.ID)] = *tx
+	}
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, vin := range tx.Vin {
+			txID := hex.EncodeToString(vin.Txid)
+			if _, ok := prevTXs[txID]; !ok {
+				missing[txID] = true
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return prevTXs
+	}
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			txID := hex.EncodeToString(tx.ID)
+			if missing[txID] {
+				prevTXs[txID] = *tx
+				delete(missing, txID)
+			}
+		}
+
+		if len(missing) == 0 || len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return prevTXs
 }
 
-// AddProblemGraph add a problem to the database
-func (bc *Blockchain) AddProblemGraph(pg *ProblemGraph) {
-	err := bc.db.Update(func(tx *bolt.Tx) error {
+// AddProblemGraph add a problem to the database. Its hash must be the
+// canonical one.
+func (bc *Blockchain) AddProblemGraph(pg *ProblemGraph) error {
+	if !Equal(pg.Hash, pg.GetHash()) {
+		return fmt.Errorf("%w: problem graph hash %x is not canonical", ErrInvalidProblem, pg.Hash)
+	}
+
+	return bc.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(problemsBucket))
 		problemInDb := b.Get(pg.Hash)
 		if problemInDb != nil {
 			return nil
 		}
 
-		pgData := pg.Serialize()
-		err := b.Put(pg.Hash, pgData)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		return nil
+		return b.Put(pg.Hash, pg.Serialize())
 	})
-	if err != nil {
-		log.Panic(err)
+}
+
+// isLegacyChain checks whether the blocks were written before outputs were
+// locked with scripts, when they held the pubkey hash they pay. Such outputs
+// decode with an empty script, and the blocks can't be rewritten since the
+// transaction IDs and signatures cover the outputs. Blocks can be empty but
+// the genesis block has a coinbase output.
+func isLegacyChain(blocks *bolt.Bucket, tip []byte) bool {
+	for hash := tip; len(hash) > 0; {
+		var block struct {
+			PrevBlockHash []byte
+			Transactions  []struct {
+				Vout []struct {
+					PubKeyHash   []byte
+					ScriptPubKey []byte
+				}
+			}
+		}
+		data := blocks.Get(hash)
+		if data == nil || gob.NewDecoder(bytes.NewReader(data)).Decode(&block) != nil {
+			return false
+		}
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				if len(out.PubKeyHash) > 0 {
+					return true
+				}
+				if len(out.ScriptPubKey) > 0 {
+					return false
+				}
+			}
+		}
+		hash = block.PrevBlockHash
 	}
+
+	return false
 }
 
 func dbExists(dbFile string) bool {
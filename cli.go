@@ -1,58 +1,114 @@
 package crickchain
 
 import (
+	"errors"
 	"strings"
 	"fmt"
 	"log"
 	"os"
 	"bufio"
 	"strconv"
+	"time"
+	"flag"
+	"io"
+	"io/ioutil"
+	"encoding/hex"
 	
 )
 
 // CLI responsible for processing command line arguments
-type CLI struct{}
-
-func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  createblockchain ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
-	fmt.Println("  getbalance ADDRESS - Get balance of ADDRESS")
-	fmt.Println("  getbalances - Get balances of all addresses")
-	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
-	fmt.Println("  printchain - Print all the blocks of the blockchain")
-	fmt.Println("  printproblems - Print all the problems of the blockchain")
-	fmt.Println("  printproblem HASH - Display problem with hash HASH")
-	fmt.Println("  printlast - Print last block of the blockchain")
-	fmt.Println("  printblock HEIGHT - Display block number HEIGHT")
-	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("  send FROM TO AMOUNT - Send AMOUNT of coins from FROM address to TO.")
-	fmt.Println("  startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
-	fmt.Println("  mineblock N- Mine N blocks with empty transactions. Default is 1")
-	fmt.Println("  mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density")
-	fmt.Println("  mineblocksol HASH -  Mine 1 block with empty transactions and a solution to problem HASH")
-	fmt.Println("  getdiff - Display current difficulty")
-	fmt.Println("  creategraph - Create a new problem graph, with default 50 nodes and 620 edges")
+type CLI struct {
+	// JSON makes commands print their result as JSON
+	JSON bool
+	// Out receives the results and the other messages of the commands,
+	// except the progress messages in JSON mode, which go to stderr.
+	// os.Stdout when nil.
+	Out io.Writer
+}
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError reports a command called with wrong arguments
+type usageError struct {
+	// usage is the help line of the command, "" to list all the commands
+	usage  string
+	reason string
+}
+
+func (e *usageError) Error() string {
+	return e.reason
+}
+
+func (cli *CLI) printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  createblockchain ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Fprintln(w, "  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Fprintln(w, "  createhdwallet - Generates a recovery phrase from which createwallet derives new addresses")
+	fmt.Fprintln(w, "  restorehdwallet WORD1 WORD2 ... - Restore an HD wallet from its recovery phrase and scan for used addresses")
+	fmt.Fprintln(w, "  scanhdwallet [GAPLIMIT] - Scan the UTXO set for used HD addresses, stopping after GAPLIMIT unused ones. Default is 20")
+	fmt.Fprintln(w, "  createmultisig M KEY1 KEY2 ... - Create an M-of-N multisig address from wallet addresses or hex public keys")
+	fmt.Fprintln(w, "  getpubkey ADDRESS - Display the public key of wallet address ADDRESS")
+	fmt.Fprintln(w, "  encryptwallet PASSPHRASE - Encrypt the wallet file with PASSPHRASE")
+	fmt.Fprintln(w, "  walletpassphrase PASSPHRASE TIMEOUT - Unlock the wallet file for TIMEOUT seconds")
+	fmt.Fprintln(w, "  walletlock - Lock the wallet file")
+	fmt.Fprintln(w, "  walletpassphrasechange OLD NEW - Change the wallet passphrase from OLD to NEW")
+	fmt.Fprintln(w, "  exportkey ADDRESS - Display the private key of ADDRESS in Base58Check")
+	fmt.Fprintln(w, "  importkey KEY - Add a private key exported with exportkey to the wallet file")
+	fmt.Fprintln(w, "  importaddress ADDRESS - Watch ADDRESS without its private key")
+	fmt.Fprintln(w, "  getbalance ADDRESS - Get balance of ADDRESS")
+	fmt.Fprintln(w, "  getbalances - Get balances of all addresses")
+	fmt.Fprintln(w, "  listaddresses - Lists all addresses from the wallet file")
+	fmt.Fprintln(w, "  listtransactions [-address ADDRESS] [-category generate|receive|send|self] [-minconf N] [-skip N] [-count N] - List wallet transactions, newest first. Default count is 10")
+	fmt.Fprintln(w, "  setlabel ADDRESS [LABEL] - Name ADDRESS, or remove its name")
+	fmt.Fprintln(w, "  settxlabel TXID [LABEL] - Name transaction TXID, or remove its name")
+	fmt.Fprintln(w, "  printchain - Print all the blocks of the blockchain")
+	fmt.Fprintln(w, "  printproblems - Print all the problems of the blockchain")
+	fmt.Fprintln(w, "  printproblem HASH - Display problem with hash HASH")
+	fmt.Fprintln(w, "  printlast - Print last block of the blockchain")
+	fmt.Fprintln(w, "  printblock HEIGHT - Display block number HEIGHT")
+	fmt.Fprintln(w, "  reindexutxo - Rebuilds the UTXO set")
+	fmt.Fprintln(w, "  send FROM TO AMOUNT [LOCKTIME] - Send AMOUNT of coins from FROM address to TO. With LOCKTIME, TO can't spend them before that block height (or unix time if >= 500000000)")
+	fmt.Fprintln(w, "  sendmany FROM CSVFILE [STRATEGY] [-dryrun] - Pay every ADDRESS,AMOUNT[,LOCKTIME] line of CSVFILE from FROM. STRATEGY is largest, bnb (no change) or random. -dryrun shows the transaction without sending it")
+	fmt.Fprintln(w, "  createrawtx FROM TO AMOUNT [LOCKTIME] - Display an unsigned transaction to sign with signrawtx, without needing the keys of FROM")
+	fmt.Fprintln(w, "  signrawtx RAWTX - Sign RAWTX, given in hex or as a file name, with the keys of the wallet file. Multisig signers sign in turn")
+	fmt.Fprintln(w, "  broadcastrawtx RAWTX - Send a completely signed RAWTX, given in hex or as a file name")
+	fmt.Fprintln(w, "  startnode [ADDRESS] [-rpc PORT] [-rpctoken TOKEN] - Start a node mining to ADDRESS, the configured miner by default. -rpc serves the JSON-RPC API on localhost:PORT, or on HOST:PORT")
+	fmt.Fprintln(w, "  mineblock N- Mine N blocks with empty transactions. Default is 1")
+	fmt.Fprintln(w, "  mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density")
+	fmt.Fprintln(w, "  mineblocksol HASH -  Mine 1 block with empty transactions and a solution to problem HASH")
+	fmt.Fprintln(w, "  getdiff - Display current difficulty")
+	fmt.Fprintln(w, "  creategraph - Show the problem graph the next block would introduce, of 500 nodes and 110000 edges unless configured otherwise")
 	
 }
 
-// Run parses command line arguments and processes commands
+// Run runs the command given on the command line and exits, or reads
+// commands from stdin when there is none
 func (cli *CLI) Run() {
+	config, commands, err := cli.parseArgs(os.Args[1:])
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+	if len(commands) > 0 {
+		os.Exit(cli.Exec(os.Args[1:]))
+	}
+	if _, err := unlockWithPassphraseFile(config); err != nil {
+		printError(os.Stderr, err)
+		os.Exit(exitError)
+	}
+
 	//cli.validateArgs()
 	// err := godotenv.Load()
 	// if err != nil {
 	// 	log.Fatal(err)
 	// }
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		fmt.Printf("NODE_ID env. var is not set!")
-		os.Exit(1)
-	}
-	dbFile := fmt.Sprintf(dbFile, nodeID)
-	walletFile := fmt.Sprintf(walletFile, nodeID)
 	stdReader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Print("\n> ")
+		fmt.Fprint(cli.stdout(), "\n> ")
 		sendData, err := stdReader.ReadString('\n')
 		if err != nil {
 			log.Fatal(err)
@@ -61,144 +117,504 @@ func (cli *CLI) Run() {
 		if len(commands) == 0 {
 			continue 
 		}
-		command := strings.ToLower(commands[0])
+		if commands[0] == "q" || commands[0] == "quit" {
+			os.Exit(1)
+		}
+		if err := cli.execute(config, commands); err != nil {
+			printError(cli.stdout(), err)
+		}
+	}
+}
+
+// Exec runs one command given as command line arguments, after the global
+// flags, and returns the exit code: 0 on success, 1 when the command fails
+// and 2 when it is called wrongly. With -json, wherever it appears, the
+// result is printed as JSON and the other messages go to stderr.
+func (cli *CLI) Exec(args []string) int {
+	config, commands, err := cli.parseArgs(args)
+	if err == nil && len(commands) == 0 {
+		err = &usageError{"", "Missing command."}
+	}
+	if err != nil {
+		printError(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	lock, err := unlockWithPassphraseFile(config)
+	if err != nil {
+		printError(os.Stderr, err)
+		return exitError
+	}
+	defer lock()
+	err = cli.execute(config, commands)
+	if err == nil {
+		return exitOK
+	}
+
+	printError(os.Stderr, err)
+	return exitCode(err)
+}
+
+// parseArgs returns the configuration given by the global flags, on top of
+// the configuration file and the NODE_ID env. var., and the command after
+// the flags
+func (cli *CLI) parseArgs(args []string) (Config, []string, error) {
+	flags := flag.NewFlagSet("crickchain", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&cli.JSON, "json", cli.JSON, "print the result as JSON")
+	configFile := flags.String("config", os.Getenv("CRICK_CONFIG"), "YAML configuration file, CRICK_CONFIG env. var. by default")
+	flags.String("node", "", "node ID naming the DB and wallet files, NODE_ID env. var. by default")
+	flags.String("datadir", "", "directory of the DB and wallet files")
+	flags.String("db", "", "blockchain DB file")
+	flags.String("wallet", "", "wallet file")
+	flags.String("network", "", "network of the blockchain: main, test, regtest or one of the configuration file")
+	flags.String("listen", "", "address the node accepts peers on")
+	flags.String("seeds", "", "comma separated peers contacted on start, the first one being the central node")
+	flags.String("miner", "", "address mining rewards go to")
+	flags.Int("graphnodes", 0, "number of nodes of the problem graphs made by creategraph")
+	flags.Int("graphedges", 0, "number of edges of the problem graphs made by creategraph")
+	flags.String("passphrase-file", "", "file holding the passphrase of the wallet file, CRICK_PASSPHRASE_FILE env. var. by default")
+	flags.String("solver", "", "clique solver of minepar: bronkerbosch, greedy, branchandbound, or an external one with its arguments separated by spaces")
+	usage := func() string {
+		var b strings.Builder
+		fmt.Fprintln(&b, "crickchain [FLAGS] COMMAND [ARGS...]")
+		flags.SetOutput(&b)
+		flags.PrintDefaults()
+		return strings.TrimRight(b.String(), "\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, &usageError{usage(), err.Error()}
+	}
+
+	var commands []string
+	for _, arg := range flags.Args() {
+		if arg == "-json" || arg == "--json" {
+			cli.JSON = true
+		} else {
+			commands = append(commands, arg)
+		}
+	}
+
+	var config Config
+	if *configFile != "" {
+		var err error
+		if config, err = LoadConfig(*configFile); err != nil {
+			return Config{}, nil, err
+		}
+	}
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		config.NodeID = nodeID
+	}
+	if passphraseFile := os.Getenv("CRICK_PASSPHRASE_FILE"); passphraseFile != "" {
+		config.PassphraseFile = passphraseFile
+	}
+	flags.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch f.Name {
+		case "node":
+			config.NodeID = value
+		case "datadir":
+			config.DataDir = value
+		case "db":
+			config.DBFile = value
+		case "wallet":
+			config.WalletFile = value
+		case "network":
+			config.Network = value
+		case "listen":
+			config.ListenAddress = value
+		case "seeds":
+			config.Seeds = strings.Split(value, ",")
+		case "miner":
+			config.MinerAddress = value
+		case "passphrase-file":
+			config.PassphraseFile = value
+		case "graphnodes":
+			config.GraphNodes, _ = strconv.Atoi(value)
+		case "graphedges":
+			config.GraphEdges, _ = strconv.Atoi(value)
+		case "solver":
+			if _, ok := BuiltinSolvers[value]; ok {
+				config.Solver.Builtin, config.Solver.Command = value, nil
+			} else {
+				config.Solver.Builtin, config.Solver.Command = "", strings.Fields(value)
+			}
+		}
+	})
+	if config.Network != "" {
+		if _, err := config.NetworkParams(); err != nil {
+			return Config{}, nil, &usageError{usage(), err.Error()}
+		}
+	}
+	if config.GraphNodes < 0 || config.GraphEdges < 0 {
+		return Config{}, nil, &usageError{usage(), "Invalid problem graph size."}
+	}
+	if config.NodeID == "" && (config.DBFile == "" || config.WalletFile == "") {
+		return Config{}, nil, &usageError{usage(), "NODE_ID env. var is not set, nor -node or the files in the configuration"}
+	}
+
+	return config, commands, nil
+}
+
+// exitCode returns the exit code of a failed command
+func exitCode(err error) int {
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+
+	return exitError
+}
+
+// execute runs a command and its arguments
+func (cli *CLI) execute(config Config, commands []string) error {
+	dbFile := config.DBPath()
+	walletFile := config.WalletPath()
+	command := strings.ToLower(commands[0])
+
+	var err error
+	var cmdErr error
+	// mined lists the blocks mined by the command, reported in JSON mode
+	var mined []minedBlockJSON
+	addBlock := func(block *Block) error {
+		if err := cli.addBlock(dbFile, block); err != nil {
+			return err
+		}
+		mined = append(mined, minedBlockJSON{hex.EncodeToString(block.Hash), block.Height})
+		return nil
+	}
 		switch command {
 			case "printchain":
-				cli.printChain(dbFile)
+				cmdErr = cli.printChain(dbFile)
 			case "printlast":
-				cli.printLast(dbFile)
-			case "q", "quit":
-				os.Exit(1)
+				cmdErr = cli.printLast(dbFile)
 			case "qs":
-				cli.quickstart(dbFile, walletFile)
+				params, err := config.NetworkParams()
+				if err != nil {
+					cmdErr = err
+					break
+				}
+				cmdErr = cli.quickstart(dbFile, walletFile, params)
 			case "createwallet":
-				cli.createWallet(walletFile)
+				cmdErr = cli.createWallet(walletFile)
 			case "listaddresses":
-				cli.listAddresses(dbFile)
+				cmdErr = cli.listAddresses(walletFile)
+			case "listtransactions":
+				filter := HistoryFilter{Count: 10}
+				valid := len(commands)%2 == 1
+				for i := 1; valid && i+1 < len(commands); i += 2 {
+					value := commands[i+1]
+					switch commands[i] {
+					case "-address":
+						filter.Address = value
+					case "-category":
+						filter.Category = value
+					case "-minconf":
+						filter.MinConfirmations, err = strconv.Atoi(value)
+						valid = err == nil
+					case "-skip":
+						filter.Skip, err = strconv.Atoi(value)
+						valid = err == nil && filter.Skip >= 0
+					case "-count":
+						filter.Count, err = strconv.Atoi(value)
+						valid = err == nil && filter.Count >= 0
+					default:
+						valid = false
+					}
+				}
+				if valid {
+					cmdErr = cli.listTransactions(dbFile, walletFile, filter)
+				} else {
+					cmdErr = &usageError{"listtransactions [-address ADDRESS] [-category generate|receive|send|self] [-minconf N] [-skip N] [-count N] - List wallet transactions, newest first. Default count is 10", "Invalid arguments."}
+				}
+			case "setlabel":
+				if len(commands) > 1 {
+					cmdErr = cli.setLabel(walletFile, commands[1], strings.Join(commands[2:], " "))
+				 } else {
+				 	cmdErr = &usageError{"setlabel ADDRESS [LABEL] - Name ADDRESS, or remove its name", "Missing argument ADDRESS"}
+				 }
+			case "settxlabel":
+				if len(commands) > 1 {
+					cmdErr = cli.setTxLabel(walletFile, commands[1], strings.Join(commands[2:], " "))
+				 } else {
+				 	cmdErr = &usageError{"settxlabel TXID [LABEL] - Name transaction TXID, or remove its name", "Missing argument TXID"}
+				 }
 			case "reindexutxo":
-				cli.reindexUTXO(dbFile)
+				cmdErr = cli.reindexUTXO(dbFile)
 			case "getbalances":
-				cli.getAllBalances(dbFile, walletFile)
+				cmdErr = cli.getAllBalances(dbFile, walletFile)
 			case "getdiff":
-				cli.getDifficulty(dbFile)
+				cmdErr = cli.getDifficulty(dbFile)
 			case "creategraph":
-				cli.createGraph(dbFile, 500, 110000)
+				nodes, edges := config.graphSize()
+				cmdErr = cli.createGraph(dbFile, nodes, edges)
 			case "printproblems":
-				cli.printProblemGraphs(dbFile)	
+				cmdErr = cli.printProblemGraphs(dbFile)	
+			case "createmultisig":
+				if len(commands) > 2 {
+					m, err := strconv.Atoi(commands[1])
+					if err != nil {
+						cmdErr = &usageError{"createmultisig M KEY1 KEY2 ... - Create an M-of-N multisig address from wallet addresses or hex public keys", "Invalid M argument."}
+					} else {
+						cmdErr = cli.createMultisig(walletFile, m, commands[2:])
+					}
+				 } else {
+				 	cmdErr = &usageError{"createmultisig M KEY1 KEY2 ... - Create an M-of-N multisig address from wallet addresses or hex public keys", "Missing arguments"}
+				 }
+			case "getpubkey":
+				if len(commands) > 1 {
+					address := commands[1]
+					cmdErr = cli.getPubKey(walletFile, address)
+				 } else {
+				 	cmdErr = &usageError{"getpubkey ADDRESS - Display the public key of wallet address ADDRESS", "Missing argument ADDRESS"}
+				 }
+			case "createhdwallet":
+				cmdErr = cli.createHDWallet(walletFile)
+			case "restorehdwallet":
+				if len(commands) > 1 {
+					cmdErr = cli.restoreHDWallet(walletFile, dbFile, commands[1:], hdDefaultGapLimit)
+				 } else {
+				 	cmdErr = &usageError{"restorehdwallet WORD1 WORD2 ... - Restore an HD wallet from its recovery phrase and scan for used addresses", "Missing recovery phrase"}
+				 }
+			case "scanhdwallet":
+				gapLimit := hdDefaultGapLimit
+				if len(commands) == 2 {
+					n, err := strconv.Atoi(commands[1])
+					if err != nil || n <= 0 {
+						cmdErr = &usageError{"scanhdwallet [GAPLIMIT] - Scan the UTXO set for used HD addresses, stopping after GAPLIMIT unused ones. Default is 20", "Invalid GAPLIMIT argument."}
+						break
+					}
+					gapLimit = n
+				}
+				cmdErr = cli.scanHDWallet(walletFile, dbFile, gapLimit)
+			case "encryptwallet":
+				if len(commands) > 1 {
+					cmdErr = cli.encryptWallet(walletFile, commands[1])
+				 } else {
+				 	cmdErr = &usageError{"encryptwallet PASSPHRASE - Encrypt the wallet file with PASSPHRASE", "Missing argument PASSPHRASE"}
+				 }
+			case "walletpassphrase":
+				if len(commands) > 2 {
+					timeout, err := strconv.Atoi(commands[2])
+					if err != nil || timeout <= 0 {
+						cmdErr = &usageError{"walletpassphrase PASSPHRASE TIMEOUT - Unlock the wallet file for TIMEOUT seconds", "Invalid TIMEOUT argument."}
+					} else {
+						cmdErr = cli.walletPassphrase(walletFile, commands[1], time.Duration(timeout)*time.Second)
+					}
+				 } else {
+				 	cmdErr = &usageError{"walletpassphrase PASSPHRASE TIMEOUT - Unlock the wallet file for TIMEOUT seconds", "Missing arguments"}
+				 }
+			case "walletlock":
+				cmdErr = cli.walletLock(walletFile)
+			case "walletpassphrasechange":
+				if len(commands) > 2 {
+					cmdErr = cli.walletPassphraseChange(walletFile, commands[1], commands[2])
+				 } else {
+				 	cmdErr = &usageError{"walletpassphrasechange OLD NEW - Change the wallet passphrase from OLD to NEW", "Missing arguments"}
+				 }
+			case "exportkey":
+				if len(commands) > 1 {
+					cmdErr = cli.exportKey(walletFile, commands[1])
+				 } else {
+				 	cmdErr = &usageError{"exportkey ADDRESS - Display the private key of ADDRESS in Base58Check", "Missing argument ADDRESS"}
+				 }
+			case "importkey":
+				if len(commands) > 1 {
+					cmdErr = cli.importKey(walletFile, commands[1])
+				 } else {
+				 	cmdErr = &usageError{"importkey KEY - Add a private key exported with exportkey to the wallet file", "Missing argument KEY"}
+				 }
+			case "importaddress":
+				if len(commands) > 1 {
+					cmdErr = cli.importAddress(walletFile, commands[1])
+				 } else {
+				 	cmdErr = &usageError{"importaddress ADDRESS - Watch ADDRESS without its private key", "Missing argument ADDRESS"}
+				 }
 			case "getbalance":
 				if len(commands) > 1 {
 					address := commands[1]
-					cli.getBalance(address, dbFile)
+					cmdErr = cli.getBalance(address, dbFile)
 				 } else {
-				 	fmt.Println("getbalance ADDRESS - Get balance of ADDRESS")
-				 	fmt.Println("Missing argument ADDRESS")
+				 	cmdErr = &usageError{"getbalance ADDRESS - Get balance of ADDRESS", "Missing argument ADDRESS"}
 				 }
 			case "printproblem":
 				if len(commands) > 1 {
 					hash := commands[1]
-					cli.printProblemGraph(dbFile, hash)
+					cmdErr = cli.printProblemGraph(dbFile, hash)
 				 } else {
-				 	fmt.Println("printproblem HASH - Display problem with hash HASH")
-				 	fmt.Println("Missing argument HASH")
+				 	cmdErr = &usageError{"printproblem HASH - Display problem with hash HASH", "Missing argument HASH"}
 				 }
 			case "printblock":
 				if len(commands) > 1 {
-					height,_ := strconv.Atoi(commands[1])
-					cli.printHeight(dbFile, height)
+					height, err := strconv.Atoi(commands[1])
+					if err != nil {
+						cmdErr = &usageError{"printblock HEIGHT - Display block number HEIGHT", "Invalid HEIGHT argument."}
+					} else {
+						cmdErr = cli.printHeight(dbFile, height)
+					}
 				 } else {
-				 	fmt.Println("printblock HEIGHT - Display block number HEIGHT")
-				 	fmt.Println("Missing argument HEIGHT")
+				 	cmdErr = &usageError{"printblock HEIGHT - Display block number HEIGHT", "Missing argument HEIGHT"}
 				 }
 
 			case "send":
 				if len(commands) > 3 {
 					sendFrom := commands[1]
 					sendTo   := commands[2]
-					sendAmount,_ := strconv.Atoi(commands[3])
+					sendAmount, err := strconv.Atoi(commands[3])
+					sendLockTime := int64(0)
+					if err == nil && len(commands) > 4 {
+						sendLockTime, err = strconv.ParseInt(commands[4], 10, 64)
+					}
+					if err != nil {
+						cmdErr = &usageError{"send FROM TO AMOUNT [LOCKTIME] - Send AMOUNT of coins from FROM address to TO. With LOCKTIME, TO can't spend them before that block height (or unix time if >= 500000000)", "Invalid arguments."}
+						break
+					}
 					sendMine := true
-					cli.send(sendFrom, sendTo, sendAmount, dbFile, walletFile, sendMine)
+					cmdErr = cli.send(sendFrom, sendTo, sendAmount, sendLockTime, dbFile, walletFile, sendMine)
 				 } else {
-				 	fmt.Println("send FROM TO AMOUNT - Send AMOUNT of coins from FROM address to TO.")
-				 	fmt.Println("Missing arguments")
+				 	cmdErr = &usageError{"send FROM TO AMOUNT [LOCKTIME] - Send AMOUNT of coins from FROM address to TO. With LOCKTIME, TO can't spend them before that block height (or unix time if >= 500000000)", "Missing arguments"}
 				 }
 				 
-			case "createblockchain":
+			case "sendmany":
+				if len(commands) > 2 {
+					strategy := ""
+					dryRun := false
+					for _, arg := range commands[3:] {
+						if arg == "-dryrun" {
+							dryRun = true
+						} else {
+							strategy = arg
+						}
+					}
+					cmdErr = cli.sendMany(commands[1], commands[2], strategy, dryRun, dbFile, walletFile, true)
+				 } else {
+				 	cmdErr = &usageError{"sendmany FROM CSVFILE [STRATEGY] [-dryrun] - Pay every ADDRESS,AMOUNT[,LOCKTIME] line of CSVFILE from FROM. STRATEGY is largest, bnb (no change) or random. -dryrun shows the transaction without sending it", "Missing arguments"}
+				 }
+			case "createrawtx":
+				if len(commands) > 3 {
+					amount, err := strconv.Atoi(commands[3])
+					lockTime := int64(0)
+					if err == nil && len(commands) > 4 {
+						lockTime, err = strconv.ParseInt(commands[4], 10, 64)
+					}
+					if err != nil {
+						cmdErr = &usageError{"createrawtx FROM TO AMOUNT [LOCKTIME] - Display an unsigned transaction to sign with signrawtx, without needing the keys of FROM", "Invalid arguments."}
+					} else {
+						cmdErr = cli.createRawTx(commands[1], commands[2], amount, lockTime, dbFile)
+					}
+				 } else {
+				 	cmdErr = &usageError{"createrawtx FROM TO AMOUNT [LOCKTIME] - Display an unsigned transaction to sign with signrawtx, without needing the keys of FROM", "Missing arguments"}
+				 }
+			case "signrawtx":
 				if len(commands) > 1 {
-					address := commands[1]
-					cli.createBlockchain(address, dbFile)
+					cmdErr = cli.signRawTx(walletFile, commands[1])
 				 } else {
-				 	fmt.Println("createblockchain ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-				 	fmt.Println("Missing argument ADDRESS")
+				 	cmdErr = &usageError{"signrawtx RAWTX - Sign RAWTX, given in hex or as a file name, with the keys of the wallet file. Multisig signers sign in turn", "Missing argument RAWTX"}
 				 }
-			case "startnode":
+			case "broadcastrawtx":
+				if len(commands) > 1 {
+					cmdErr = cli.broadcastRawTx(commands[1], dbFile, true)
+				 } else {
+				 	cmdErr = &usageError{"broadcastrawtx RAWTX - Send a completely signed RAWTX, given in hex or as a file name", "Missing argument RAWTX"}
+				 }
+			case "createblockchain":
 				if len(commands) > 1 {
 					address := commands[1]
-					cli.startNode(nodeID, dbFile, address)
+					params, err := config.NetworkParams()
+					if err != nil {
+						cmdErr = err
+						break
+					}
+					cmdErr = cli.createBlockchain(address, dbFile, params)
 				 } else {
-				 	fmt.Println("startnode ADDRESS - ")
-				 	fmt.Println("Missing argument ADDRESS")
+				 	cmdErr = &usageError{"createblockchain ADDRESS - Create a blockchain and send genesis block reward to ADDRESS", "Missing argument ADDRESS"}
 				 }
+			case "startnode":
+				args := commands[1:]
+				if len(args)%2 == 1 && !strings.HasPrefix(args[0], "-") {
+					config.MinerAddress, args = args[0], args[1:]
+				}
+				valid := len(args)%2 == 0
+				for i := 0; valid && i+1 < len(args); i += 2 {
+					switch args[i] {
+					case "-rpc":
+						config.RPCAddress = args[i+1]
+						if !strings.Contains(config.RPCAddress, ":") {
+							config.RPCAddress = "localhost:" + config.RPCAddress
+						}
+					case "-rpctoken":
+						config.RPCToken = args[i+1]
+					default:
+						valid = false
+					}
+				}
+				if !valid {
+				 	cmdErr = &usageError{"startnode [ADDRESS] [-rpc PORT] [-rpctoken TOKEN] - Start a node mining to ADDRESS, the configured miner by default. -rpc serves the JSON-RPC API on localhost:PORT, or on HOST:PORT", "Invalid arguments."}
+				} else if config.MinerAddress == "" {
+				 	cmdErr = &usageError{"startnode [ADDRESS] [-rpc PORT] [-rpctoken TOKEN] - Start a node mining to ADDRESS, the configured miner by default. -rpc serves the JSON-RPC API on localhost:PORT, or on HOST:PORT", "Missing argument ADDRESS"}
+				} else {
+					cmdErr = cli.startNode(config)
+				}
 			case "mineblock":
 				n := 1
 				if len(commands) == 2 {
 					m, err := strconv.Atoi(commands[1])
 					if err != nil {
-						fmt.Println("Invalid N argument.")
-						fmt.Println("  mineblock N- Mine N blocks with empty transactions. Default is 1")
+						cmdErr = &usageError{"mineblock N- Mine N blocks with empty transactions. Default is 1", "Invalid N argument."}
 					} else {
 						n = m
 					}
 				}
-				for i := 0; i < n; i++ {
-					block := cli.mineblock(dbFile)
-					bc := NewBlockchain(dbFile)
-					bc.AddBlock(block)
-					bc.db.Close()
+				for i := 0; i < n && cmdErr == nil; i++ {
+					var block *Block
+					block, cmdErr = cli.mineblock(dbFile)
+					if cmdErr == nil {
+						cmdErr = addBlock(block)
+					}
 				}
 			case "mineblockprob":
 				if len(commands) == 3 {
 					nodes, err1 := strconv.Atoi(commands[1])
 					density, err2 := strconv.ParseFloat(commands[2], 64)
 					if err1 != nil || err2 != nil {
-						fmt.Println("Invalid arguments.")
-						fmt.Println("  mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density")
+						cmdErr = &usageError{"mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density", "Invalid arguments."}
 					} else {
-						block :=  cli.mineblockWithNewProblem(dbFile, nodes, density)
-						bc := NewBlockchain(dbFile)
-						bc.AddBlock(block)
-						bc.db.Close()
+						var block *Block
+						block, cmdErr = cli.mineblockWithNewProblem(dbFile, nodes, density)
+						if cmdErr == nil {
+							cmdErr = addBlock(block)
+						}
 					}
 				} else {
-					fmt.Println("Invalid arguments.")
-					fmt.Println("  mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density")
+					cmdErr = &usageError{"mineblockprob NODES DENSITY- Mine 1 block with empty transactions and NODES nodes and DENSITY density", "Invalid arguments."}
 				}
 			case "mineblocksol":
 				if len(commands) > 1 {
 					pgHash := commands[1]
-					block := cli.mineblockWithSolution(dbFile, pgHash)
-					bc := NewBlockchain(dbFile)
-					bc.AddBlock(block)
-					bc.db.Close()
+					var block *Block
+					block, cmdErr = cli.mineblockWithSolution(dbFile, pgHash)
+					if cmdErr == nil {
+						cmdErr = addBlock(block)
+					}
 				 } else {
-				 	fmt.Println("mineblocksol HASH -  Mine 1 block with empty transactions and a solution to problem HASH")
-				 	fmt.Println("Missing argument HASH")
+				 	cmdErr = &usageError{"mineblocksol HASH -  Mine 1 block with empty transactions and a solution to problem HASH", "Missing argument HASH"}
 				 }
 			case "minepar":
 				n := 1
 				if len(commands) == 2 {
 					m, err := strconv.Atoi(commands[1])
 					if err != nil {
-						fmt.Println("Invalid N argument.")
-						fmt.Println("  minepar N- Mine N blocks with empty transactions. Default is 1. It tries to mine both with and without a solution (in parallel).")
+						cmdErr = &usageError{"minepar N- Mine N blocks with empty transactions. Default is 1. It tries to mine both with and without a solution (in parallel).", "Invalid N argument."}
 					} else {
 						n = m
 					}
 				}
-				for i := 0; i < n; i++ {
-					block := cli.mineblockParallel(dbFile)
-					bc := NewBlockchain(dbFile)
-					bc.AddBlock(block)
-					bc.db.Close()
+				for i := 0; i < n && cmdErr == nil; i++ {
+					var block *Block
+					block, cmdErr = cli.mineblockParallel(dbFile, config.CliqueSolver())
+					if cmdErr == nil {
+						cmdErr = addBlock(block)
+					}
 				}
 
 				// if len(commands) > 1 {
@@ -213,9 +629,33 @@ func (cli *CLI) Run() {
 				//  }
 				
 			default:
-				fmt.Println("Invalid option.")
-				cli.printUsage()
+				cmdErr = &usageError{"", "Invalid option."}
+
+		}
+	if cmdErr == nil && len(mined) > 0 {
+		cmdErr = cli.report(mined, func() {})
+	}
 
+	return cmdErr
+}
+
+// printError reports a failed command, pointing to walletpassphrase for a
+// locked wallet and to the usage of a command called wrongly
+func printError(w io.Writer, err error) {
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(w, usageErr.reason)
+		if usageErr.usage == "" {
+			(&CLI{}).printUsage(w)
+		} else {
+			fmt.Fprintln(w, "  "+usageErr.usage)
 		}
+		return
 	}
+	if errors.Is(err, ErrWalletLocked) {
+		fmt.Fprintln(w, "Wallet is locked, unlock it with walletpassphrase, or with -passphrase-file when running a single command")
+		return
+	}
+
+	fmt.Fprintln(w, "ERROR:", err)
 }
\ No newline at end of file
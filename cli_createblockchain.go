@@ -1,19 +1,24 @@
 package crickchain
 
 import (
+	"encoding/hex"
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) createBlockchain(address, dbFile string) {
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+func (cli *CLI) createBlockchain(address, dbFile string, params NetworkParams) error {
+	bc, err := CreateBlockchainWithParams(address, dbFile, params)
+	if err != nil {
+		return err
 	}
-	bc := CreateBlockchain(address, dbFile)
 	defer bc.db.Close()
 
 	UTXOSet := UTXOSet{bc}
-	UTXOSet.Reindex()
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
 
-	fmt.Println("Done!")
+	genesis := bc.Iterator().Next()
+	return cli.report(minedBlockJSON{hex.EncodeToString(genesis.Hash), genesis.Height}, func() {
+		fmt.Fprintln(cli.stdout(), "Done!")
+	})
 }
@@ -1,11 +1,26 @@
 package crickchain
 
 
-func (cli *CLI) createGraph(dbFile string, nodes int, edges int) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) createGraph(dbFile string, nodes int, edges int) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
-	pg := NewProblemGraph(nodes, edges)
-	pg.NicePrint(bc)
-	bc.AddProblemGraph(pg)
+	//the graph is the one the next block introduces with these sizes, it is
+	//stored once mineblockprob adds that block
+	pg, err := bc.NextProblemGraph(nodes, edges)
+	if err != nil {
+		return err
+	}
+
+	problem, err := newProblemJSON(pg, bc)
+	if err != nil {
+		return err
+	}
+
+	return cli.report(problem, func() {
+		pg.NicePrint(cli.stdout(), bc)
+	})
 }
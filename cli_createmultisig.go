@@ -0,0 +1,58 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// createMultisig stores an m-of-n multisig address. Keys are either addresses
+// held in the wallet file or hex encoded public keys.
+func (cli *CLI) createMultisig(walletFile string, m int, keys []string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+
+	var pubKeys [][]byte
+	for _, key := range keys {
+		if wallet, ok := wallets.Wallets[key]; ok {
+			pubKeys = append(pubKeys, wallet.PublicKey)
+			continue
+		}
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("key %s is neither a wallet address nor a hex public key", key)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	address, err := wallets.AddMultisig(m, pubKeys)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(addressJSON{Address: address}, func() {
+		fmt.Fprintf(cli.stdout(), "Your new %d-of-%d multisig address: %s\n", m, len(pubKeys), address)
+	})
+}
+
+func (cli *CLI) getPubKey(walletFile, address string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	wallet, ok := wallets.Wallets[address]
+	if !ok {
+		return fmt.Errorf("address %s is not in the wallet file", address)
+	}
+
+	return cli.report(struct {
+		Address   string `json:"address"`
+		PublicKey string `json:"publicKey"`
+	}{address, hex.EncodeToString(wallet.PublicKey)}, func() {
+		fmt.Fprintf(cli.stdout(), "%x\n", wallet.PublicKey)
+	})
+}
@@ -4,20 +4,40 @@ import (
 	"fmt"
 )
 
-func (cli *CLI) createWallet(dbFile string) {
-	wallets, _ := NewWallets(dbFile)
-	address := wallets.CreateWallet()
-	wallets.SaveToFile(dbFile)
+func (cli *CLI) createWallet(dbFile string) error {
+	wallets, err := cli.loadWallets(dbFile)
+	if err != nil {
+		return err
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(dbFile); err != nil {
+		return err
+	}
 
-	fmt.Printf("Your new address: %s\n", address)
+	return cli.report(addressJSON{Address: address}, func() {
+		fmt.Fprintf(cli.stdout(), "Your new address: %s\n", address)
+	})
 }
 
 
-func (cli *CLI) quickstart(dbFile, walletFile string) {
-	wallets, _ := NewWallets(walletFile)
-	address := wallets.CreateWallet()
-	wallets.SaveToFile(walletFile)
+func (cli *CLI) quickstart(dbFile, walletFile string, params NetworkParams) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
 
-	fmt.Printf("Your new address: %s\n", address)
-	cli.createBlockchain(address, dbFile)
+	if !cli.JSON {
+		fmt.Fprintf(cli.stdout(), "Your new address: %s\n", address)
+	}
+	return cli.createBlockchain(address, dbFile, params)
 }
@@ -2,29 +2,45 @@ package crickchain
 
 import (
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) getAllBalances(dbFile, walletFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) getAllBalances(dbFile, walletFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	wallets, err := NewWallets(walletFile)
+	wallets, err := cli.loadWallets(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	addresses := wallets.GetAddresses()
 
+	balances := []balanceJSON{}
 	for _, address := range addresses {
 		balance := 0
 		pubKeyHash := Base58Decode([]byte(address))
 		pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-		UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+		UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+		if err != nil {
+			return err
+		}
 
 		for _, out := range UTXOs {
 			balance += out.Value
 		}
-		fmt.Printf("Balance of '%s': %d\n", address, balance)
+		balances = append(balances, balanceJSON{address, balance, wallets.Labels[address], wallets.IsWatchOnly(address)})
 	}
+
+	return cli.report(balances, func() {
+		for _, b := range balances {
+			if b.WatchOnly {
+				fmt.Fprintf(cli.stdout(), "Balance of '%s' (watch-only): %d\n", b.Address, b.Balance)
+			} else {
+				fmt.Fprintf(cli.stdout(), "Balance of '%s': %d\n", b.Address, b.Balance)
+			}
+		}
+	})
 }
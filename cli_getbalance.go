@@ -2,25 +2,32 @@ package crickchain
 
 import (
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) getBalance(address, dbFile string) {
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+func (cli *CLI) getBalance(address, dbFile string) error {
+	if err := checkAddress(address); err != nil {
+		return err
+	}
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
 	}
-	bc := NewBlockchain(dbFile)
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
 	balance := 0
 	pubKeyHash := Base58Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+	if err != nil {
+		return err
+	}
 
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
 
-	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	return cli.report(balanceJSON{Address: address, Balance: balance}, func() {
+		fmt.Fprintf(cli.stdout(), "Balance of '%s': %d\n", address, balance)
+	})
 }
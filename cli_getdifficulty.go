@@ -4,15 +4,20 @@ import (
 	"fmt"
 )
 
-func (cli *CLI) getDifficulty(dbFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) getDifficulty(dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
-	target := bc.CurrentTarget(false)
-	diff := targetToDifficulty(target)
-	rTarget := bc.CurrentTarget(true)
-	rDiff := targetToDifficulty(rTarget)
-	fmt.Printf("Normal  Target: %064x\r\n", target)
-	fmt.Printf("Reduced Target: %064x\r\n", rTarget)
-	fmt.Printf("Normal  Difficulty: %d\r\n", diff)	
-	fmt.Printf("Reduced Difficulty: %d\r\n", rDiff)
+	difficulty, err := newDifficultyJSON(bc)
+	if err != nil {
+		return err
+	}
+	return cli.report(difficulty, func() {
+		fmt.Fprintf(cli.stdout(), "Normal  Target: %s\r\n", difficulty.Target)
+		fmt.Fprintf(cli.stdout(), "Reduced Target: %s\r\n", difficulty.ReducedTarget)
+		fmt.Fprintf(cli.stdout(), "Normal  Difficulty: %s\r\n", difficulty.Difficulty)	
+		fmt.Fprintf(cli.stdout(), "Reduced Difficulty: %s\r\n", difficulty.ReducedDifficulty)
+	})
 }
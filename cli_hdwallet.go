@@ -0,0 +1,85 @@
+package crickchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func (cli *CLI) createHDWallet(walletFile string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SetHDWallet(mnemonic); err != nil {
+		return err
+	}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(struct {
+		Mnemonic string `json:"mnemonic"`
+		Address  string `json:"address"`
+	}{mnemonic, address}, func() {
+		fmt.Fprintln(cli.stdout(), "Write down your recovery phrase, it restores every address of this wallet:")
+		fmt.Fprintf(cli.stdout(), "\n  %s\n\n", mnemonic)
+		fmt.Fprintf(cli.stdout(), "Your new address: %s\n", address)
+	})
+}
+
+func (cli *CLI) restoreHDWallet(walletFile, dbFile string, words []string, gapLimit int) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SetHDWallet(strings.Join(words, " ")); err != nil {
+		return err
+	}
+
+	return cli.scanHDAddresses(wallets, walletFile, dbFile, gapLimit)
+}
+
+func (cli *CLI) scanHDWallet(walletFile, dbFile string, gapLimit int) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if wallets.HD == nil {
+		return errors.New("wallet has no HD seed, create one with createhdwallet or restorehdwallet")
+	}
+
+	return cli.scanHDAddresses(wallets, walletFile, dbFile, gapLimit)
+}
+
+func (cli *CLI) scanHDAddresses(wallets *Wallets, walletFile, dbFile string, gapLimit int) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	found, err := wallets.ScanHDAddresses(&UTXOSet, gapLimit)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(append([]string{}, found...), func() {
+		fmt.Fprintf(cli.stdout(), "Found %d used addresses (gap limit %d):\n", len(found), gapLimit)
+		for _, address := range found {
+			fmt.Fprintln(cli.stdout(), address)
+		}
+	})
+}
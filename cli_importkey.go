@@ -0,0 +1,58 @@
+package crickchain
+
+import (
+	"fmt"
+)
+
+func (cli *CLI) exportKey(walletFile, address string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	key, err := wallets.ExportKey(address)
+	if err != nil {
+		return err
+	}
+
+	return cli.report(struct {
+		Address string `json:"address"`
+		Key     string `json:"key"`
+	}{address, key}, func() {
+		fmt.Fprintln(cli.stdout(), key)
+	})
+}
+
+func (cli *CLI) importKey(walletFile, key string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	address, err := wallets.ImportKey(key)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(addressJSON{Address: address}, func() {
+		fmt.Fprintf(cli.stdout(), "Imported address: %s\n", address)
+	})
+}
+
+func (cli *CLI) importAddress(walletFile, address string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := wallets.AddWatchOnly(address); err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(addressJSON{Address: address, WatchOnly: true}, func() {
+		fmt.Fprintf(cli.stdout(), "Watching address: %s\n", address)
+	})
+}
@@ -0,0 +1,243 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// report prints the result of a command, as v encoded in JSON in JSON mode
+// and with text otherwise
+func (cli *CLI) report(v interface{}, text func()) error {
+	if !cli.JSON {
+		text()
+		return nil
+	}
+
+	encoder := json.NewEncoder(cli.stdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// stdout returns where command results are printed, cli.Out or os.Stdout
+func (cli *CLI) stdout() io.Writer {
+	if cli.Out != nil {
+		return cli.Out
+	}
+
+	return os.Stdout
+}
+
+// messages returns where progress messages are printed. In JSON mode they
+// go to stderr, so that the result is the only output.
+func (cli *CLI) messages() io.Writer {
+	if cli.JSON {
+		return os.Stderr
+	}
+
+	return cli.stdout()
+}
+
+type blockJSON struct {
+	Hash          string `json:"hash"`
+	PrevBlockHash string `json:"prevBlockHash"`
+	Height        int    `json:"height"`
+	Timestamp     int64  `json:"timestamp"`
+	Nonce         int    `json:"nonce"`
+	Target        string `json:"target"`
+	Difficulty    string `json:"difficulty"`
+	// NormalDifficulty and ReducedDifficulty are required at the height of
+	// the block without and with a valid solution
+	NormalDifficulty  string            `json:"normalDifficulty,omitempty"`
+	ReducedDifficulty string            `json:"reducedDifficulty,omitempty"`
+	Valid             bool              `json:"valid"`
+	SolutionHash      string            `json:"solutionHash,omitempty"`
+	Solution          []int             `json:"solution,omitempty"`
+	ValidSolution     bool              `json:"validSolution"`
+	ProblemHash       string            `json:"problemHash,omitempty"`
+	ProblemParams     *ProblemParams    `json:"problemParams,omitempty"`
+	Transactions      []transactionJSON `json:"transactions"`
+}
+
+func newBlockJSON(b *Block, bc *Blockchain) blockJSON {
+	result := blockJSON{
+		Hash:          hex.EncodeToString(b.Hash),
+		PrevBlockHash: hex.EncodeToString(b.PrevBlockHash),
+		Height:        b.Height,
+		Timestamp:     b.Timestamp,
+		Nonce:         b.Nonce,
+		Target:        fmt.Sprintf("%064x", b.Target),
+		Difficulty:    targetToDifficulty(b.Target).String(),
+		Valid:         b.Validate(bc),
+		SolutionHash:  hex.EncodeToString(b.SolutionHash),
+		Solution:      b.Solution,
+		ProblemHash:   hex.EncodeToString(b.ProblemGraphHash),
+		ProblemParams: b.Problem,
+		Transactions:  []transactionJSON{},
+	}
+	if len(b.SolutionHash) > 0 {
+		result.ValidSolution = b.HasValidSolution(bc)
+	}
+	if target, err := bc.CalculateTarget(b.Height, false); err == nil {
+		result.NormalDifficulty = targetToDifficulty(target).String()
+	}
+	if target, err := bc.CalculateTarget(b.Height, true); err == nil {
+		result.ReducedDifficulty = targetToDifficulty(target).String()
+	}
+	for _, tx := range b.Transactions {
+		result.Transactions = append(result.Transactions, newTransactionJSON(tx))
+	}
+
+	return result
+}
+
+type transactionJSON struct {
+	ID       string       `json:"id"`
+	Version  int          `json:"version"`
+	LockTime int64        `json:"lockTime,omitempty"`
+	Coinbase bool         `json:"coinbase,omitempty"`
+	Inputs   []inputJSON  `json:"inputs"`
+	Outputs  []outputJSON `json:"outputs"`
+}
+
+type inputJSON struct {
+	TxID      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	Sequence  uint32 `json:"sequence"`
+	ScriptSig string `json:"scriptSig"`
+}
+
+type outputJSON struct {
+	Value   int    `json:"value"`
+	Address string `json:"address,omitempty"`
+	Script  string `json:"script"`
+}
+
+func newTransactionJSON(tx *Transaction) transactionJSON {
+	result := transactionJSON{
+		ID:       hex.EncodeToString(tx.ID),
+		Version:  tx.Version,
+		LockTime: tx.LockTime,
+		Coinbase: tx.IsCoinbase(),
+		Inputs:   []inputJSON{},
+		Outputs:  []outputJSON{},
+	}
+	for _, vin := range tx.Vin {
+		result.Inputs = append(result.Inputs, inputJSON{
+			TxID:      hex.EncodeToString(vin.Txid),
+			Vout:      vin.Vout,
+			Sequence:  vin.Sequence,
+			ScriptSig: hex.EncodeToString(vin.ScriptSig),
+		})
+	}
+	for _, vout := range tx.Vout {
+		result.Outputs = append(result.Outputs, outputJSON{
+			Value:   vout.Value,
+			Address: outputAddress(vout),
+			Script:  DisasmScript(vout.ScriptPubKey),
+		})
+	}
+
+	return result
+}
+
+type problemJSON struct {
+	Hash         string  `json:"hash"`
+	Nodes        int     `json:"nodes"`
+	Edges        int     `json:"edges"`
+	Seed         string  `json:"seed,omitempty"`
+	Connected    bool    `json:"connected"`
+	BestSolution []int   `json:"bestSolution"`
+	Solutions    [][]int `json:"solutions"`
+}
+
+func newProblemJSON(pg *ProblemGraph, bc *Blockchain) (problemJSON, error) {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return problemJSON{}, err
+	}
+	best, err := bc.GetBestSolution(pg, height)
+	if err != nil {
+		return problemJSON{}, err
+	}
+	solutions, err := bc.GetAllSolutions(pg)
+	if err != nil {
+		return problemJSON{}, err
+	}
+
+	return problemJSON{
+		Hash:         hex.EncodeToString(pg.Hash),
+		Nodes:        pg.Graph.Order(),
+		Edges:        pg.Graph.Size(),
+		Seed:         hex.EncodeToString(pg.Seed),
+		Connected:    pg.Graph.IsConnected(),
+		BestSolution: best,
+		Solutions:    solutions,
+	}, nil
+}
+
+type difficultyJSON struct {
+	Target            string `json:"target"`
+	ReducedTarget     string `json:"reducedTarget"`
+	Difficulty        string `json:"difficulty"`
+	ReducedDifficulty string `json:"reducedDifficulty"`
+}
+
+// newDifficultyJSON returns the targets of the next block, without and with a
+// solution
+func newDifficultyJSON(bc *Blockchain) (difficultyJSON, error) {
+	target, err := bc.CurrentTarget(false)
+	if err != nil {
+		return difficultyJSON{}, err
+	}
+	reducedTarget, err := bc.CurrentTarget(true)
+	if err != nil {
+		return difficultyJSON{}, err
+	}
+
+	return difficultyJSON{
+		Target:            fmt.Sprintf("%064x", target),
+		ReducedTarget:     fmt.Sprintf("%064x", reducedTarget),
+		Difficulty:        targetToDifficulty(target).String(),
+		ReducedDifficulty: targetToDifficulty(reducedTarget).String(),
+	}, nil
+}
+
+type balanceJSON struct {
+	Address   string `json:"address"`
+	Balance   int    `json:"balance"`
+	Label     string `json:"label,omitempty"`
+	WatchOnly bool   `json:"watchOnly,omitempty"`
+}
+
+type addressJSON struct {
+	Address   string `json:"address"`
+	Label     string `json:"label,omitempty"`
+	WatchOnly bool   `json:"watchOnly,omitempty"`
+}
+
+type txIDJSON struct {
+	TxID string `json:"txid"`
+}
+
+type rawTxJSON struct {
+	Hex      string `json:"hex"`
+	Added    int    `json:"added"`
+	Complete bool   `json:"complete"`
+}
+
+type minedBlockJSON struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+}
+
+// reportMessage prints the result of commands that only tell what they did
+func (cli *CLI) reportMessage(message string) error {
+	return cli.report(struct {
+		Message string `json:"message"`
+	}{message}, func() {
+		fmt.Fprintln(cli.stdout(), message)
+	})
+}
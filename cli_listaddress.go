@@ -2,17 +2,28 @@ package crickchain
 
 import (
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) listAddresses(dbFile string) {
-	wallets, err := NewWallets(dbFile)
+func (cli *CLI) listAddresses(walletFile string) error {
+	wallets, err := cli.loadWallets(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	addresses := wallets.GetAddresses()
-
-	for _, address := range addresses {
-		fmt.Println(address)
+	addresses := []addressJSON{}
+	for _, address := range wallets.GetAddresses() {
+		addresses = append(addresses, addressJSON{address, wallets.Labels[address], wallets.IsWatchOnly(address)})
 	}
+
+	return cli.report(addresses, func() {
+		for _, address := range addresses {
+			line := address.Address
+			if address.Label != "" {
+				line += " " + address.Label
+			}
+			if address.WatchOnly {
+				line += " (watch-only)"
+			}
+			fmt.Fprintln(cli.stdout(), line)
+		}
+	})
 }
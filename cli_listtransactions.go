@@ -0,0 +1,104 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (cli *CLI) listTransactions(dbFile, walletFile string, filter HistoryFilter) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	defer bc.db.Close()
+
+	history, err := wallets.History(bc, filter)
+	if err != nil {
+		return err
+	}
+	// the updated history is saved, so that the next listing only reads the
+	// new blocks
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+	entries := []walletTxJSON{}
+	for _, entry := range history {
+		entries = append(entries, walletTxJSON{
+			TxID:          hex.EncodeToString(entry.TxID),
+			BlockHash:     hex.EncodeToString(entry.BlockHash),
+			Height:        entry.Height,
+			Timestamp:     entry.Timestamp,
+			Confirmations: entry.Confirmations,
+			Category:      entry.Category,
+			Amount:        entry.Amount,
+			Addresses:     entry.Addresses,
+			Label:         entry.Label,
+		})
+	}
+
+	return cli.report(entries, func() {
+		if len(history) == 0 {
+			fmt.Fprintln(cli.stdout(), "No transactions")
+		}
+		for _, entry := range history {
+			fmt.Fprintf(cli.stdout(), "%x  %-8s  %+d\n", entry.TxID, entry.Category, entry.Amount)
+			fmt.Fprintf(cli.stdout(), "    block %d, %d confirmations, %s\n", entry.Height, entry.Confirmations, time.Unix(entry.Timestamp, 0).Format(time.RFC3339))
+			fmt.Fprintf(cli.stdout(), "    %s\n", strings.Join(entry.Addresses, ", "))
+			if entry.Label != "" {
+				fmt.Fprintf(cli.stdout(), "    label: %s\n", entry.Label)
+			}
+		}
+	})
+}
+
+type walletTxJSON struct {
+	TxID          string   `json:"txid"`
+	BlockHash     string   `json:"blockHash"`
+	Height        int      `json:"height"`
+	Timestamp     int64    `json:"timestamp"`
+	Confirmations int      `json:"confirmations"`
+	Category      string   `json:"category"`
+	Amount        int      `json:"amount"`
+	Addresses     []string `json:"addresses"`
+	Label         string   `json:"label,omitempty"`
+}
+
+func (cli *CLI) setLabel(walletFile, address, label string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SetLabel(address, label); err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(addressJSON{Address: address, Label: label}, func() {})
+}
+
+func (cli *CLI) setTxLabel(walletFile, txID, label string) error {
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SetTxLabel(txID, label); err != nil {
+		return err
+	}
+	if err := wallets.SaveToFile(walletFile); err != nil {
+		return err
+	}
+
+	return cli.report(struct {
+		TxID  string `json:"txid"`
+		Label string `json:"label,omitempty"`
+	}{txID, label}, func() {})
+}
@@ -1,30 +1,47 @@
 package crickchain
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"encoding/hex"
-	"log"
 )
 
-func (cli *CLI) mineblock(dbFile string) *Block {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) mineblock(dbFile string) (*Block, error) {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return nil, err
+	}
 	defer bc.db.Close()
 	var txs []*Transaction
 	
-	newBlock := bc.MineBlock(txs, []byte{}, []int{}, []byte{})
-	fmt.Println("Block mined classically")
-	fmt.Printf("New block hash: %x\r\n", newBlock.Hash)
-	return newBlock
+	newBlock, err := bc.MineBlock(txs, []byte{}, []int{}, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(cli.messages(), "Block mined classically")
+	fmt.Fprintf(cli.messages(), "New block hash: %x\r\n", newBlock.Hash)
+	return newBlock, nil
 }
 
-func (cli *CLI) mineblockWithNewProblem(dbFile string, nodes int, density float64) *Block {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) mineblockWithNewProblem(dbFile string, nodes int, density float64) (*Block, error) {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return nil, err
+	}
 	defer bc.db.Close()
 
 	kclique := []int{}
 	edges := int(float64(nodes*(nodes-1)/2) * density)
-	pg := NewProblemGraph(nodes, edges)
-	bc.AddProblemGraph(pg)
+	if err := bc.Params().Problems.CheckSize(nodes, edges); err != nil {
+		return nil, err
+	}
+	//the graph is generated from the seed of the tip, so that others can
+	//regenerate it from the parameters of the block
+	pg, err := bc.NextProblemGraph(nodes, edges)
+	if err != nil {
+		return nil, err
+	}
 	//we mine the problem with an initial solution
 	for k := 8; k >= 3; k-- {
 		kclique = pg.FindKClique(k)
@@ -34,48 +51,68 @@ func (cli *CLI) mineblockWithNewProblem(dbFile string, nodes int, density float6
 	}
 	
 	var txs []*Transaction
-	newBlock := bc.MineBlock(txs, pg.Hash, kclique, pg.Hash)
+	newBlock, err := bc.MineProblemBlock(txs, pg, kclique)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("Block mined with problem")
-	fmt.Printf("New block hash: %x\r\n", newBlock.Hash)
-	return newBlock
+	fmt.Fprintln(cli.messages(), "Block mined with problem")
+	fmt.Fprintf(cli.messages(), "New block hash: %x\r\n", newBlock.Hash)
+	return newBlock, nil
 }
 
-func (cli *CLI) mineblockWithSolution(dbFile string, pgHash string) *Block {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) mineblockWithSolution(dbFile string, pgHash string) (*Block, error) {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return nil, err
+	}
 	defer bc.db.Close()
 	
 	hash, err := hex.DecodeString(pgHash)
 	if err != nil {
-		fmt.Println("Invalid problem hash")
-		log.Panic(err)
+		return nil, fmt.Errorf("invalid problem hash %s", pgHash)
 	}
 	pg, err := bc.GetProblemGraphFromHash(hash)
 	if err != nil {
-		fmt.Println("Invalid problem hash")
-		log.Panic(err)
+		return nil, err
 	}
 
-	height := bc.GetBestHeight()
-	bestSolution := bc.GetBestSolution(&pg, height)
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	bestSolution, err := bc.GetBestSolution(&pg, height)
+	if err != nil {
+		return nil, err
+	}
 	kclique := pg.FindKClique(len(bestSolution) + 1)
 
 	var txs []*Transaction
 
-	newBlock := bc.MineBlock(txs, hash, kclique, []byte{})
-	fmt.Println("Block mined with solution")
-	fmt.Printf("New block hash: %x\r\n", newBlock.Hash)
-	return newBlock
+	newBlock, err := bc.MineBlock(txs, hash, kclique, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(cli.messages(), "Block mined with solution")
+	fmt.Fprintf(cli.messages(), "New block hash: %x\r\n", newBlock.Hash)
+	return newBlock, nil
 }
 
-func (cli *CLI) mineblockParallel(dbFile string) *Block {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) mineblockParallel(dbFile string, solver CliqueSolver) (*Block, error) {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return nil, err
+	}
 	defer bc.db.Close()
 	var txs []*Transaction
-	height := bc.GetBestHeight()
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	//only the graphs introduced on the chain lower the target of a solution
 	hashes := bc.GetProblemGraphHashes()
 	if !(len(hashes) > 0) {
-		log.Panic("No Problem to mine solution for. Create one first")
+		return nil, errors.New("no problem to mine a solution for, create one first")
 	}
 	var bestPG *ProblemGraph
 	var bestSol []int
@@ -84,13 +121,15 @@ func (cli *CLI) mineblockParallel(dbFile string) *Block {
 	for _, h := range hashes {
 		pg, err := bc.GetProblemGraphFromHash(h)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 		//evaluate expected difficulty for solution
-		sol := bc.GetBestSolution(&pg, height)
+		sol, err := bc.GetBestSolution(&pg, height)
+		if err != nil {
+			return nil, err
+		}
 		expected := float64(pg.Graph.Order() -1) * pg.Graph.Density()
 		ratio := float64(len(sol))/expected
-		fmt.Println(ratio)
 		if ratio < bestRatio {
 			bestRatio = ratio
 			bestPG = &pg
@@ -121,8 +160,30 @@ func (cli *CLI) mineblockParallel(dbFile string) *Block {
 	// 		return block
 	// }
 
-	kclique := bestPG.FindKClique(len(bestSol) + 1)
-	newBlock := bc.MineBlock(txs, solHash, kclique, []byte{})
-	fmt.Printf("Block mined with solution to %x\n", solHash)
-	return newBlock
+	//graphs without edges have no ratio
+	if bestPG == nil {
+		return nil, errors.New("no problem graph of the chain has a solution to improve")
+	}
+	fmt.Fprintf(cli.messages(), "Solving problem %x, best solution %d nodes, %.2f of the expected clique size\n", solHash, len(bestSol), bestRatio)
+	kclique, err := solver.FindKClique(context.Background(), bestPG, len(bestSol) + 1)
+	if err != nil {
+		return nil, err
+	}
+	newBlock, err := bc.MineBlock(txs, solHash, kclique, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(cli.messages(), "Block mined with solution to %x\n", solHash)
+	return newBlock, nil
+}
+
+// addBlock adds a block mined by the CLI to the blockchain
+func (cli *CLI) addBlock(dbFile string, block *Block) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	defer bc.db.Close()
+
+	return bc.AddBlock(block)
 }
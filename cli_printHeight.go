@@ -1,13 +1,20 @@
 package crickchain
 
 
-func (cli *CLI) printHeight(dbFile string, height int) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) printHeight(dbFile string, height int) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
-	block, _ := bc.GetBlockFromHeight(height)
-	block.NicePrint(bc)
-
+	block, err := bc.GetBlockFromHeight(height)
+	if err != nil {
+		return err
+	}
+	return cli.report(newBlockJSON(&block, bc), func() {
+		block.NicePrint(cli.stdout(), bc)
+	})
 }
 
 
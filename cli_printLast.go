@@ -1,14 +1,18 @@
 package crickchain
 
 
-func (cli *CLI) printLast(dbFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) printLast(dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
 	bci := bc.Iterator()
 	block := bci.Next()
-	block.NicePrint(bc)
-
+	return cli.report(newBlockJSON(block, bc), func() {
+		block.NicePrint(cli.stdout(), bc)
+	})
 }
 
 
@@ -1,17 +1,36 @@
 package crickchain
 
 
-func (cli *CLI) printChain(dbFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) printChain(dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
 	bci := bc.Iterator()
+	if !cli.JSON {
+		for {
+			block := bci.Next()
+			block.NicePrint(cli.stdout(), bc)
+
+			if len(block.PrevBlockHash) == 0 {
+				break
+			}
+		}
+
+		return nil
+	}
+
+	blocks := []blockJSON{}
 	for {
 		block := bci.Next()
-		block.NicePrint(bc)
+		blocks = append(blocks, newBlockJSON(block, bc))
 
 		if len(block.PrevBlockHash) == 0 {
 			break
 		}
 	}
+
+	return cli.report(blocks, nil)
 }
@@ -5,51 +5,86 @@ import (
 	"encoding/hex"
 )
 
-func (cli *CLI) printProblemGraphs(dbFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) printProblemGraphs(dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
 	hashes := bc.GetProblemGraphHashes()
 
+	if cli.JSON {
+		problems := []problemJSON{}
+		for _, h := range hashes {
+			pg, err := bc.GetProblemGraphFromHash(h)
+			if err != nil {
+				return err
+			}
+			problem, err := newProblemJSON(&pg, bc)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, problem)
+		}
+
+		return cli.report(problems, nil)
+	}
+
 	for i, h := range hashes {
 		pg, err := bc.GetProblemGraphFromHash(h)
 		if err == nil {
-			fmt.Println("Problem ", i)
-			pg.NicePrint(bc)			
+			fmt.Fprintln(cli.stdout(), "Problem ", i)
+			pg.NicePrint(cli.stdout(), bc)			
 		} else {
-			fmt.Println(err)
+			fmt.Fprintln(cli.stdout(), err)
 		}
 	}	
+
+	return nil
 }
 
-func (cli *CLI) printProblemGraph(dbFile string, hash string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) printProblemGraph(dbFile string, hash string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 
 	h, err := hex.DecodeString(hash)
 	if err != nil {
-	    panic(err)
+		return fmt.Errorf("invalid problem hash %s", hash)
 	}
 	pg, err := bc.GetProblemGraphFromHash(h)
-	if err == nil {
-		pg.NicePrint(bc)
-		text := ProblemToString(pg)
-		dbFile := "jsgraph/data/graph.js"
-		WriteToFile(dbFile, text)
-		textsol := "var cliques = ["
-
-		allSolutions := bc.GetAllSolutions(&pg)
-		for i, s := range allSolutions {
-			textsol += CliqueToString(s)
-			if i < len(allSolutions) - 1{
-				textsol += ",\n "
-			}
-		}
+	if err != nil {
+		return err
+	}
+	problem, err := newProblemJSON(&pg, bc)
+	if err != nil {
+		return err
+	}
+	if err := cli.report(problem, func() { pg.NicePrint(cli.stdout(), bc) }); err != nil {
+		return err
+	}
+	text := ProblemToString(pg)
+	graphFile := "jsgraph/data/graph.js"
+	if err := WriteToFile(graphFile, text); err != nil {
+		return err
+	}
+	textsol := "var cliques = ["
 
-		textsol += "];\n"
-		dbFilesol := "jsgraph/data/sol.js"
-		WriteToFile(dbFilesol, textsol)
-	} else {
-		fmt.Println(err)
+	allSolutions, err := bc.GetAllSolutions(&pg)
+	if err != nil {
+		return err
 	}
+	for i, s := range allSolutions {
+		textsol += CliqueToString(s)
+		if i < len(allSolutions) - 1{
+			textsol += ",\n "
+		}
+	}
+
+	textsol += "];\n"
+	dbFilesol := "jsgraph/data/sol.js"
+	return WriteToFile(dbFilesol, textsol)
 }	
\ No newline at end of file
@@ -0,0 +1,114 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func (cli *CLI) createRawTx(from, to string, amount int, lockTime int64, dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	plan, err := UTXOSet.PlanPayments(from, []Payment{{to, amount, lockTime}}, DefaultCoinSelector)
+	if err != nil {
+		return err
+	}
+	raw, err := NewRawTransaction(plan, &UTXOSet)
+	if err != nil {
+		return err
+	}
+
+	return cli.report(rawTxJSON{Hex: raw.Encode()}, func() {
+		fmt.Fprintln(cli.stdout(), raw.Encode())
+	})
+}
+
+func (cli *CLI) signRawTx(walletFile, encoded string) error {
+	raw, err := readRawTransaction(encoded)
+	if err != nil {
+		return err
+	}
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+
+	printRawTransaction(cli.messages(), raw)
+	added, err := wallets.SignRawTransaction(raw)
+	if err != nil {
+		return err
+	}
+
+	return cli.report(rawTxJSON{raw.Encode(), added, raw.IsComplete()}, func() {
+		fmt.Fprintf(cli.stdout(), "Added %d signatures, complete: %t\n", added, raw.IsComplete())
+		fmt.Fprintln(cli.stdout(), raw.Encode())
+	})
+}
+
+func (cli *CLI) broadcastRawTx(encoded, dbFile string, mineNow bool) error {
+	raw, err := readRawTransaction(encoded)
+	if err != nil {
+		return err
+	}
+	if !raw.IsComplete() {
+		return errors.New("transaction is not completely signed")
+	}
+
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	tx := raw.Tx
+	if !bc.VerifyTransaction(&tx) {
+		return errors.New("transaction does not spend the outputs it claims")
+	}
+	if err := bc.CheckTransactionLocksAtTip(&tx); err != nil {
+		return err
+	}
+	err = cli.commitTransaction(&UTXOSet, &tx, outputAddress(TXOutput{0, raw.Prevouts[0].ScriptPubKey}), mineNow)
+	if err != nil {
+		return err
+	}
+
+	return cli.report(txIDJSON{hex.EncodeToString(tx.ID)}, func() {
+		fmt.Fprintf(cli.stdout(), "Success! Transaction %x\n", tx.ID)
+	})
+}
+
+// readRawTransaction decodes a raw transaction given inline or as the name of a file holding it
+func readRawTransaction(arg string) (*RawTransaction, error) {
+	if _, err := os.Stat(arg); err == nil {
+		content, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		arg = string(content)
+	}
+
+	return DecodeRawTransaction(strings.TrimSpace(arg))
+}
+
+func printRawTransaction(w io.Writer, raw *RawTransaction) {
+	out := 0
+
+	fmt.Fprintf(w, "Transaction %x spends %d, unverified, from %d inputs\n", raw.Tx.ID, raw.InputValue(), len(raw.Tx.Vin))
+	for _, vout := range raw.Tx.Vout {
+		fmt.Fprintf(w, "  pays %d to %s\n", vout.Value, outputAddress(vout))
+		out += vout.Value
+	}
+	// the signatures don't commit to the values of the prevouts, which
+	// only the blockchain can confirm
+	fmt.Fprintf(w, "  fee %d, unverified: it relies on the prevout values of the raw transaction\n", raw.InputValue()-out)
+}
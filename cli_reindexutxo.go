@@ -2,13 +2,25 @@ package crickchain
 
 import "fmt"
 
-func (cli *CLI) reindexUTXO(dbFile string) {
-	bc := NewBlockchain(dbFile)
+func (cli *CLI) reindexUTXO(dbFile string) error {
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	defer bc.db.Close()
 	
 	UTXOSet := UTXOSet{bc}
-	UTXOSet.Reindex()
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
 
-	count := UTXOSet.CountTransactions()
-	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
+	return cli.report(struct {
+		Transactions int `json:"transactions"`
+	}{count}, func() {
+		fmt.Fprintf(cli.stdout(), "Done! There are %d transactions in the UTXO set.\n", count)
+	})
 }
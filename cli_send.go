@@ -1,39 +1,77 @@
 package crickchain
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) send(from, to string, amount int, dbFile string, walletFile string, mineNow bool) {
-	if !ValidateAddress(from) {
-		log.Panic("ERROR: Sender address is not valid")
+func (cli *CLI) send(from, to string, amount int, lockTime int64, dbFile string, walletFile string, mineNow bool) error {
+	if err := checkAddress(from); err != nil {
+		return err
 	}
-	if !ValidateAddress(to) {
-		log.Panic("ERROR: Recipient address is not valid")
+	if err := checkAddress(to); err != nil {
+		return err
+	}
+	if lockTime > 0 && IsScriptAddress(to) {
+		return errors.New("timelocked payments need a pubkey hash recipient")
 	}
 
-	bc := NewBlockchain(dbFile)
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	wallets, err := NewWallets(walletFile)
+	wallets, err := cli.loadWallets(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	wallet := wallets.GetWallet(from)
 
-	tx := NewUTXOTransaction(&wallet, to, amount, &UTXOSet)
-
-	if mineNow {
-		cbTx := NewCoinbaseTX(from, "")
-		txs := []*Transaction{cbTx, tx}
-		newBlock := bc.MineBlock(txs, []byte{}, []int{}, []byte{})
-		bc.AddBlock(newBlock)
-		UTXOSet.Update(newBlock)
+	var tx *Transaction
+	if IsScriptAddress(from) {
+		tx, err = NewMultisigTransaction(wallets, from, to, amount, lockTime, &UTXOSet)
 	} else {
-		sendTx(knownNodes[0], tx)
+		if _, ok := wallets.Wallets[from]; !ok {
+			return fmt.Errorf("sender address %s has no private key in the wallet file", from)
+		}
+		wallet := wallets.GetWallet(from)
+		tx, err = NewUTXOTransaction(&wallet, to, amount, lockTime, &UTXOSet)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := cli.commitTransaction(&UTXOSet, tx, from, mineNow); err != nil {
+		return err
+	}
+
+	return cli.report(txIDJSON{hex.EncodeToString(tx.ID)}, func() {
+		fmt.Fprintln(cli.stdout(), "Success!")
+	})
+}
+
+// commitTransaction mines tx into a new block rewarding from, or sends it to the central node
+func (cli *CLI) commitTransaction(UTXOSet *UTXOSet, tx *Transaction, from string, mineNow bool) error {
+	if !mineNow {
+		newNode(Config{}, UTXOSet.Blockchain).sendTx(defaultSeeds[0], tx)
+		return nil
+	}
+
+	bc := UTXOSet.Blockchain
+	cbTx, err := NewCoinbaseTX(from, "")
+	if err != nil {
+		return err
+	}
+	txs := []*Transaction{cbTx, tx}
+	newBlock, err := bc.MineBlock(txs, []byte{}, []int{}, []byte{})
+	if err != nil {
+		return err
+	}
+	if err := bc.AddBlock(newBlock); err != nil {
+		return err
 	}
 
-	fmt.Println("Success!")
+	return UTXOSet.Update(newBlock)
 }
@@ -0,0 +1,142 @@
+package crickchain
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sendMany pays every recipient of a CSV file in one transaction. Each line
+// of the file is ADDRESS,AMOUNT[,LOCKTIME]; lines starting with # are ignored.
+// With dryRun the transaction is only displayed.
+func (cli *CLI) sendMany(from, csvFile, strategy string, dryRun bool, dbFile, walletFile string, mineNow bool) error {
+	selector, err := CoinSelectorByName(strategy)
+	if err != nil {
+		return err
+	}
+	payments, err := readPayments(csvFile)
+	if err != nil {
+		return err
+	}
+
+	bc, err := NewBlockchain(dbFile)
+	if err != nil {
+		return err
+	}
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	plan, err := UTXOSet.PlanPayments(from, payments, selector)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		tx, err := plan.Transaction()
+		if err != nil {
+			return err
+		}
+		return cli.report(struct {
+			Transaction transactionJSON `json:"transaction"`
+			Change      int             `json:"change"`
+			Fee         int             `json:"fee"`
+		}{newTransactionJSON(tx), plan.Change, planFee(plan)}, func() {
+			printPlan(cli.stdout(), plan, tx)
+		})
+	}
+
+	wallets, err := cli.loadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	tx, err := NewPlannedTransaction(wallets, plan, &UTXOSet)
+	if err != nil {
+		return err
+	}
+	if err := cli.commitTransaction(&UTXOSet, tx, from, mineNow); err != nil {
+		return err
+	}
+
+	return cli.report(txIDJSON{hex.EncodeToString(tx.ID)}, func() {
+		fmt.Fprintf(cli.stdout(), "Success! Paid %d recipients in transaction %x\n", len(payments), tx.ID)
+	})
+}
+
+func readPayments(csvFile string) ([]Payment, error) {
+	file, err := os.Open(csvFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var payments []Payment
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected ADDRESS,AMOUNT[,LOCKTIME]", line)
+		}
+
+		payment := Payment{Address: strings.TrimSpace(record[0])}
+		payment.Amount, err = strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", line, record[1])
+		}
+		if len(record) == 3 {
+			payment.LockTime, err = strconv.ParseInt(strings.TrimSpace(record[2]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid lock time %q", line, record[2])
+			}
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+func printPlan(w io.Writer, plan *TxPlan, tx *Transaction) {
+	fmt.Fprintf(w, "Dry run, transaction %x is not sent\n", tx.ID)
+	fmt.Fprintf(w, "Inputs (%d):\n", len(plan.Inputs))
+	for _, coin := range plan.Inputs {
+		fmt.Fprintf(w, "  %x:%d  %d\n", coin.TxID, coin.Vout, coin.Value)
+	}
+	fmt.Fprintf(w, "Payments (%d):\n", len(plan.Payments))
+	for _, payment := range plan.Payments {
+		if payment.LockTime > 0 {
+			fmt.Fprintf(w, "  %s  %d  locked until %d\n", payment.Address, payment.Amount, payment.LockTime)
+		} else {
+			fmt.Fprintf(w, "  %s  %d\n", payment.Address, payment.Amount)
+		}
+	}
+	fmt.Fprintf(w, "Change: %d to %s\n", plan.Change, plan.From)
+	fmt.Fprintf(w, "Fee:    %d\n", planFee(plan))
+}
+
+// planFee returns what the inputs of plan leave to the miner
+func planFee(plan *TxPlan) int {
+	fee := 0
+	for _, coin := range plan.Inputs {
+		fee += coin.Value
+	}
+	for _, payment := range plan.Payments {
+		fee -= payment.Amount
+	}
+	fee -= plan.Change
+
+	return fee
+}
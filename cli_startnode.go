@@ -2,17 +2,31 @@ package crickchain
 
 import (
 	"fmt"
-	"log"
 )
 
-func (cli *CLI) startNode(nodeID string, dbFile string, minerAddress string) {
-	fmt.Printf("Starting node %s\n", dbFile)
-	if len(minerAddress) > 0 {
-		if ValidateAddress(minerAddress) {
-			fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
-		} else {
-			log.Panic("Wrong miner address!")
+// startNode runs a node until it stops accepting connections
+func (cli *CLI) startNode(config Config) error {
+	fmt.Fprintf(cli.messages(), "Starting node %s\n", config.NodeID)
+	if len(config.MinerAddress) > 0 {
+		if err := checkAddress(config.MinerAddress); err != nil {
+			return fmt.Errorf("wrong miner address: %w", err)
 		}
+		fmt.Fprintln(cli.messages(), "Mining is on. Address to receive rewards: ", config.MinerAddress)
 	}
-	StartServer(nodeID, dbFile, minerAddress)
+
+	node, err := Open(config)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	if err := node.Start(); err != nil {
+		return err
+	}
+	if node.RPCAddress() != "" {
+		fmt.Fprintf(cli.messages(), "JSON-RPC API on http://%s, token %s\n", node.RPCAddress(), node.RPCToken())
+		fmt.Fprintf(cli.messages(), "Explorer on %s\n", node.ExplorerURL())
+	}
+
+	return node.Wait()
 }
@@ -0,0 +1,75 @@
+package crickchain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// loadWallets loads the wallet file of a command, warning when it is not
+// encrypted
+func (cli *CLI) loadWallets(walletFile string) (*Wallets, error) {
+	wallets, err := NewWallets(walletFile)
+	if err == nil && !IsWalletEncrypted(walletFile) {
+		if _, statErr := os.Stat(walletFile); statErr == nil {
+			fmt.Fprintln(os.Stderr, "Wallet file is not encrypted, protect it with encryptwallet")
+		}
+	}
+
+	return wallets, err
+}
+
+// unlockWithPassphraseFile unlocks an encrypted wallet file with the
+// passphrase of config.PassphraseFile, if any, until lock is called
+func unlockWithPassphraseFile(config Config) (lock func(), err error) {
+	walletFile := config.WalletPath()
+	if config.PassphraseFile == "" || !IsWalletEncrypted(walletFile) {
+		return func() {}, nil
+	}
+	content, err := ioutil.ReadFile(config.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := strings.TrimRight(string(content), "\r\n")
+	if err := UnlockWallet(walletFile, passphrase, time.Duration(math.MaxInt64)); err != nil {
+		return nil, err
+	}
+
+	return func() { LockWallet(walletFile) }, nil
+}
+
+func (cli *CLI) encryptWallet(walletFile, passphrase string) error {
+	err := EncryptWallet(walletFile, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return cli.reportMessage("Wallet encrypted. Unlock it with walletpassphrase before using its keys.")
+}
+
+func (cli *CLI) walletPassphrase(walletFile, passphrase string, timeout time.Duration) error {
+	err := UnlockWallet(walletFile, passphrase, timeout)
+	if err != nil {
+		return err
+	}
+
+	return cli.reportMessage(fmt.Sprintf("Wallet unlocked for %s", timeout))
+}
+
+func (cli *CLI) walletLock(walletFile string) error {
+	LockWallet(walletFile)
+
+	return cli.reportMessage("Wallet locked")
+}
+
+func (cli *CLI) walletPassphraseChange(walletFile, oldPassphrase, newPassphrase string) error {
+	err := ChangeWalletPassphrase(walletFile, oldPassphrase, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return cli.reportMessage("Passphrase changed, the wallet is locked")
+}
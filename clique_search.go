@@ -0,0 +1,341 @@
+package crickchain
+
+import (
+	"context"
+	"math/bits"
+	"sort"
+)
+
+// Defaults of GreedySolver
+const (
+	defaultGreedyRestarts = 32
+	defaultGreedySteps    = 1000
+	// greedyTabu is the number of moves a node swapped out of the clique
+	// can't come back
+	greedyTabu = 7
+)
+
+// nodeSet is a set of nodes as a bitset, the layout of the rows of a
+// CliqueVerifier
+type nodeSet []uint64
+
+func newNodeSet(nodes int) nodeSet {
+	return make(nodeSet, (nodes+63)/64)
+}
+
+func (s nodeSet) has(n int) bool {
+	return s[n/64]&(1<<(uint(n)%64)) != 0
+}
+
+func (s nodeSet) add(n int) {
+	s[n/64] |= 1 << (uint(n) % 64)
+}
+
+func (s nodeSet) remove(n int) {
+	s[n/64] &^= 1 << (uint(n) % 64)
+}
+
+func (s nodeSet) empty() bool {
+	for _, w := range s {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// first returns the smallest node of a set that is not empty
+func (s nodeSet) first() int {
+	for i, w := range s {
+		if w != 0 {
+			return i*64 + bits.TrailingZeros64(w)
+		}
+	}
+	return -1
+}
+
+// commonCount returns the number of nodes in both s and t
+func (s nodeSet) commonCount(t nodeSet) int {
+	count := 0
+	for i, w := range s {
+		count += bits.OnesCount64(w & t[i])
+	}
+	return count
+}
+
+// row returns the neighbors of node n
+func (v *CliqueVerifier) row(n int) nodeSet {
+	return nodeSet(v.bits[n*v.words : (n+1)*v.words])
+}
+
+// GreedySolver is a heuristic solver. Each restart builds a clique from one
+// of the nodes of highest degree, adding the candidate with the most
+// candidate neighbors, then searches locally: when no node can be added, a
+// node adjacent to all the clique but one is swapped in. It is fast, but
+// finds nothing when it fails even if there is a clique. Its choices depend
+// only on the graph, so it is reproducible.
+type GreedySolver struct {
+	// Restarts is the number of constructions, defaultGreedyRestarts if zero
+	Restarts int
+	// Steps is the number of moves of each construction,
+	// defaultGreedySteps if zero
+	Steps int
+}
+
+// FindKClique implements CliqueSolver
+func (s GreedySolver) FindKClique(ctx context.Context, pg *ProblemGraph, k int) ([]int, error) {
+	if simple, _ := pg.Graph.IsSimple(); !simple || k > pg.Graph.Order() {
+		return []int{}, nil
+	}
+	if k <= 0 {
+		return []int{}, nil
+	}
+	restarts, steps := s.Restarts, s.Steps
+	if restarts == 0 {
+		restarts = defaultGreedyRestarts
+	}
+	if steps == 0 {
+		steps = defaultGreedySteps
+	}
+
+	v := pg.Verifier()
+	nodes := v.nodes
+	byDegree := make([]int, nodes)
+	for n := range byDegree {
+		byDegree[n] = n
+	}
+	sort.SliceStable(byDegree, func(i, j int) bool {
+		return len(pg.Graph.AdjacencyList[byDegree[i]]) > len(pg.Graph.AdjacencyList[byDegree[j]])
+	})
+	// ties between moves are broken by the problem PRNG seeded with the
+	// graph
+	r := newProblemRand(pg.Hash)
+
+	inClique := newNodeSet(nodes)
+	candidates := newNodeSet(nodes)
+	tabu := make([]int, nodes)
+	var clique, moves []int
+	for restart := 0; restart < restarts && restart < nodes; restart++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for i := range inClique {
+			inClique[i] = 0
+		}
+		for i := range tabu {
+			tabu[i] = 0
+		}
+		clique = append(clique[:0], byDegree[restart])
+		inClique.add(byDegree[restart])
+
+		for step := 1; step <= steps; step++ {
+			if len(clique) >= k {
+				return append([]int{}, clique...), nil
+			}
+
+			// candidates are adjacent to all the clique
+			copy(candidates, v.row(clique[0]))
+			for _, n := range clique[1:] {
+				for i, w := range v.row(n) {
+					candidates[i] &= w
+				}
+			}
+			if !candidates.empty() {
+				best, bestCount := -1, -1
+				for i, w := range candidates {
+					for ; w != 0; w &= w - 1 {
+						n := i*64 + bits.TrailingZeros64(w)
+						if count := v.row(n).commonCount(candidates); count > bestCount {
+							best, bestCount = n, count
+						}
+					}
+				}
+				clique = append(clique, best)
+				inClique.add(best)
+				continue
+			}
+
+			// swaps put in a node adjacent to all the clique but one
+			moves = moves[:0]
+			for n := 0; n < nodes; n++ {
+				if inClique.has(n) || tabu[n] > step {
+					continue
+				}
+				if v.row(n).commonCount(inClique) == len(clique)-1 {
+					moves = append(moves, n)
+				}
+			}
+			if len(moves) == 0 {
+				break
+			}
+			in := moves[r.Uint64n(uint64(len(moves)))]
+			for i, out := range clique {
+				if !v.row(in).has(out) {
+					clique[i] = in
+					inClique.remove(out)
+					inClique.add(in)
+					tabu[out] = step + greedyTabu
+					break
+				}
+			}
+		}
+		if len(clique) >= k {
+			return append([]int{}, clique...), nil
+		}
+	}
+
+	return []int{}, nil
+}
+
+// BranchAndBoundSolver is an exact solver. It extends the clique with the
+// candidates adjacent to all of it, and bounds the size of the cliques among
+// the candidates by the number of colors of a greedy coloring of them, since
+// the nodes of a clique have different colors. Branches that can't reach k
+// nodes are cut. It finds a k-clique if there is one.
+type BranchAndBoundSolver struct{}
+
+// FindKClique implements CliqueSolver
+func (BranchAndBoundSolver) FindKClique(ctx context.Context, pg *ProblemGraph, k int) ([]int, error) {
+	if simple, _ := pg.Graph.IsSimple(); !simple || k > pg.Graph.Order() {
+		return []int{}, nil
+	}
+	if k <= 0 {
+		return []int{}, nil
+	}
+
+	v := pg.Verifier()
+	candidates := newNodeSet(v.nodes)
+	for n := 0; n < v.nodes; n++ {
+		candidates.add(n)
+	}
+	search := branchAndBound{ctx: ctx, v: v, k: k}
+	search.expand(make([]int, 0, k), candidates)
+	if search.err != nil {
+		return nil, search.err
+	}
+	if search.found == nil {
+		return []int{}, nil
+	}
+
+	return search.found, nil
+}
+
+// branchAndBound is the state of a search of BranchAndBoundSolver
+type branchAndBound struct {
+	ctx   context.Context
+	v     *CliqueVerifier
+	k     int
+	found []int
+	err   error
+	// nodes counts the branches, to check ctx on the first and from time to
+	// time
+	nodes int
+}
+
+// expand looks for a k-clique made of clique and candidates, all adjacent
+// to clique. It tells if the search is over.
+func (s *branchAndBound) expand(clique []int, candidates nodeSet) bool {
+	s.nodes++
+	if s.nodes%1024 == 1 {
+		if s.err = s.ctx.Err(); s.err != nil {
+			return true
+		}
+	}
+
+	order, colors := s.color(candidates, s.k-len(clique))
+	for i := len(order) - 1; i >= 0; i-- {
+		if len(clique)+colors[i] < s.k {
+			return false
+		}
+		n := order[i]
+		extended := append(clique, n)
+		if len(extended) >= s.k {
+			s.found = append([]int{}, extended...)
+			return true
+		}
+
+		next := newNodeSet(s.v.nodes)
+		for j, w := range s.v.row(n) {
+			next[j] = w & candidates[j]
+		}
+		if !next.empty() && s.expand(extended, next) {
+			return true
+		}
+		candidates.remove(n)
+	}
+
+	return false
+}
+
+// color colors the candidates greedily, the nodes of a color class being
+// pairwise not adjacent. It returns the nodes of the colors from minColor
+// on, by increasing color, with their color. A clique among the nodes up to
+// one of color c has at most c nodes.
+func (s *branchAndBound) color(candidates nodeSet, minColor int) ([]int, []int) {
+	var order, colors []int
+	uncolored := append(nodeSet{}, candidates...)
+	class := newNodeSet(s.v.nodes)
+
+	for color := 1; !uncolored.empty(); color++ {
+		copy(class, uncolored)
+		for !class.empty() {
+			n := class.first()
+			uncolored.remove(n)
+			class.remove(n)
+			for i, w := range s.v.row(n) {
+				class[i] &^= w
+			}
+			if color >= minColor {
+				order = append(order, n)
+				colors = append(colors, color)
+			}
+		}
+	}
+
+	return order, colors
+}
+
+// allKCliques lists the k-cliques of a graph, each once with its nodes in
+// increasing order
+func allKCliques(v *CliqueVerifier, k int) [][]int {
+	cliques := [][]int{}
+	candidates := newNodeSet(v.nodes)
+	for n := 0; n < v.nodes; n++ {
+		candidates.add(n)
+	}
+
+	var extend func(clique []int, candidates nodeSet)
+	extend = func(clique []int, candidates nodeSet) {
+		if len(clique) == k {
+			cliques = append(cliques, append([]int{}, clique...))
+			return
+		}
+		for i, w := range candidates {
+			for ; w != 0; w &= w - 1 {
+				n := i*64 + bits.TrailingZeros64(w)
+				// the next nodes come after n, so that each clique is
+				// listed once
+				next := newNodeSet(v.nodes)
+				for j, row := range v.row(n) {
+					if j == n/64 {
+						row &^= 1<<(uint(n)%64+1) - 1
+					} else if j < n/64 {
+						row = 0
+					}
+					next[j] = row & candidates[j]
+				}
+				extend(append(clique, n), next)
+			}
+		}
+	}
+	extend(make([]int, 0, k), candidates)
+
+	return cliques
+}
+
+// BuiltinSolvers are the built-in clique solvers by name
+var BuiltinSolvers = map[string]CliqueSolver{
+	"bronkerbosch":   BronKerboschSolver{},
+	"greedy":         GreedySolver{},
+	"branchandbound": BranchAndBoundSolver{},
+}
@@ -0,0 +1,197 @@
+package crickchain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soniakeys/bits"
+)
+
+const (
+	// defaultSolverTimeout bounds the run of an external solver without
+	// timeout
+	defaultSolverTimeout = time.Minute
+	// solverWaitDelay is how long the output of a killed solver is waited
+	// for
+	solverWaitDelay = time.Second
+	// maxSolverOutput bounds the output of an external solver that is kept,
+	// and maxSolverErrors its error messages
+	maxSolverOutput = 1 << 20
+	maxSolverErrors = 1 << 12
+)
+
+// CliqueSolver finds cliques in problem graphs, for miners
+type CliqueSolver interface {
+	// FindKClique returns a clique of at least k nodes of pg, or an empty
+	// one if it finds none
+	FindKClique(ctx context.Context, pg *ProblemGraph, k int) ([]int, error)
+}
+
+// BronKerboschSolver is the built-in solver of ProblemGraph.FindKClique
+type BronKerboschSolver struct{}
+
+// FindKClique implements CliqueSolver. It stops at the first maximal clique
+// found after ctx is done.
+func (BronKerboschSolver) FindKClique(ctx context.Context, pg *ProblemGraph, k int) ([]int, error) {
+	//we check that we have a siple (not loops nor parallels) graph
+	simple, _ := pg.Graph.IsSimple()
+	if !simple {
+		return []int{}, nil
+	}
+
+	kClique := []int{}
+	pg.Graph.BronKerbosch1(func(c bits.Bits) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		clique := c.Slice()
+		if len(clique) >= k {
+			kClique = clique
+			return false
+		}
+		return true
+	})
+	if len(kClique) == 0 && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return kClique, nil
+}
+
+// ProcessSolver runs an external solver for each search. The graph is written
+// to its standard input in DIMACS format, after the comment line "c k K"
+// giving the size of the clique looked for. It prints the nodes of a clique,
+// numbered from 1 like in DIMACS and separated by spaces or new lines, where
+// lines starting with c are comments, and prints nothing if it finds none.
+// Results that are not cliques of the graph are errors.
+type ProcessSolver struct {
+	// Command is the solver and its arguments
+	Command []string
+	// Timeout bounds a run, defaultSolverTimeout if zero
+	Timeout time.Duration
+}
+
+// FindKClique implements CliqueSolver
+func (s ProcessSolver) FindKClique(ctx context.Context, pg *ProblemGraph, k int) ([]int, error) {
+	if len(s.Command) == 0 {
+		return nil, errors.New("no solver command")
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultSolverTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "c k %d\n", k)
+	if err := pg.WriteDIMACS(&input); err != nil {
+		return nil, err
+	}
+	output := limitedBuffer{max: maxSolverOutput}
+	stderr := limitedBuffer{max: maxSolverErrors}
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = &input
+	cmd.Stdout = &output
+	cmd.Stderr = &stderr
+	// children of the solver may keep its output open once it is killed
+	cmd.WaitDelay = solverWaitDelay
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("solver %s timed out after %s", s.Command[0], timeout)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("solver %s failed: %w: %s", s.Command[0], err, message)
+		}
+		return nil, fmt.Errorf("solver %s failed: %w", s.Command[0], err)
+	}
+
+	if output.truncated {
+		return nil, fmt.Errorf("solver %s printed more than %d bytes", s.Command[0], maxSolverOutput)
+	}
+	clique, err := parseSolverOutput(&output.buf)
+	if err != nil {
+		return nil, fmt.Errorf("solver %s: %w", s.Command[0], err)
+	}
+	if !pg.ValidateClique(clique) {
+		return nil, fmt.Errorf("solver %s returned %v, not a clique of distinct nodes of the graph", s.Command[0], clique)
+	}
+	if len(clique) < k {
+		return []int{}, nil
+	}
+
+	return clique, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest,
+// so that a solver can't fill the memory
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// parseSolverOutput reads the nodes printed by an external solver, numbered
+// from 1, and returns them numbered from 0
+func parseSolverOutput(r io.Reader) ([]int, error) {
+	clique := []int{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "c") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid node %q in the output", field)
+			}
+			clique = append(clique, n-1)
+		}
+	}
+
+	return clique, scanner.Err()
+}
+
+// WriteDIMACS writes the graph in DIMACS format: the line "p edge NODES
+// EDGES", then a line "e N M" per edge with N < M, nodes numbered from 1
+func (pg *ProblemGraph) WriteDIMACS(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "p edge %d %d\n", pg.Graph.Order(), pg.Graph.Size())
+	for n, to := range pg.Graph.AdjacencyList {
+		for _, m := range to {
+			if n < int(m) {
+				fmt.Fprintf(bw, "e %d %d\n", n+1, m+1)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
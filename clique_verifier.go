@@ -0,0 +1,88 @@
+package crickchain
+
+import (
+	"sync"
+
+	"github.com/soniakeys/graph"
+)
+
+// CliqueVerifier checks cliques against an adjacency bitset of a graph built
+// once. It never changes, so validators can share it.
+type CliqueVerifier struct {
+	nodes int
+	// words is the number of 64-bit words of a row of the bitset
+	words int
+	// bits has bit v of row u set when u and v are adjacent
+	bits []uint64
+}
+
+// NewCliqueVerifier builds the adjacency bitset of g
+func NewCliqueVerifier(g *graph.Undirected) *CliqueVerifier {
+	nodes := g.Order()
+	words := (nodes + 63) / 64
+	v := &CliqueVerifier{nodes, words, make([]uint64, nodes*words)}
+	for n, to := range g.AdjacencyList {
+		for _, m := range to {
+			v.bits[n*words+int(m)/64] |= 1 << (uint(m) % 64)
+		}
+	}
+
+	return v
+}
+
+// IsClique tells if clique is a set of distinct nodes of the graph that are
+// all adjacent to each other. It takes O(k²) for k nodes and doesn't
+// allocate.
+func (v *CliqueVerifier) IsClique(clique []int) bool {
+	for i, n := range clique {
+		if n < 0 || n >= v.nodes {
+			return false
+		}
+		row := v.bits[n*v.words : (n+1)*v.words]
+		for _, m := range clique[:i] {
+			if n == m || row[m/64]&(1<<(uint(m)%64)) == 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// lazyVerifier holds the clique verifier of a graph, built once on first use.
+// The copies of a graph share it, and so do the graphs a chain reads with the
+// same hash.
+type lazyVerifier struct {
+	once     sync.Once
+	verifier *CliqueVerifier
+}
+
+// Verifier returns the clique verifier of the graph, built on first use. The
+// graph must not change afterwards. Graphs not made by this package, with a
+// ProblemGraph literal, build it on each call.
+func (pg *ProblemGraph) Verifier() *CliqueVerifier {
+	lazy := pg.verifier
+	if lazy == nil {
+		return NewCliqueVerifier(pg.Graph)
+	}
+	lazy.once.Do(func() {
+		lazy.verifier = NewCliqueVerifier(pg.Graph)
+	})
+
+	return lazy.verifier
+}
+
+// problemVerifier returns the verifier shared by the problem graphs of the
+// chain with hash pgHash
+func (bc *Blockchain) problemVerifier(pgHash []byte) *lazyVerifier {
+	bc.verifierMu.Lock()
+	defer bc.verifierMu.Unlock()
+
+	lazy, ok := bc.verifiers[string(pgHash)]
+	if !ok {
+		lazy = &lazyVerifier{}
+		bc.verifiers[string(pgHash)] = lazy
+	}
+
+	return lazy
+}
@@ -0,0 +1,180 @@
+package crickchain
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+const bnbMaxTries = 100000
+
+var (
+	// ErrInsufficientFunds is returned when the spendable coins don't cover a payment
+	ErrInsufficientFunds = errors.New("not enough funds")
+	// ErrNoExactMatch is returned by BranchAndBound when no set of coins avoids change
+	ErrNoExactMatch = errors.New("no coin selection without change")
+)
+
+// Coin is an unspent output a wallet can spend
+type Coin struct {
+	TxID     []byte
+	Vout     int
+	Value    int
+	LockTime int64
+}
+
+// CoinSelector chooses the coins that fund a payment of target
+type CoinSelector interface {
+	Select(coins []Coin, target int) ([]Coin, error)
+}
+
+// DefaultCoinSelector avoids change when it can and otherwise spends the largest coins first
+var DefaultCoinSelector CoinSelector = BranchAndBound{Fallback: LargestFirst{}}
+
+// LargestFirst spends the largest coins first, using as few inputs as possible
+type LargestFirst struct{}
+
+// Select implements CoinSelector
+func (LargestFirst) Select(coins []Coin, target int) ([]Coin, error) {
+	return accumulateCoins(sortCoinsByValue(coins), target)
+}
+
+// BranchAndBound searches for the smallest set of coins adding up to exactly
+// target, so that the transaction needs no change output. When there is none
+// it uses Fallback, or fails with ErrNoExactMatch.
+type BranchAndBound struct {
+	Fallback CoinSelector
+}
+
+// Select implements CoinSelector
+func (s BranchAndBound) Select(coins []Coin, target int) ([]Coin, error) {
+	sorted := sortCoinsByValue(coins)
+
+	// remaining[i] is the value of the coins from i on, to prune hopeless branches
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+	if remaining[0] < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	var best, selected []int
+	tries := 0
+	var search func(i, sum int)
+	search = func(i, sum int) {
+		if tries >= bnbMaxTries || (best != nil && len(selected) >= len(best)) {
+			return
+		}
+		tries++
+		if sum == target {
+			best = append([]int{}, selected...)
+			return
+		}
+		if i == len(sorted) || sum+remaining[i] < target {
+			return
+		}
+
+		if sum+sorted[i].Value <= target {
+			selected = append(selected, i)
+			search(i+1, sum+sorted[i].Value)
+			selected = selected[:len(selected)-1]
+		}
+		// leaving out a coin also leaves out the equal ones after it, which
+		// would only repeat the same branches
+		next := i + 1
+		for next < len(sorted) && sorted[next].Value == sorted[i].Value {
+			next++
+		}
+		search(next, sum)
+	}
+	search(0, 0)
+
+	if best == nil {
+		if s.Fallback != nil {
+			return s.Fallback.Select(coins, target)
+		}
+		return nil, ErrNoExactMatch
+	}
+
+	var chosen []Coin
+	for _, i := range best {
+		chosen = append(chosen, sorted[i])
+	}
+
+	return chosen, nil
+}
+
+// RandomSelection spends coins in random order, so that the inputs of a
+// transaction don't reveal which coins the wallet holds besides them
+type RandomSelection struct{}
+
+// Select implements CoinSelector
+func (RandomSelection) Select(coins []Coin, target int) ([]Coin, error) {
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:]))))
+
+	shuffled := append([]Coin{}, coins...)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return accumulateCoins(shuffled, target)
+}
+
+// CoinSelectorByName returns the coin selection strategy called largest, bnb or random
+func CoinSelectorByName(name string) (CoinSelector, error) {
+	switch name {
+	case "", "default":
+		return DefaultCoinSelector, nil
+	case "largest":
+		return LargestFirst{}, nil
+	case "bnb":
+		return BranchAndBound{}, nil
+	case "random":
+		return RandomSelection{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown coin selection strategy %q", name)
+}
+
+func accumulateCoins(coins []Coin, target int) ([]Coin, error) {
+	var chosen []Coin
+	accumulated := 0
+
+	for _, coin := range coins {
+		if accumulated >= target {
+			break
+		}
+		chosen = append(chosen, coin)
+		accumulated += coin.Value
+	}
+	if accumulated < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	return chosen, nil
+}
+
+// sortCoinsByValue returns the coins from the largest to the smallest
+func sortCoinsByValue(coins []Coin) []Coin {
+	sorted := append([]Coin{}, coins...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return sorted[i].Value > sorted[j].Value
+		}
+		if c := bytes.Compare(sorted[i].TxID, sorted[j].TxID); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Vout < sorted[j].Vout
+	})
+
+	return sorted
+}
@@ -0,0 +1,188 @@
+package crickchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default size of the problem graphs made by creategraph
+const (
+	defaultGraphNodes = 500
+	defaultGraphEdges = 110000
+)
+
+// Config configures a Node and the CLI. It can be read from a YAML file with
+// LoadConfig, the keys being the yaml names of the fields.
+type Config struct {
+	// NodeID names the DB and wallet files, and is the port of the default
+	// listen address
+	NodeID string `yaml:"node"`
+	// DataDir holds the DB and wallet files, the working directory by default
+	DataDir string `yaml:"datadir"`
+	// DBFile and WalletFile override the file names derived from NodeID
+	DBFile     string `yaml:"dbfile"`
+	WalletFile string `yaml:"walletfile"`
+	// Network is the consensus profile of the chains created, and the one
+	// the chain of a node must follow. Empty means main for a created chain
+	// and any for a node.
+	Network string `yaml:"network"`
+	// Networks are profiles defined in addition to the built-in ones
+	Networks map[string]NetworkParams `yaml:"networks"`
+	// ListenAddress is where the node accepts peers, localhost:NodeID by
+	// default. Port 0 picks a free port.
+	ListenAddress string `yaml:"listen"`
+	// Seeds are the peers contacted on start, the first one being the central
+	// node. Nil means localhost:3000.
+	Seeds []string `yaml:"seeds"`
+	// MinerAddress enables mining of the mempool, rewarding this address
+	MinerAddress string `yaml:"miner"`
+	// GraphNodes and GraphEdges are the size of the problem graphs created
+	// by creategraph, 500 nodes and 110000 edges by default
+	GraphNodes int `yaml:"graphnodes"`
+	GraphEdges int `yaml:"graphedges"`
+	// RPCAddress enables the JSON-RPC API at this address, like
+	// localhost:8545. Binding it to other hosts than localhost exposes the node.
+	RPCAddress string `yaml:"rpc"`
+	// RPCToken guards the RPC API, a random token by default
+	RPCToken string `yaml:"rpctoken"`
+	// Solver finds the cliques minepar mines solutions with, the built-in
+	// solver by default
+	Solver SolverConfig `yaml:"solver"`
+	// PassphraseFile holds the passphrase unlocking the wallet file while a
+	// command runs, so that commands run on their own can use encrypted
+	// wallets
+	PassphraseFile string `yaml:"passphrasefile"`
+	// Logger receives the node's messages, standard output by default
+	Logger *log.Logger `yaml:"-"`
+}
+
+// SolverConfig chooses the clique solver: a built-in one by name, see
+// BuiltinSolvers, or an external one, see ProcessSolver
+type SolverConfig struct {
+	// Builtin is the name of a built-in solver, bronkerbosch by default
+	Builtin string `yaml:"builtin"`
+	// Command is the solver and its arguments
+	Command []string `yaml:"command"`
+	// Timeout bounds a run of the solver, like 30s
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LoadConfig reads a YAML configuration file. Unknown keys are errors, to
+// catch typos.
+func LoadConfig(filename string) (Config, error) {
+	var config Config
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("config file %s: %w", filename, err)
+	}
+
+	for name, params := range config.Networks {
+		if _, ok := Networks[name]; ok {
+			return config, fmt.Errorf("config file %s: network %s is built-in", filename, name)
+		}
+		params.Name = name
+		if params.Problems == (ProblemRules{}) {
+			params.Problems = defaultProblemRules(name)
+		}
+		if err := params.Validate(); err != nil {
+			return config, fmt.Errorf("config file %s: %w", filename, err)
+		}
+		config.Networks[name] = params
+	}
+	if config.Network != "" {
+		if _, err := config.NetworkParams(); err != nil {
+			return config, fmt.Errorf("config file %s: %w", filename, err)
+		}
+	}
+	if err := config.Solver.Validate(); err != nil {
+		return config, fmt.Errorf("config file %s: %w", filename, err)
+	}
+
+	return config, nil
+}
+
+// DBPath returns the blockchain DB file of the configuration
+func (c Config) DBPath() string {
+	if c.DBFile != "" {
+		return c.DBFile
+	}
+
+	return filepath.Join(c.DataDir, fmt.Sprintf(dbFile, c.NodeID))
+}
+
+// WalletPath returns the wallet file of the configuration
+func (c Config) WalletPath() string {
+	if c.WalletFile != "" {
+		return c.WalletFile
+	}
+
+	return filepath.Join(c.DataDir, fmt.Sprintf(walletFile, c.NodeID))
+}
+
+// NetworkParams returns the profile of the configured network, among the
+// ones of the configuration and the built-in ones
+func (c Config) NetworkParams() (NetworkParams, error) {
+	name := c.Network
+	if name == "" {
+		name = DefaultNetwork
+	}
+	if params, ok := c.Networks[name]; ok {
+		return params, nil
+	}
+
+	return LookupNetwork(name)
+}
+
+// graphSize returns the size of the problem graphs to create
+func (c Config) graphSize() (int, int) {
+	nodes, edges := c.GraphNodes, c.GraphEdges
+	if nodes == 0 {
+		nodes = defaultGraphNodes
+	}
+	if edges == 0 {
+		edges = defaultGraphEdges
+	}
+
+	return nodes, edges
+}
+
+// Validate checks that the solver is either a known built-in one or an
+// external one
+func (s SolverConfig) Validate() error {
+	if s.Builtin == "" {
+		return nil
+	}
+	if len(s.Command) != 0 {
+		return errors.New("solver: both builtin and command are set")
+	}
+	if _, ok := BuiltinSolvers[s.Builtin]; !ok {
+		return fmt.Errorf("solver: unknown built-in solver %s", s.Builtin)
+	}
+
+	return nil
+}
+
+// CliqueSolver returns the configured clique solver
+func (c Config) CliqueSolver() CliqueSolver {
+	if len(c.Solver.Command) == 0 {
+		if solver, ok := BuiltinSolvers[c.Solver.Builtin]; ok {
+			return solver
+		}
+		return BronKerboschSolver{}
+	}
+
+	return ProcessSolver{c.Solver.Command, c.Solver.Timeout}
+}
@@ -0,0 +1,90 @@
+package crickchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoBlockchain is returned when opening a blockchain DB that does not exist
+	ErrNoBlockchain = errors.New("no existing blockchain found, create one first")
+	// ErrLegacyBlockchain is returned when opening a blockchain DB written
+	// before outputs were locked with scripts
+	ErrLegacyBlockchain = errors.New("blockchain was created before script outputs and can't be opened, create a new one")
+	// ErrBlockchainExists is returned when creating a blockchain DB that already exists
+	ErrBlockchainExists = errors.New("blockchain already exists")
+	// ErrBlockNotFound matches every BlockNotFoundError
+	ErrBlockNotFound = errors.New("block is not found")
+	// ErrTransactionNotFound is returned when a transaction is not in the active chain
+	ErrTransactionNotFound = errors.New("transaction is not found")
+	// ErrProblemNotFound is returned when a problem graph is not in the DB
+	ErrProblemNotFound = errors.New("problem is not found")
+	// ErrInvalidProblem is returned when adding a problem graph that is not valid
+	ErrInvalidProblem = errors.New("problem graph is not valid")
+	// ErrInvalidBlock is returned when adding a block that fails validation
+	ErrInvalidBlock = errors.New("block is not valid")
+	// ErrInvalidAddress matches every InvalidAddressError
+	ErrInvalidAddress = errors.New("address is not valid")
+)
+
+// BlockNotFoundError is returned when a block looked up by hash or height is
+// not in the blockchain. It matches ErrBlockNotFound with errors.Is.
+type BlockNotFoundError struct {
+	// Hash is the hash looked up, or nil for a lookup by Height
+	Hash   []byte
+	Height int
+}
+
+func (e *BlockNotFoundError) Error() string {
+	if e.Hash != nil {
+		return fmt.Sprintf("block %x is not found", e.Hash)
+	}
+
+	return fmt.Sprintf("block at height %d is not found", e.Height)
+}
+
+// Is makes errors.Is match ErrBlockNotFound
+func (e *BlockNotFoundError) Is(target error) bool {
+	return target == ErrBlockNotFound
+}
+
+// InvalidAddressError is returned for an address that is not valid Base58Check.
+// It matches ErrInvalidAddress with errors.Is.
+type InvalidAddressError struct {
+	Address string
+}
+
+func (e *InvalidAddressError) Error() string {
+	return fmt.Sprintf("address %q is not valid", e.Address)
+}
+
+// Is makes errors.Is match ErrInvalidAddress
+func (e *InvalidAddressError) Is(target error) bool {
+	return target == ErrInvalidAddress
+}
+
+// InsufficientFundsError is returned when the spendable coins of an address
+// don't cover a payment. It matches ErrInsufficientFunds with errors.Is.
+type InsufficientFundsError struct {
+	Address   string
+	Needed    int
+	Available int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("not enough funds: %s can spend %d of the %d needed", e.Address, e.Available, e.Needed)
+}
+
+// Is makes errors.Is match ErrInsufficientFunds
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// checkAddress returns an InvalidAddressError unless address is valid
+func checkAddress(address string) error {
+	if !ValidateAddress(address) {
+		return &InvalidAddressError{address}
+	}
+
+	return nil
+}
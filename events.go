@@ -0,0 +1,339 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types pushed to subscribers
+const (
+	// EventTip is a new block at the tip of the active chain
+	EventTip = "tip"
+	// EventReorg is a new tip that is not a child of the previous one
+	EventReorg = "reorg"
+	// EventTx is a transaction added to the mempool
+	EventTx = "tx"
+	// EventProblem is a problem graph introduced by a new tip
+	EventProblem = "problem"
+	// EventSolution is a new tip holding the best clique found yet for a
+	// problem graph
+	EventSolution = "solution"
+)
+
+// EventsPath is where the RPC server streams events
+const EventsPath = "/events"
+
+// eventBuffer is how many events a subscriber can fall behind by before it
+// is dropped
+const eventBuffer = 64
+
+// Event tells subscribers about a change of the chain or the mempool
+type Event struct {
+	Type        string `json:"type"`
+	Height      int    `json:"height,omitempty"`
+	BlockHash   string `json:"blockHash,omitempty"`
+	OldTip      string `json:"oldTip,omitempty"`
+	TxID        string `json:"txid,omitempty"`
+	ProblemHash string `json:"problemHash,omitempty"`
+	Solution    []int  `json:"solution,omitempty"`
+
+	// txs are the transactions of the event, to filter it by address
+	txs []*Transaction
+}
+
+// EventFilter selects events. Empty fields select everything; with both
+// Addresses and Problems an event concerning any of them is selected.
+type EventFilter struct {
+	// Types are the event types to receive
+	Types []string
+	// Addresses select tip, reorg and tx events with transactions paying or
+	// spending one of them
+	Addresses []string
+	// Problems select problem and solution events of these problem graph
+	// hashes, in hex
+	Problems []string
+}
+
+// Subscription receives the events selected by its filter until Close
+type Subscription struct {
+	filter EventFilter
+	hashes [][]byte
+	events chan Event
+	hub    *eventHub
+}
+
+// Events returns the channel of the events. It is closed by Close, and when
+// the subscriber falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+func (s *Subscription) matches(e Event) bool {
+	if len(s.filter.Types) > 0 && !containsString(s.filter.Types, e.Type) {
+		return false
+	}
+	if len(s.hashes) == 0 && len(s.filter.Problems) == 0 {
+		return true
+	}
+
+	for _, problem := range s.filter.Problems {
+		if e.ProblemHash != "" && strings.EqualFold(problem, e.ProblemHash) {
+			return true
+		}
+	}
+	for _, tx := range e.txs {
+		for _, hash := range s.hashes {
+			if txConcerns(tx, hash) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// txConcerns tells whether tx pays or spends the address of hash
+func txConcerns(tx *Transaction, hash []byte) bool {
+	for _, out := range tx.Vout {
+		if Equal(ScriptLockHash(out.ScriptPubKey), hash) {
+			return true
+		}
+	}
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, in := range tx.Vin {
+		if in.UsesKey(hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eventHub dispatches the events of a node to its subscriptions
+type eventHub struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscriptions: make(map[*Subscription]bool)}
+}
+
+func (h *eventHub) subscribe(filter EventFilter) (*Subscription, error) {
+	s := &Subscription{filter: filter, events: make(chan Event, eventBuffer), hub: h}
+	for _, address := range filter.Addresses {
+		if err := checkAddress(address); err != nil {
+			return nil, err
+		}
+		s.hashes = append(s.hashes, addressHash(address))
+	}
+
+	h.mu.Lock()
+	h.subscriptions[s] = true
+	h.mu.Unlock()
+
+	return s, nil
+}
+
+func (h *eventHub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscriptions[s] {
+		delete(h.subscriptions, s)
+		close(s.events)
+	}
+}
+
+// publish sends e to the matching subscriptions without blocking. A
+// subscription whose buffer is full is closed.
+func (h *eventHub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscriptions {
+		if !s.matches(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			delete(h.subscriptions, s)
+			close(s.events)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the node selected by
+// filter. It must be closed once done with.
+func (n *Node) Subscribe(filter EventFilter) (*Subscription, error) {
+	return n.events.subscribe(filter)
+}
+
+// addBlock adds a block to the chain, with the problem graphs fetched for it,
+// and publishes the events it causes
+func (n *Node) addBlock(block *Block, fetched map[string]*ProblemGraph) error {
+	n.chainMu.Lock()
+	oldTip := n.bc.tip
+	if err := n.bc.addBlock(block, fetched); err != nil {
+		n.chainMu.Unlock()
+		return err
+	}
+	newTip := Equal(n.bc.tip, block.Hash) && !Equal(oldTip, block.Hash)
+	n.chainMu.Unlock()
+
+	if !newTip {
+		return nil
+	}
+
+	tip := Event{
+		Type:      EventTip,
+		Height:    block.Height,
+		BlockHash: hex.EncodeToString(block.Hash),
+		txs:       block.Transactions,
+	}
+	n.events.publish(tip)
+	if !Equal(block.PrevBlockHash, oldTip) {
+		reorg := tip
+		reorg.Type = EventReorg
+		reorg.OldTip = hex.EncodeToString(oldTip)
+		n.events.publish(reorg)
+	}
+
+	// blocks can refer to problem graphs by their hash before canonical
+	// hashing, events always give the canonical one
+	aliases := n.bc.problemAliases()
+	if len(block.ProblemGraphHash) > 0 {
+		n.events.publish(Event{
+			Type:        EventProblem,
+			Height:      block.Height,
+			BlockHash:   tip.BlockHash,
+			ProblemHash: hex.EncodeToString(canonicalProblemHash(aliases, block.ProblemGraphHash)),
+		})
+	}
+	// the initial solution of a new problem graph was checked with it, the
+	// other solutions are the ones that lower the target
+	var solved *ProblemGraph
+	if len(block.ProblemGraphHash) > 0 && Equal(block.SolutionHash, block.ProblemGraphHash) {
+		if pg, err := n.bc.GetProblemGraphFromHash(block.SolutionHash); err == nil {
+			solved = &pg
+		}
+	} else {
+		solved = block.solvedProblem(n.bc, nil)
+	}
+	if solved != nil {
+		n.events.publish(Event{
+			Type:        EventSolution,
+			Height:      block.Height,
+			BlockHash:   tip.BlockHash,
+			ProblemHash: hex.EncodeToString(solved.Hash),
+			Solution:    block.Solution,
+		})
+	}
+
+	return nil
+}
+
+// eventsHandler streams the events of a node as server-sent events. The
+// filter is given by the query parameters type, address and problem, each
+// repeatable or comma separated.
+type eventsHandler struct {
+	node  *Node
+	token string
+	// stop is closed when the server shuts down
+	stop <-chan struct{}
+}
+
+func (h *eventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "events are streamed to GET requests", http.StatusMethodNotAllowed)
+		return
+	}
+	// browsers can't set headers on an EventSource, so the token may also
+	// come as ?token=TOKEN
+	query := r.URL.Query()
+	if !checkRPCToken(r, query.Get("token"), h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid RPC token", http.StatusUnauthorized)
+		return
+	}
+
+	filter := EventFilter{
+		Types:     queryList(query["type"]),
+		Addresses: queryList(query["address"]),
+		Problems:  queryList(query["problem"]),
+	}
+	sub, err := h.node.Subscribe(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer sub.Close()
+
+	// the stream outlives the write timeout of the server
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		case <-h.stop:
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// queryList splits comma separated query values
+func queryList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,38 @@
+package crickchain
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// explorerFiles is the block and problem graph explorer, a page calling the
+// JSON-RPC API from the browser
+//
+//go:embed explorer
+var explorerFiles embed.FS
+
+// ExplorerPath is where the RPC server serves the explorer
+const ExplorerPath = "/explorer/"
+
+// ExplorerHandler serves the explorer files. They hold no chain data, the
+// page asks the API for it with the RPC token given as ?token=TOKEN.
+func ExplorerHandler() http.Handler {
+	files, err := fs.Sub(explorerFiles, "explorer")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix(ExplorerPath, http.FileServer(http.FS(files)))
+}
+
+// ExplorerURL returns the address of the explorer of the node, or "" when
+// the RPC API is off
+func (n *Node) ExplorerURL() string {
+	address := n.RPCAddress()
+	if address == "" {
+		return ""
+	}
+
+	return "http://" + address + ExplorerPath + "?token=" + n.RPCToken()
+}
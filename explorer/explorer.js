@@ -0,0 +1,331 @@
+// The explorer is a single page calling the JSON-RPC API of the node. The
+// RPC token comes as ?token=TOKEN and is kept for the browser session.
+
+var token = new URLSearchParams(location.search).get('token');
+if (token) {
+    sessionStorage.setItem('token', token);
+    history.replaceState(null, '', location.pathname + location.hash);
+} else {
+    token = sessionStorage.getItem('token');
+}
+
+var colours = ['Coral', 'CornflowerBlue', 'DarkGoldenRod', 'DarkGreen', 'DarkKhaki', 'DarkOrange', 'DarkOrchid', 'DarkRed',
+    'DarkSalmon', 'HotPink', 'Yellow', 'BlueViolet', 'Sienna', 'Silver', 'RosyBrown', 'MistyRose'];
+
+// live reloads the current page on new tips, if it is live
+var live = null;
+var content = document.getElementById('content');
+
+var rpcID = 0;
+
+function rpc(method, params) {
+    return fetch('/', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': 'Bearer ' + token
+        },
+        body: JSON.stringify({jsonrpc: '2.0', method: method, params: params || [], id: ++rpcID})
+    }).then(function(response) {
+        if (response.status == 401) {
+            throw new Error('invalid RPC token, open the explorer URL printed by startnode');
+        }
+        return response.json();
+    }).then(function(response) {
+        if (response.error) {
+            throw new Error(response.error.message);
+        }
+        return response.result;
+    });
+}
+
+function escape(text) {
+    return String(text).replace(/[&<>"']/g, function(c) {
+        return '&#' + c.charCodeAt(0) + ';';
+    });
+}
+
+function link(route, text) {
+    return '<a class="hash" href="#/' + route + '">' + escape(text) + '</a>';
+}
+
+function time(timestamp) {
+    return new Date(timestamp * 1000).toLocaleString();
+}
+
+function validity(valid) {
+    return valid ? '<span class="valid">valid</span>' : '<span class="invalid">invalid</span>';
+}
+
+function table(headers, rows) {
+    var html = '<table><tr>';
+    headers.forEach(function(header) {
+        html += '<th>' + header + '</th>';
+    });
+    html += '</tr>';
+    rows.forEach(function(row) {
+        html += '<tr><td>' + row.join('</td><td>') + '</td></tr>';
+    });
+    return html + '</table>';
+}
+
+// fields renders an object as a two columns table
+function fields(rows) {
+    return '<table>' + rows.map(function(row) {
+        return '<tr><th>' + row[0] + '</th><td>' + row[1] + '</td></tr>';
+    }).join('') + '</table>';
+}
+
+function showError(err) {
+    content.innerHTML = '<p class="error">' + escape(err.message) + '</p>';
+}
+
+function showBlocks() {
+    return rpc('getblocks', {count: 50}).then(function(blocks) {
+        content.innerHTML = '<h2>Blocks</h2>' + table(
+            ['Height', 'Hash', 'Time', 'Difficulty', 'Transactions', 'Problem', 'Solution'],
+            blocks.map(function(b) {
+                return [
+                    link('block/' + b.height, b.height),
+                    link('block/' + b.hash, b.hash),
+                    time(b.timestamp),
+                    b.difficulty,
+                    b.transactions,
+                    b.problemHash ? link('problem/' + b.problemHash, b.problemHash.substr(0, 16)) : '',
+                    b.solutionHash ? link('problem/' + b.solutionHash, b.solutionHash.substr(0, 16)) : ''
+                ];
+            }));
+    });
+}
+
+function showBlock(id) {
+    var block = /^\d+$/.test(id) ? parseInt(id, 10) : id;
+    return rpc('getblock', {block: block}).then(function(b) {
+        var html = '<h2>Block ' + b.height + '</h2>' + fields([
+            ['Hash', '<span class="hash">' + b.hash + '</span>'],
+            ['Previous block', b.prevBlockHash ? link('block/' + b.prevBlockHash, b.prevBlockHash) : ''],
+            ['Time', time(b.timestamp)],
+            ['Nonce', b.nonce],
+            ['Target', '<span class="hash">' + b.target + '</span>'],
+            ['Difficulty', b.difficulty],
+            ['Normal difficulty', b.normalDifficulty || ''],
+            ['Reduced difficulty', b.reducedDifficulty || ''],
+            ['Block', validity(b.valid)],
+            ['New problem graph', b.problemHash ? link('problem/' + b.problemHash, b.problemHash) : 'none'],
+            ['Solved problem graph', b.solutionHash ? link('problem/' + b.solutionHash, b.solutionHash) : 'none'],
+            ['Solution', b.solutionHash ? escape(JSON.stringify(b.solution)) + ' ' + validity(b.validSolution) : '']
+        ]);
+        html += '<h3>Transactions</h3>' + transactions(b.transactions);
+        content.innerHTML = html;
+    });
+}
+
+function transactions(txs) {
+    return table(['ID', 'Inputs', 'Outputs'], txs.map(function(tx) {
+        var inputs = tx.coinbase ? 'coinbase' : tx.inputs.map(function(vin) {
+            return link('tx/' + vin.txid, vin.txid.substr(0, 16)) + ':' + vin.vout;
+        }).join('<br>');
+        var outputs = tx.outputs.map(function(vout) {
+            var to = vout.address ? link('address/' + vout.address, vout.address) : escape(vout.script);
+            return vout.value + ' to ' + to;
+        }).join('<br>');
+        return [link('tx/' + tx.id, tx.id), inputs, outputs];
+    }));
+}
+
+function showTransaction(id) {
+    return rpc('gettransaction', {txid: id}).then(function(tx) {
+        var html = '<h2>Transaction</h2>' + fields([
+            ['ID', '<span class="hash">' + tx.id + '</span>'],
+            ['Block', link('block/' + tx.blockHash, tx.height)],
+            ['Version', tx.version],
+            ['Lock time', tx.lockTime || 0]
+        ]);
+        if (!tx.coinbase) {
+            html += '<h3>Inputs</h3>' + table(['Output', 'Sequence', 'Script'], tx.inputs.map(function(vin) {
+                return [link('tx/' + vin.txid, vin.txid) + ':' + vin.vout, vin.sequence,
+                    '<span class="hash">' + vin.scriptSig + '</span>'];
+            }));
+        }
+        html += '<h3>Outputs</h3>' + table(['Value', 'Address', 'Script'], tx.outputs.map(function(vout) {
+            return [vout.value, vout.address ? link('address/' + vout.address, vout.address) : '',
+                '<span class="hash">' + escape(vout.script) + '</span>'];
+        }));
+        content.innerHTML = html;
+    });
+}
+
+function showAddress(address) {
+    return rpc('getaddress', {address: address}).then(function(a) {
+        content.innerHTML = '<h2>Address</h2>' + fields([
+            ['Address', '<span class="hash">' + escape(a.address) + '</span>'],
+            ['Balance', a.balance]
+        ]) + '<h3>Transactions</h3>' + table(['Height', 'ID', 'Received', 'Sent'], a.transactions.map(function(tx) {
+            return [link('block/' + tx.height, tx.height), link('tx/' + tx.txid, tx.txid), tx.received, tx.sent];
+        }));
+    });
+}
+
+function showProblems() {
+    return rpc('getproblems').then(function(problems) {
+        content.innerHTML = '<h2>Problem graphs</h2>' + table(
+            ['Hash', 'Nodes', 'Edges', 'Solutions', 'Best clique'],
+            problems.map(function(p) {
+                return [link('problem/' + p.hash, p.hash), p.nodes, p.edges, p.solutions.length,
+                    p.bestSolution ? p.bestSolution.length : 0];
+            }));
+    });
+}
+
+// selectedClique is the index of the clique highlighted on the problem page
+var selectedClique = 0;
+
+function showProblem(hash) {
+    return rpc('getproblem', {hash: hash, graph: true}).then(function(p) {
+        var cliques = p.solutions || [];
+        if (selectedClique >= cliques.length) {
+            selectedClique = 0;
+        }
+        var html = '<h2>Problem graph</h2>' + fields([
+            ['Hash', '<span class="hash">' + p.hash + '</span>'],
+            ['Nodes', p.nodes],
+            ['Edges', p.edges],
+            ['Connected', p.connected],
+            ['Best clique', escape(JSON.stringify(p.bestSolution || []))]
+        ]);
+        html += '<canvas id="graph" width="800" height="800"></canvas>';
+        html += '<h3>Cliques found on chain</h3>' + table(['Size', 'Nodes'], cliques.map(function(clique, i) {
+            return [clique.length, escape(clique.join(', '))];
+        }));
+        content.innerHTML = html;
+
+        var rows = content.querySelectorAll('table:last-of-type tr');
+        for (var i = 1; i < rows.length; i++) {
+            rows[i].className = 'clique' + (i - 1 == selectedClique ? ' selected' : '');
+            rows[i].onclick = (function(index) {
+                return function() {
+                    selectedClique = index;
+                    showProblem(hash);
+                };
+            })(i - 1);
+        }
+        drawGraph(document.getElementById('graph'), p.adjacency, cliques[selectedClique] || []);
+    });
+}
+
+// drawGraph draws the nodes of the graph on a circle, the edges of the
+// clique in bold and its nodes coloured after its size
+function drawGraph(canvas, adjacency, clique) {
+    var ctx = canvas.getContext('2d');
+    var n = adjacency.length;
+    var radius = canvas.width / 2 - 30;
+    var r = Math.max(3, Math.min(10, 300 / n));
+    var position = function(i) {
+        var angle = i * 2 * Math.PI / n;
+        return [canvas.width / 2 + radius * Math.cos(angle), canvas.height / 2 + radius * Math.sin(angle)];
+    };
+    var inClique = {};
+    clique.forEach(function(node) {
+        inClique[node] = true;
+    });
+
+    ctx.clearRect(0, 0, canvas.width, canvas.height);
+    adjacency.forEach(function(neighbors, from) {
+        neighbors.forEach(function(to) {
+            if (to < from) {
+                return;
+            }
+            var a = position(from);
+            var b = position(to);
+            var bold = inClique[from] && inClique[to];
+            ctx.beginPath();
+            ctx.lineWidth = bold ? 3 : 1;
+            ctx.strokeStyle = bold ? '#0a0a0a' : '#999';
+            ctx.moveTo(a[0], a[1]);
+            ctx.lineTo(b[0], b[1]);
+            ctx.stroke();
+        });
+    });
+    for (var i = 0; i < n; i++) {
+        var p = position(i);
+        ctx.beginPath();
+        ctx.arc(p[0], p[1], r, 0, 2 * Math.PI);
+        ctx.fillStyle = inClique[i] ? colours[clique.length % colours.length] : 'white';
+        ctx.fill();
+        ctx.lineWidth = 2;
+        ctx.strokeStyle = 'black';
+        ctx.stroke();
+        if (n <= 50) {
+            ctx.fillStyle = 'black';
+            ctx.fillText(i, p[0] + r + 2, p[1] - r - 2);
+        }
+    }
+}
+
+var routes = [
+    [/^#?\/?$/, showBlocks, true],
+    [/^#\/block\/(.+)$/, showBlock, false],
+    [/^#\/tx\/(.+)$/, showTransaction, false],
+    [/^#\/address\/(.+)$/, showAddress, false],
+    [/^#\/problems$/, showProblems, true],
+    [/^#\/problem\/(.+)$/, showProblem, true]
+];
+
+function showHeight(height) {
+    document.getElementById('height').textContent = 'Height ' + height;
+}
+
+// route shows the page of the location hash. Block lists and problem graphs
+// are live, they are reloaded when the node streams a new tip.
+function route() {
+    live = null;
+    rpc('getbestheight').then(showHeight).catch(function() {});
+
+    for (var i = 0; i < routes.length; i++) {
+        var match = routes[i][0].exec(location.hash);
+        if (!match) {
+            continue;
+        }
+        var show = routes[i][1];
+        var arg = match[1] && decodeURIComponent(match[1]);
+        show(arg).catch(showError);
+        if (routes[i][2]) {
+            live = function() {
+                show(arg).catch(showError);
+            };
+        }
+        return;
+    }
+    showError(new Error('unknown page ' + location.hash));
+}
+
+// search guesses what the query is: a height, a block hash, a transaction id
+// or else an address
+document.getElementById('search').onsubmit = function(event) {
+    event.preventDefault();
+    var q = this.q.value.trim();
+    if (/^\d+$/.test(q)) {
+        location.hash = '#/block/' + q;
+    } else if (/^[0-9a-f]{64}$/i.test(q)) {
+        rpc('getblock', {block: q}).then(function() {
+            location.hash = '#/block/' + q;
+        }).catch(function() {
+            location.hash = '#/tx/' + q;
+        });
+    } else {
+        location.hash = '#/address/' + q;
+    }
+};
+
+var events = new EventSource('/events?type=tip,reorg&token=' + encodeURIComponent(token || ''));
+['tip', 'reorg'].forEach(function(type) {
+    events.addEventListener(type, function(event) {
+        showHeight(JSON.parse(event.data).height);
+        if (live) {
+            live();
+        }
+    });
+});
+
+window.onhashchange = route;
+route();
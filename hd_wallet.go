@@ -0,0 +1,185 @@
+package crickchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// HD keys are derived as in SLIP-0010, the BIP32 variant for the NIST P-256
+// curve. Receiving addresses live on the path m/0'/0/i.
+const (
+	hdMasterSeed      = "Nist256p1 seed"
+	hdHardened        = uint32(0x80000000)
+	hdEntropyBits     = 128
+	hdDefaultGapLimit = 20
+)
+
+// HDWallet is a seed from which every key of the wallet is derived
+type HDWallet struct {
+	Mnemonic  string
+	Seed      []byte
+	NextIndex uint32
+}
+
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+// NewMnemonic returns a new random 12 word mnemonic
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(hdEntropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// NewHDWallet creates an HDWallet from a mnemonic
+func NewHDWallet(mnemonic string) (*HDWallet, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &HDWallet{mnemonic, seed, 0}, nil
+}
+
+// DeriveWallet returns the key pair of receiving address index
+func (hd HDWallet) DeriveWallet(index uint32) *Wallet {
+	key := hdMasterKey(hd.Seed)
+	for _, i := range []uint32{hdHardened, 0, index} {
+		key = key.child(i)
+	}
+
+	curve := elliptic.P256()
+	private := ecdsa.PrivateKey{}
+	private.PublicKey.Curve = curve
+	private.D = new(big.Int).SetBytes(key.key)
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(key.key)
+
+	return &Wallet{private, encodePubKey(private.PublicKey)}
+}
+
+func hdMasterKey(seed []byte) *extendedKey {
+	data := seed
+	for {
+		I := hmacSHA512([]byte(hdMasterSeed), data)
+		if isValidHDKey(I[:32]) {
+			return &extendedKey{I[:32], I[32:]}
+		}
+		data = I
+	}
+}
+
+// child derives the child key i, hardened if i >= hdHardened
+func (k *extendedKey) child(i uint32) *extendedKey {
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], i)
+
+	var data []byte
+	if i >= hdHardened {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		curve := elliptic.P256()
+		x, y := curve.ScalarBaseMult(k.key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+
+	n := elliptic.P256().Params().N
+	for {
+		I := hmacSHA512(k.chainCode, append(data, index[:]...))
+		childKey := new(big.Int).SetBytes(I[:32])
+		if childKey.Cmp(n) < 0 {
+			childKey.Add(childKey, new(big.Int).SetBytes(k.key))
+			childKey.Mod(childKey, n)
+			if childKey.Sign() != 0 {
+				return &extendedKey{childKey.FillBytes(make([]byte, 32)), I[32:]}
+			}
+		}
+		data = append([]byte{0x01}, I[32:]...)
+	}
+}
+
+func isValidHDKey(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+
+	return k.Sign() != 0 && k.Cmp(elliptic.P256().Params().N) < 0
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// SetHDWallet makes the wallet derive its new addresses from mnemonic
+func (ws *Wallets) SetHDWallet(mnemonic string) error {
+	if ws.HD != nil {
+		return errors.New("wallet already has an HD seed")
+	}
+	hd, err := NewHDWallet(mnemonic)
+	if err != nil {
+		return err
+	}
+	ws.HD = hd
+
+	return nil
+}
+
+// NewHDAddress derives the next receiving address of the HD wallet
+func (ws *Wallets) NewHDAddress() string {
+	wallet := ws.HD.DeriveWallet(ws.HD.NextIndex)
+	ws.HD.NextIndex++
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+
+	return address
+}
+
+// ScanHDAddresses derives addresses until gapLimit consecutive ones own no
+// unspent outputs and keeps those up to the last used one. It returns the
+// used addresses.
+func (ws *Wallets) ScanHDAddresses(UTXOSet *UTXOSet, gapLimit int) ([]string, error) {
+	used := make(map[string]bool)
+	err := UTXOSet.forEachOutput(func(out TXOutput) {
+		if hash := ScriptLockHash(out.ScriptPubKey); hash != nil {
+			used[string(hash)] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	var derived []*Wallet
+	gap := 0
+	for index := uint32(0); gap < gapLimit; index++ {
+		wallet := ws.HD.DeriveWallet(index)
+		derived = append(derived, wallet)
+		if !used[string(HashPubKey(wallet.PublicKey))] {
+			gap++
+			continue
+		}
+		gap = 0
+		found = append(found, string(wallet.GetAddress()))
+		for _, w := range derived {
+			ws.Wallets[string(w.GetAddress())] = w
+		}
+		derived = nil
+		if index+1 > ws.HD.NextIndex {
+			ws.HD.NextIndex = index + 1
+		}
+	}
+
+	return found, nil
+}
@@ -0,0 +1,155 @@
+package crickchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	networkBucket = "network"
+	// DefaultNetwork is the network of blockchains created without one, and
+	// of the DBs created before networks existed
+	DefaultNetwork = "main"
+)
+
+// NetworkParams are the consensus parameters of a network. They are stored
+// in the blockchain DB when it is created, so a chain keeps them even if the
+// profile it was created from changes.
+type NetworkParams struct {
+	Name string `yaml:"-" json:"name"`
+	// BlocksPerTargetUpdate is the number of blocks between target updates
+	BlocksPerTargetUpdate int `yaml:"blocksPerTargetUpdate" json:"blocksPerTargetUpdate"`
+	// TargetBlocksPerMinute is the block rate the targets are adjusted to
+	TargetBlocksPerMinute int `yaml:"targetBlocksPerMinute" json:"targetBlocksPerMinute"`
+	// Eta is the wanted ratio of the time to mine a block with a solution to
+	// the time to mine one without
+	Eta float64 `yaml:"eta" json:"eta"`
+	// MaxTargetChange bounds the factor a target changes by in one update
+	MaxTargetChange float64 `yaml:"maxTargetChange" json:"maxTargetChange"`
+	// InitialTargetBits and InitialReducedTargetBits are the number of
+	// leading zero bits of the first targets, without and with a solution
+	InitialTargetBits        int `yaml:"initialTargetBits" json:"initialTargetBits"`
+	InitialReducedTargetBits int `yaml:"initialReducedTargetBits" json:"initialReducedTargetBits"`
+	// Problems are the rules problem graphs are admitted by
+	Problems ProblemRules `yaml:"problems" json:"problems"`
+	// SeededProblemsFrom is the height from which blocks introducing a
+	// problem graph must commit to the parameters generating it from the seed
+	// of their parent. Below it they can refer to any graph by its hash.
+	SeededProblemsFrom int `yaml:"seededProblemsFrom" json:"seededProblemsFrom"`
+}
+
+// Networks are the built-in network profiles. test retargets faster than main
+// and regtest mines blocks almost instantly, for local experiments.
+var Networks = map[string]NetworkParams{
+	"main": {
+		Name:                     "main",
+		BlocksPerTargetUpdate:    64,
+		TargetBlocksPerMinute:    6,
+		Eta:                      0.25,
+		MaxTargetChange:          4.0,
+		InitialTargetBits:        16,
+		InitialReducedTargetBits: 12,
+		Problems:                 ProblemRules{MinNodes: 50, MaxNodes: 2000, MinDensity: 0.25, MaxDensity: 0.95},
+	},
+	"test": {
+		Name:                     "test",
+		BlocksPerTargetUpdate:    16,
+		TargetBlocksPerMinute:    6,
+		Eta:                      0.25,
+		MaxTargetChange:          4.0,
+		InitialTargetBits:        12,
+		InitialReducedTargetBits: 8,
+		Problems:                 ProblemRules{MinNodes: 20, MaxNodes: 2000, MinDensity: 0.25, MaxDensity: 0.95},
+	},
+	"regtest": {
+		Name:                     "regtest",
+		BlocksPerTargetUpdate:    8,
+		TargetBlocksPerMinute:    60,
+		Eta:                      0.25,
+		MaxTargetChange:          4.0,
+		InitialTargetBits:        4,
+		InitialReducedTargetBits: 2,
+		Problems:                 ProblemRules{MinNodes: 5, MaxNodes: 2000, MinDensity: 0.05, MaxDensity: 1},
+	},
+}
+
+// LookupNetwork returns the built-in profile called name
+func LookupNetwork(name string) (NetworkParams, error) {
+	params, ok := Networks[name]
+	if !ok {
+		var names []string
+		for name := range Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return NetworkParams{}, fmt.Errorf("unknown network %q, known ones are %v", name, names)
+	}
+
+	return params, nil
+}
+
+// Validate checks that the parameters make a working chain
+func (p NetworkParams) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("network has no name")
+	case p.BlocksPerTargetUpdate < 1:
+		return fmt.Errorf("network %s: blocksPerTargetUpdate must be positive", p.Name)
+	case p.TargetBlocksPerMinute < 1:
+		return fmt.Errorf("network %s: targetBlocksPerMinute must be positive", p.Name)
+	case p.Eta <= 0 || p.Eta >= 1:
+		return fmt.Errorf("network %s: eta must be between 0 and 1", p.Name)
+	case p.MaxTargetChange < 1:
+		return fmt.Errorf("network %s: maxTargetChange must be at least 1", p.Name)
+	case p.InitialTargetBits < 1 || p.InitialTargetBits > 255:
+		return fmt.Errorf("network %s: initialTargetBits must be between 1 and 255", p.Name)
+	case p.InitialReducedTargetBits < 1 || p.InitialReducedTargetBits > p.InitialTargetBits:
+		return fmt.Errorf("network %s: initialReducedTargetBits must be between 1 and initialTargetBits", p.Name)
+	case p.SeededProblemsFrom < 0:
+		return fmt.Errorf("network %s: seededProblemsFrom must not be negative", p.Name)
+	}
+
+	return p.Problems.validate(p.Name)
+}
+
+// Params returns the consensus parameters of the chain
+func (bc *Blockchain) Params() NetworkParams {
+	return bc.params
+}
+
+// putNetworkParams stores the parameters of a new chain
+func putNetworkParams(tx *bolt.Tx, params NetworkParams) error {
+	b, err := tx.CreateBucket([]byte(networkBucket))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte("params"), data)
+}
+
+// getNetworkParams reads the parameters of a chain, the main ones for the
+// chains created before they were stored
+func getNetworkParams(tx *bolt.Tx) (NetworkParams, error) {
+	b := tx.Bucket([]byte(networkBucket))
+	if b == nil {
+		return Networks[DefaultNetwork], nil
+	}
+
+	var params NetworkParams
+	if err := json.Unmarshal(b.Get([]byte("params")), &params); err != nil {
+		return NetworkParams{}, fmt.Errorf("corrupt network parameters: %w", err)
+	}
+	if params.Problems == (ProblemRules{}) {
+		params.Problems = defaultProblemRules(params.Name)
+	}
+
+	return params, params.Validate()
+}
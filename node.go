@@ -0,0 +1,476 @@
+package crickchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// defaultSeeds are contacted when a Config has no Seeds. The first one is the
+// central node that relays transactions to the miners.
+var defaultSeeds = []string{"localhost:3000"}
+
+// Node is a blockchain node that can be embedded in another program. It owns
+// the blockchain DB from Open to Close, and talks to peers between Start and
+// Stop.
+type Node struct {
+	config   Config
+	bc       *Blockchain
+	logger   *log.Logger
+	rpcToken string
+	events   *eventHub
+
+	// mu guards the fields below
+	mu              sync.Mutex
+	address         string
+	knownNodes      []string
+	blocksInTransit [][]byte
+	pendingBlocks   []*pendingBlock
+	mempool         map[string]Transaction
+	miningAddress   string
+	listener        net.Listener
+	done            chan struct{}
+	serveErr        error
+	rpcServer         *http.Server
+	rpcAddress        string
+
+	// handlers tracks the goroutines serving peers and mining
+	handlers sync.WaitGroup
+	// miningMu keeps blocks from being mined concurrently
+	miningMu sync.Mutex
+	// chainMu serializes the blocks added to the chain
+	chainMu sync.Mutex
+}
+
+// Open opens the blockchain DB of config. The node does not talk to peers
+// until Start.
+func Open(config Config) (*Node, error) {
+	if config.NodeID == "" && config.DBFile == "" {
+		return nil, errors.New("config needs a NodeID or a DBFile")
+	}
+	if config.MinerAddress != "" {
+		if err := checkAddress(config.MinerAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	bc, err := NewBlockchain(config.DBPath())
+	if err != nil {
+		return nil, err
+	}
+	if config.Network != "" && bc.Params().Name != config.Network {
+		bc.CloseDB()
+		return nil, fmt.Errorf("blockchain %s is on network %s, not %s", config.DBPath(), bc.Params().Name, config.Network)
+	}
+
+	n := newNode(config, bc)
+	if moved := bc.RehashedProblemGraphs(); moved > 0 {
+		n.logf("Rehashed %d problem graphs", moved)
+	}
+
+	return n, nil
+}
+
+func newNode(config Config, bc *Blockchain) *Node {
+	n := &Node{config: config, bc: bc, logger: config.Logger, events: newEventHub()}
+	if n.logger == nil {
+		n.logger = log.New(os.Stdout, "", 0)
+	}
+	n.address = config.ListenAddress
+	if n.address == "" {
+		n.address = fmt.Sprintf("localhost:%s", config.NodeID)
+	}
+	n.knownNodes = append([]string{}, config.Seeds...)
+	if config.Seeds == nil {
+		n.knownNodes = append([]string{}, defaultSeeds...)
+	}
+	n.mempool = make(map[string]Transaction)
+	n.miningAddress = config.MinerAddress
+	n.rpcToken = config.RPCToken
+	if n.rpcToken == "" && config.RPCAddress != "" {
+		n.rpcToken = NewRPCToken()
+	}
+
+	return n
+}
+
+// Start listens for peers and RPC requests, and announces the node to the
+// central node. It returns once the node is listening.
+func (n *Node) Start() error {
+	n.mu.Lock()
+	if n.listener != nil {
+		n.mu.Unlock()
+		return errors.New("node is already started")
+	}
+	ln, err := net.Listen(protocol, n.address)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	n.listener = ln
+	n.address = ln.Addr().String()
+	n.done = make(chan struct{})
+	n.serveErr = nil
+	n.mu.Unlock()
+
+	if err := n.startRPC(); err != nil {
+		n.mu.Lock()
+		n.listener, n.done = nil, nil
+		n.mu.Unlock()
+		ln.Close()
+		return err
+	}
+	if !n.isCentral() {
+		if seed := n.centralNode(); seed != "" {
+			n.sendVersion(seed)
+		}
+	}
+	go n.serve(ln)
+
+	return nil
+}
+
+// serve accepts peers until the listener is closed
+func (n *Node) serve(ln net.Listener) {
+	defer close(n.done)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			n.mu.Lock()
+			if n.listener != nil {
+				n.serveErr = err
+			}
+			n.mu.Unlock()
+			return
+		}
+		n.handlers.Add(1)
+		go func() {
+			defer n.handlers.Done()
+			n.handleConnection(conn)
+		}()
+	}
+}
+
+// Wait blocks until the node stops serving peers. It returns the error that
+// stopped it, or nil after Stop.
+func (n *Node) Wait() error {
+	n.mu.Lock()
+	done := n.done
+	n.mu.Unlock()
+	if done == nil {
+		return errors.New("node is not started")
+	}
+	<-done
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.serveErr
+}
+
+// Stop stops serving peers and waits for the requests and mining in progress
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	ln, done := n.listener, n.done
+	n.listener = nil
+	n.mu.Unlock()
+	if ln == nil {
+		return nil
+	}
+
+	err := ln.Close()
+	<-done
+	if rpcErr := n.stopRPC(); err == nil {
+		err = rpcErr
+	}
+	n.handlers.Wait()
+
+	return err
+}
+
+// Close stops the node and closes its blockchain DB
+func (n *Node) Close() error {
+	if err := n.Stop(); err != nil {
+		return err
+	}
+
+	return n.bc.db.Close()
+}
+
+// Address returns the address peers reach the node at
+func (n *Node) Address() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.address
+}
+
+// Peers returns the nodes the node knows about
+func (n *Node) Peers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string{}, n.knownNodes...)
+}
+
+// Blockchain returns the blockchain of the node
+func (n *Node) Blockchain() *Blockchain {
+	return n.bc
+}
+
+// BestHeight returns the height of the tip of the chain
+func (n *Node) BestHeight() (int, error) {
+	return n.bc.GetBestHeight()
+}
+
+// Block returns the block with the given hash
+func (n *Node) Block(hash []byte) (*Block, error) {
+	block, err := n.bc.GetBlockFromHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+// BlockAtHeight returns the block of the active chain at height
+func (n *Node) BlockAtHeight(height int) (*Block, error) {
+	block, err := n.bc.GetBlockFromHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+// Transaction returns a transaction of the active chain by its ID
+func (n *Node) Transaction(id []byte) (*Transaction, error) {
+	tx, err := n.bc.FindTransaction(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// Balance returns the value of the unspent outputs paying address
+func (n *Node) Balance(address string) (int, error) {
+	if err := checkAddress(address); err != nil {
+		return 0, err
+	}
+
+	outs, err := (UTXOSet{n.bc}).FindUTXO(addressHash(address))
+	if err != nil {
+		return 0, err
+	}
+	balance := 0
+	for _, out := range outs {
+		balance += out.Value
+	}
+
+	return balance, nil
+}
+
+// Mempool returns the transactions waiting to be mined
+func (n *Node) Mempool() []Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var txs []Transaction
+	for _, tx := range n.mempool {
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+// Submit adds a signed transaction to the mempool and announces it to the
+// peers. A mining node mines it together with the rest of the mempool.
+func (n *Node) Submit(tx *Transaction) error {
+	if err := n.acceptTransaction(tx, n.Address()); err != nil {
+		return err
+	}
+
+	if !n.isCentral() {
+		if seed := n.centralNode(); seed != "" {
+			n.sendInv(seed, "tx", [][]byte{tx.ID})
+		}
+	}
+
+	return nil
+}
+
+// acceptTransaction validates tx and adds it to the mempool. The central
+// node relays it to the other peers, and a mining node mines the mempool
+// once it holds two transactions.
+func (n *Node) acceptTransaction(tx *Transaction, from string) error {
+	if tx.IsCoinbase() {
+		return errors.New("coinbase transactions can't be submitted")
+	}
+	if !n.bc.VerifyTransaction(tx) {
+		return fmt.Errorf("transaction %x is not valid", tx.ID)
+	}
+	if err := n.bc.CheckTransactionLocksAtTip(tx); err != nil {
+		return err
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	n.mu.Lock()
+	_, known := n.mempool[txID]
+	n.mempool[txID] = *tx
+	poolSize := len(n.mempool)
+	miner := n.miningAddress
+	n.mu.Unlock()
+
+	if !known {
+		n.events.publish(Event{Type: EventTx, TxID: txID, txs: []*Transaction{tx}})
+	}
+
+	if n.isCentral() {
+		for _, node := range n.Peers() {
+			if node != n.Address() && node != from {
+				n.sendInv(node, "tx", [][]byte{tx.ID})
+			}
+		}
+	} else if poolSize >= 2 && miner != "" {
+		n.handlers.Add(1)
+		go func() {
+			defer n.handlers.Done()
+			n.mineMempool()
+		}()
+	}
+
+	return nil
+}
+
+// StartMining makes the node mine its mempool, rewarding address
+func (n *Node) StartMining(address string) error {
+	if err := checkAddress(address); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.miningAddress = address
+	n.mu.Unlock()
+
+	return nil
+}
+
+// StopMining stops mining the mempool. A block being mined is finished.
+func (n *Node) StopMining() {
+	n.mu.Lock()
+	n.miningAddress = ""
+	n.mu.Unlock()
+}
+
+// MiningAddress returns the address mining rewards go to, or "" when the node
+// does not mine
+func (n *Node) MiningAddress() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.miningAddress
+}
+
+// MineBlock mines the valid mempool transactions into a new block right away,
+// adds it to the chain and announces it to the peers
+func (n *Node) MineBlock(rewardAddress string) (*Block, error) {
+	if err := checkAddress(rewardAddress); err != nil {
+		return nil, err
+	}
+
+	n.miningMu.Lock()
+	defer n.miningMu.Unlock()
+
+	cbTx, err := NewCoinbaseTX(rewardAddress, "")
+	if err != nil {
+		return nil, err
+	}
+	txs := append(n.minableTransactions(), cbTx)
+
+	newBlock, err := n.bc.MineBlock(txs, []byte{}, []int{}, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	if err := n.addBlock(newBlock, nil); err != nil {
+		return nil, err
+	}
+	if err := (UTXOSet{n.bc}).Reindex(); err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	for _, tx := range newBlock.Transactions {
+		delete(n.mempool, hex.EncodeToString(tx.ID))
+	}
+	n.mu.Unlock()
+
+	for _, node := range n.Peers() {
+		if node != n.Address() {
+			n.sendInv(node, "block", [][]byte{newBlock.Hash})
+		}
+	}
+
+	return newBlock, nil
+}
+
+// mineMempool mines blocks until the mempool is empty or mining is stopped
+func (n *Node) mineMempool() {
+	for {
+		miner := n.MiningAddress()
+		if miner == "" || len(n.Mempool()) == 0 {
+			return
+		}
+		if len(n.minableTransactions()) == 0 {
+			n.logf("All transactions are invalid! Waiting for new ones...\n")
+			return
+		}
+		if _, err := n.MineBlock(miner); err != nil {
+			n.logf("ERROR: Mining failed: %s\n", err)
+			return
+		}
+		n.logf("New block is mined!\n")
+	}
+}
+
+// minableTransactions returns the mempool transactions that can go in the
+// next block
+func (n *Node) minableTransactions() []*Transaction {
+	var txs []*Transaction
+
+	for _, tx := range n.Mempool() {
+		tx := tx
+		if n.bc.VerifyTransaction(&tx) && n.bc.CheckTransactionLocksAtTip(&tx) == nil {
+			txs = append(txs, &tx)
+		}
+	}
+
+	return txs
+}
+
+// isCentral checks whether the node is the central node relaying transactions
+func (n *Node) isCentral() bool {
+	seed := n.centralNode()
+
+	return seed != "" && seed == n.Address()
+}
+
+func (n *Node) centralNode() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.knownNodes) == 0 {
+		return ""
+	}
+
+	return n.knownNodes[0]
+}
+
+func (n *Node) logf(format string, args ...interface{}) {
+	n.logger.Printf(format, args...)
+}
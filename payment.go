@@ -0,0 +1,133 @@
+package crickchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Payment pays Amount to Address. A non-zero LockTime keeps the recipient
+// from spending it before that block height or unix time.
+type Payment struct {
+	Address  string
+	Amount   int
+	LockTime int64
+}
+
+// TxPlan is a transaction before it is signed: the coins chosen to fund the
+// payments and the change going back to the sender
+type TxPlan struct {
+	From     string
+	Inputs   []Coin
+	Payments []Payment
+	Change   int
+}
+
+// PlanPayments chooses coins of address from to fund payments with selector
+func (u UTXOSet) PlanPayments(from string, payments []Payment, selector CoinSelector) (*TxPlan, error) {
+	if err := checkAddress(from); err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("no payments")
+	}
+	target := 0
+	for _, payment := range payments {
+		if err := checkAddress(payment.Address); err != nil {
+			return nil, err
+		}
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("amount paid to %s is not positive", payment.Address)
+		}
+		if payment.LockTime > 0 && IsScriptAddress(payment.Address) {
+			return nil, fmt.Errorf("timelocked payment to %s needs a pubkey hash recipient", payment.Address)
+		}
+		target += payment.Amount
+	}
+
+	coins, err := u.FindSpendableCoins(addressHash(from))
+	if err != nil {
+		return nil, err
+	}
+
+	// a transaction has a single lock time, so it can't spend outputs locked
+	// by height together with outputs locked by time
+	var inputs []Coin
+	for _, byTime := range []bool{false, true} {
+		inputs, err = selector.Select(coinsWithoutLocks(coins, !byTime), target)
+		if !errors.Is(err, ErrInsufficientFunds) && !errors.Is(err, ErrNoExactMatch) {
+			break
+		}
+	}
+	if errors.Is(err, ErrInsufficientFunds) {
+		available := 0
+		for _, coin := range coins {
+			available += coin.Value
+		}
+		return nil, &InsufficientFundsError{from, target, available}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, coin := range inputs {
+		total += coin.Value
+	}
+
+	return &TxPlan{from, inputs, payments, total - target}, nil
+}
+
+// coinsWithoutLocks leaves out the coins locked by time, or by height
+func coinsWithoutLocks(coins []Coin, byTime bool) []Coin {
+	var kept []Coin
+
+	for _, coin := range coins {
+		if coin.LockTime > 0 && (coin.LockTime >= lockTimeThreshold) == byTime {
+			continue
+		}
+		kept = append(kept, coin)
+	}
+
+	return kept
+}
+
+// Transaction returns the unsigned transaction of the plan
+func (p *TxPlan) Transaction() (*Transaction, error) {
+	var inputs []TXInput
+	var outputs []TXOutput
+
+	// spending timelocked outputs needs a matching transaction lock time
+	var lockTime int64
+	for _, coin := range p.Inputs {
+		if coin.LockTime > lockTime {
+			lockTime = coin.LockTime
+		}
+	}
+	sequence := uint32(maxSequence)
+	if lockTime > 0 {
+		sequence = maxSequence - 1
+	}
+
+	for _, coin := range p.Inputs {
+		inputs = append(inputs, TXInput{coin.TxID, coin.Vout, nil, sequence})
+	}
+	for _, payment := range p.Payments {
+		if payment.LockTime > 0 {
+			out, err := NewTimelockedTXOutput(payment.Amount, payment.Address, payment.LockTime)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, *out)
+		} else {
+			outputs = append(outputs, *NewTXOutput(payment.Amount, payment.Address))
+		}
+	}
+	if p.Change > 0 {
+		outputs = append(outputs, *NewTXOutput(p.Change, p.From)) // a change
+	}
+
+	tx := Transaction{nil, txVersion, inputs, outputs, lockTime}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
@@ -0,0 +1,142 @@
+package crickchain
+
+import (
+	"fmt"
+)
+
+// minInitialSolution is the size of the smallest initial solution a problem
+// graph can be posted with
+const minInitialSolution = 2
+
+// maxProblemNodes bounds the maxNodes of every network, so that a problem
+// graph encoding can be checked before its network is known
+const maxProblemNodes = 1 << 14
+
+// ProblemRules are the consensus rules a block introducing a problem graph
+// must follow. The density of a graph is its number of edges over the number
+// of pairs of nodes.
+type ProblemRules struct {
+	MinNodes   int     `yaml:"minNodes" json:"minNodes"`
+	MaxNodes   int     `yaml:"maxNodes" json:"maxNodes"`
+	MinDensity float64 `yaml:"minDensity" json:"minDensity"`
+	MaxDensity float64 `yaml:"maxDensity" json:"maxDensity"`
+}
+
+// defaultProblemRules returns the rules of the built-in network called name,
+// or of the main network. Networks stored or configured before the rules
+// existed get them.
+func defaultProblemRules(name string) ProblemRules {
+	if params, ok := Networks[name]; ok {
+		return params.Problems
+	}
+
+	return Networks[DefaultNetwork].Problems
+}
+
+// validate checks that the rules admit some graphs
+func (r ProblemRules) validate(network string) error {
+	switch {
+	case r.MinNodes < 2:
+		return fmt.Errorf("network %s: problems minNodes must be at least 2", network)
+	case r.MaxNodes < r.MinNodes:
+		return fmt.Errorf("network %s: problems maxNodes must be at least minNodes", network)
+	case r.MaxNodes > maxProblemNodes:
+		return fmt.Errorf("network %s: problems maxNodes must be at most %d", network, maxProblemNodes)
+	case r.MinDensity < 0 || r.MaxDensity > 1 || r.MinDensity > r.MaxDensity:
+		return fmt.Errorf("network %s: problems densities must be between 0 and 1, minDensity first", network)
+	}
+
+	return nil
+}
+
+// CheckSize checks that a graph of nodes nodes and edges edges can be
+// admitted
+func (r ProblemRules) CheckSize(nodes int, edges int) error {
+	if nodes < r.MinNodes || nodes > r.MaxNodes {
+		return fmt.Errorf("%w: %d nodes, problem graphs have from %d to %d nodes", ErrInvalidProblem, nodes, r.MinNodes, r.MaxNodes)
+	}
+	density := float64(edges) / (float64(nodes) * float64(nodes-1) / 2)
+	if density < r.MinDensity || density > r.MaxDensity {
+		return fmt.Errorf("%w: density %.3f, problem graphs have a density from %.3f to %.3f", ErrInvalidProblem, density, r.MinDensity, r.MaxDensity)
+	}
+
+	return nil
+}
+
+// checkNewProblem checks the problem graph a block introduces and returns it:
+// it must be generated from the parameters of the block, follow the size rules
+// of the chain, not be introduced by an ancestor of the block, and be posted
+// with an initial solution. Below SeededProblemsFrom, and for the graphs
+// migrated to canonical hashes, it can be a stored or fetched graph instead.
+func (bc *Blockchain) checkNewProblem(b *Block, fetched map[string]*ProblemGraph) (*ProblemGraph, error) {
+	var pg *ProblemGraph
+	if b.Problem != nil {
+		// the size is checked on the parameters, before generating the graph
+		if err := bc.params.Problems.CheckSize(b.Problem.Nodes, b.Problem.Edges); err != nil {
+			return nil, err
+		}
+		generated, err := b.generatedProblemGraph()
+		if err != nil {
+			return nil, err
+		}
+		pg = generated
+	} else {
+		if _, migrated := bc.problemAliases()[string(b.ProblemGraphHash)]; !migrated && b.Height >= bc.params.SeededProblemsFrom {
+			return nil, fmt.Errorf("%w: the block introducing problem graph %x doesn't commit to the parameters generating it", ErrInvalidProblem, b.ProblemGraphHash)
+		}
+		stored, err := bc.problemGraph(b.ProblemGraphHash, fetched)
+		if err != nil {
+			return nil, err
+		}
+		pg = &stored
+		// generated graphs are simple, stored ones may not be
+		if simple, _ := pg.Graph.IsSimple(); !simple {
+			return nil, fmt.Errorf("%w: problem graph %x has loops or parallel edges", ErrInvalidProblem, pg.Hash)
+		}
+		if err := bc.params.Problems.CheckSize(pg.Graph.Order(), pg.Graph.Size()); err != nil {
+			return nil, err
+		}
+	}
+
+	if bc.problemIntroducedBefore(pg.Hash, b.PrevBlockHash) {
+		return nil, fmt.Errorf("%w: problem graph %x is already in the chain", ErrInvalidProblem, pg.Hash)
+	}
+
+	if !Equal(b.SolutionHash, b.ProblemGraphHash) {
+		return nil, fmt.Errorf("%w: problem graph %x is not posted with an initial solution", ErrInvalidProblem, pg.Hash)
+	}
+	if len(b.Solution) < minInitialSolution {
+		return nil, fmt.Errorf("%w: the initial solution of problem graph %x has less than %d nodes", ErrInvalidProblem, pg.Hash, minInitialSolution)
+	}
+	seen := make(map[int]bool)
+	for _, n := range b.Solution {
+		if n < 0 || n >= pg.Graph.Order() || seen[n] {
+			return nil, fmt.Errorf("%w: the initial solution of problem graph %x has a duplicate or unknown node %d", ErrInvalidProblem, pg.Hash, n)
+		}
+		seen[n] = true
+	}
+	if !pg.ValidateClique(b.Solution) {
+		return nil, fmt.Errorf("%w: the initial solution of problem graph %x is not a clique", ErrInvalidProblem, pg.Hash)
+	}
+
+	return pg, nil
+}
+
+// problemIntroducedBefore tells if the block with hash blockHash or one of its
+// ancestors introduces the problem graph with canonical hash pgHash
+func (bc *Blockchain) problemIntroducedBefore(pgHash []byte, blockHash []byte) bool {
+	aliases := bc.problemAliases()
+
+	for len(blockHash) > 0 {
+		block, err := bc.GetBlockFromHash(blockHash)
+		if err != nil {
+			return false
+		}
+		if len(block.ProblemGraphHash) > 0 && Equal(canonicalProblemHash(aliases, block.ProblemGraphHash), pgHash) {
+			return true
+		}
+		blockHash = block.PrevBlockHash
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package crickchain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/soniakeys/graph"
+)
+
+// problemSeedTag separates problem seeds from other hashes of block hashes
+const problemSeedTag = "crickchain problem seed"
+
+// ProblemParams are what a block commits to for a problem graph generated
+// from the seed of its parent: the graph is regenerated from them.
+type ProblemParams struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+}
+
+// ProblemSeed returns the seed of the problem graphs introduced by the child
+// of the block with hash prevBlockHash: SHA-256 of problemSeedTag followed by
+// the hash. Miners can't choose it, so they can't grind graphs with easy
+// cliques.
+func ProblemSeed(prevBlockHash []byte) []byte {
+	seed := sha256.Sum256(append([]byte(problemSeedTag), prevBlockHash...))
+
+	return seed[:]
+}
+
+// problemRand is the PRNG problem graphs are generated with. It is SHA-256 in
+// counter mode: block i of the stream is SHA-256(seed || i), i as 8 bytes big
+// endian, read as 4 numbers of 8 bytes big endian.
+type problemRand struct {
+	seed    []byte
+	counter uint64
+	block   [sha256.Size]byte
+	next    int
+}
+
+func newProblemRand(seed []byte) *problemRand {
+	return &problemRand{seed: seed, next: sha256.Size}
+}
+
+// Uint64 returns the next number of the stream
+func (r *problemRand) Uint64() uint64 {
+	if r.next == sha256.Size {
+		data := binary.BigEndian.AppendUint64(append([]byte{}, r.seed...), r.counter)
+		r.block = sha256.Sum256(data)
+		r.counter++
+		r.next = 0
+	}
+	v := binary.BigEndian.Uint64(r.block[r.next:])
+	r.next += 8
+
+	return v
+}
+
+// Uint64n returns a uniform number in [0, n). Numbers of the stream at or
+// above the largest multiple of n are skipped, so there is no modulo bias.
+func (r *problemRand) Uint64n(n uint64) uint64 {
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if v := r.Uint64(); v < limit {
+			return v % n
+		}
+	}
+}
+
+// GenerateProblemGraph generates a graph with nodes nodes and edges edges
+// from seed. The pairs of nodes (u, v) with u < v are numbered in
+// lexicographic order, and edges of them are picked with a partial
+// Fisher-Yates shuffle driven by problemRand: the i-th pick swaps pair i with
+// pair i + Uint64n(pairs - i).
+func GenerateProblemGraph(seed []byte, nodes int, edges int) (*ProblemGraph, error) {
+	if nodes < 2 {
+		return nil, fmt.Errorf("%w: a problem graph needs at least 2 nodes", ErrInvalidProblem)
+	}
+	pairs := uint64(nodes) * uint64(nodes-1) / 2
+	if edges < 0 || uint64(edges) > pairs {
+		return nil, fmt.Errorf("%w: %d edges don't fit in a graph of %d nodes", ErrInvalidProblem, edges, nodes)
+	}
+
+	// rowStart[u] is the number of the pair (u, u+1)
+	rowStart := make([]uint64, nodes)
+	for u := 1; u < nodes; u++ {
+		rowStart[u] = rowStart[u-1] + uint64(nodes-u)
+	}
+
+	r := newProblemRand(seed)
+	swapped := make(map[uint64]uint64)
+	at := func(i uint64) uint64 {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+
+	g := graph.Undirected{AdjacencyList: make(graph.AdjacencyList, nodes)}
+	for i := uint64(0); i < uint64(edges); i++ {
+		j := i + r.Uint64n(pairs-i)
+		pair := at(j)
+		swapped[j] = at(i)
+
+		u := sort.Search(nodes, func(u int) bool { return rowStart[u] > pair }) - 1
+		v := u + 1 + int(pair-rowStart[u])
+		g.AddEdge(graph.NI(u), graph.NI(v))
+	}
+
+	pg := ProblemGraph{Graph: &g, Seed: seed, verifier: &lazyVerifier{}}
+	pg.Hash = pg.GetHash()
+
+	return &pg, nil
+}
+
+// NewProblemGraph generates a graph with nodes nodes and edges edges from a
+// random seed, kept in the graph so that it can be reproduced
+func NewProblemGraph(nodes int, edges int) (*ProblemGraph, error) {
+	seed := make([]byte, sha256.Size)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	return GenerateProblemGraph(seed, nodes, edges)
+}
+
+// generatedProblemGraph regenerates the problem graph a block introduces from
+// its parameters and the seed of its parent, and checks it is the one the
+// block refers to
+func (b *Block) generatedProblemGraph() (*ProblemGraph, error) {
+	if b.Problem == nil {
+		return nil, fmt.Errorf("%w: block %x doesn't commit to problem parameters", ErrInvalidProblem, b.Hash)
+	}
+	pg, err := GenerateProblemGraph(ProblemSeed(b.PrevBlockHash), b.Problem.Nodes, b.Problem.Edges)
+	if err != nil {
+		return nil, err
+	}
+	if !Equal(pg.Hash, b.ProblemGraphHash) {
+		return nil, fmt.Errorf("%w: problem graph %x isn't generated by the parameters of block %x", ErrInvalidProblem, b.ProblemGraphHash, b.Hash)
+	}
+
+	return pg, nil
+}
+
+// NextProblemGraph generates a graph from the seed of the tip, to be
+// introduced by the next block with MineProblemBlock
+func (bc *Blockchain) NextProblemGraph(nodes int, edges int) (*ProblemGraph, error) {
+	return GenerateProblemGraph(ProblemSeed(bc.tip), nodes, edges)
+}
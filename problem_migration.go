@@ -0,0 +1,91 @@
+package crickchain
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// problemAliasesBucket maps the hashes problem graphs had before canonical
+// hashing to their canonical hashes, for the blocks that refer to them. Its
+// existence tells that the problems bucket is migrated.
+const problemAliasesBucket = "problemAliases"
+
+// migrateProblemGraphs rekeys the problem graphs stored under a
+// non-canonical hash, and returns how many it moved. The old hashes stay
+// valid through the aliases since blocks can't be changed.
+func migrateProblemGraphs(db *bolt.DB) (int, error) {
+	moved := 0
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(problemAliasesBucket)) != nil {
+			return nil
+		}
+		aliases, err := tx.CreateBucket([]byte(problemAliasesBucket))
+		if err != nil {
+			return err
+		}
+		problems := tx.Bucket([]byte(problemsBucket))
+		if problems == nil {
+			return nil
+		}
+
+		// keys can't be changed while iterating
+		stored := make(map[string]*ProblemGraph)
+		err = problems.ForEach(func(k, v []byte) error {
+			stored[string(k)] = DeserializeProblemGraph(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for key, pg := range stored {
+			pg.Hash = pg.GetHash()
+			if key == string(pg.Hash) {
+				continue
+			}
+			if err := problems.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := problems.Put(pg.Hash, pg.Serialize()); err != nil {
+				return err
+			}
+			if err := aliases.Put([]byte(key), pg.Hash); err != nil {
+				return err
+			}
+			moved++
+		}
+
+		return nil
+	})
+
+	return moved, err
+}
+
+// problemAliases returns the canonical hashes of the old problem graph
+// hashes
+func (bc *Blockchain) problemAliases() map[string][]byte {
+	aliases := make(map[string][]byte)
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(problemAliasesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			aliases[string(k)] = append([]byte{}, v...)
+			return nil
+		})
+	})
+
+	return aliases
+}
+
+// canonicalProblemHash returns the canonical hash of a problem graph hash
+// found in a block
+func canonicalProblemHash(aliases map[string][]byte, hash []byte) []byte {
+	if canonical, ok := aliases[string(hash)]; ok {
+		return canonical
+	}
+
+	return hash
+}
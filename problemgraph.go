@@ -1,13 +1,17 @@
 package crickchain
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"encoding/binary"
 	"encoding/gob"
 	"crypto/sha256"
 	"bytes"
+	"errors"
+	"sort"
 	"strconv"
-	"encoding/json"
 	"github.com/soniakeys/graph"
 	"github.com/soniakeys/bits"
 	//"github.com/boltdb/bolt"
@@ -17,92 +21,110 @@ import (
 type ProblemGraph struct {
 	Hash 	[]byte
 	Graph 	*graph.Undirected
+	// Seed is the seed the graph was generated from, if known
+	Seed 	[]byte
+
+	verifier *lazyVerifier
 }
 
+// problemGraphEncodingVersion starts the canonical encoding of a graph
+const problemGraphEncodingVersion = 1
 
-func NewProblemGraph(nodes int, edges int) *ProblemGraph {
-	// g := graph.Undirected{make(graph.AdjacencyList, 3)} // 3 nodes altogether
-	// g.AddEdge(0, 1)
-	// g.AddEdge(1, 2)
-	// g.AddEdge(2, 0)
-	g := graph.GnmUndirected(nodes, edges, nil)
-	pg := ProblemGraph{[]byte{}, &g}
-	pg.Hash = pg.GetHash()
-	return &pg
+// GetHash returns the identity of the graph, the hash of its canonical
+// encoding
+func (pg *ProblemGraph) GetHash() []byte {
+	hash := sha256.Sum256(pg.CanonicalEncoding())
+
+	return hash[:]
 }
 
-// Hash the graph
-func (pg *ProblemGraph) GetHash() []byte {
-    arrBytes := []byte{}
-    jsonBytes, _ := json.Marshal(pg)
-    arrBytes = append(arrBytes, jsonBytes...)
-    
+// CanonicalEncoding encodes the graph independently of how it is stored: a
+// version byte, the number of nodes and of edges, then the edges sorted as
+// pairs of nodes (n, m) with n <= m, all numbers as 4 bytes big endian.
+func (pg *ProblemGraph) CanonicalEncoding() []byte {
+	var edges [][2]uint32
+	for n, to := range pg.Graph.AdjacencyList {
+		for _, m := range to {
+			if n <= int(m) {
+				edges = append(edges, [2]uint32{uint32(n), uint32(m)})
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
 
-	hash := sha256.Sum256(arrBytes)
+	data := make([]byte, 9, 9+8*len(edges))
+	data[0] = problemGraphEncodingVersion
+	binary.BigEndian.PutUint32(data[1:], uint32(pg.Graph.Order()))
+	binary.BigEndian.PutUint32(data[5:], uint32(len(edges)))
+	for _, edge := range edges {
+		data = binary.BigEndian.AppendUint32(data, edge[0])
+		data = binary.BigEndian.AppendUint32(data, edge[1])
+	}
 
-	return hash[:]
+	return data
+}
+
+// DecodeProblemGraph builds a graph from its canonical encoding. The encoding
+// must be canonical itself, with sorted edges, so that it matches the hash.
+func DecodeProblemGraph(data []byte) (*ProblemGraph, error) {
+	if len(data) < 9 || data[0] != problemGraphEncodingVersion {
+		return nil, errors.New("not a problem graph encoding")
+	}
+	nodes := binary.BigEndian.Uint32(data[1:])
+	edges := binary.BigEndian.Uint32(data[5:])
+	if uint64(len(data)) != 9+8*uint64(edges) {
+		return nil, errors.New("problem graph encoding has a wrong length")
+	}
+	if nodes > maxProblemNodes {
+		return nil, fmt.Errorf("problem graph encoding has %d nodes, more than any network admits", nodes)
+	}
+
+	g := graph.Undirected{AdjacencyList: make(graph.AdjacencyList, nodes)}
+	var prev [2]uint32
+	for i := 0; i < int(edges); i++ {
+		edge := [2]uint32{binary.BigEndian.Uint32(data[9+8*i:]), binary.BigEndian.Uint32(data[13+8*i:])}
+		if edge[0] > edge[1] || edge[1] >= nodes {
+			return nil, fmt.Errorf("invalid edge %d-%d", edge[0], edge[1])
+		}
+		if i > 0 && (edge[0] < prev[0] || edge[0] == prev[0] && edge[1] < prev[1]) {
+			return nil, errors.New("problem graph edges are not sorted")
+		}
+		g.AddEdge(graph.NI(edge[0]), graph.NI(edge[1]))
+		prev = edge
+	}
+
+	pg := ProblemGraph{Graph: &g, verifier: &lazyVerifier{}}
+	pg.Hash = pg.GetHash()
+
+	return &pg, nil
 }
 
 
-//FindCliques finds all k-cliques and returns them
+//FindAllKCliques finds all k-cliques, the sub-cliques of larger ones included, each once with its nodes in increasing order
 func (pg *ProblemGraph) FindAllKCliques(k int) [][]int {
 	//we check that we have a siple (not loops nor parallels) graph
 	simple, _ := pg.Graph.IsSimple()
-	if !simple {
+	if !simple || k <= 0 {
 		return [][]int{}
 	}
 
-	kCliques := [][]int{}
-	//pg.Graph.BKPivotMaxDegree, 
-	pg.Graph.BronKerbosch1(func(c bits.Bits) bool {
-		clique := c.Slice()
-    	if len(clique) == k {
-    		kCliques = append(kCliques, clique)
-    	} else if len(clique) > k + 4 { //this +4 is arbitrary. The problem is that if the cliques is a sub-clique, is not found unless we return false here for the size of the parent clique
-    		return false
-    	}
-    	return true
-	})
-	return kCliques
+	return allKCliques(pg.Verifier(), k)
 }
 
-//FindClique finds one at least k-clique and returns it
+//FindClique finds one at least k-clique and returns it, with the built-in solver
 func (pg *ProblemGraph) FindKClique(k int) []int {
-	//we check that we have a siple (not loops nor parallels) graph
-	simple, _ := pg.Graph.IsSimple()
-	if !simple {
-		return []int{}
-	}
-
-	kClique := []int{}
-	//pg.Graph.BKPivotMaxDegree
-	pg.Graph.BronKerbosch1(func(c bits.Bits) bool {
-		clique := c.Slice()
-    	if len(clique) >= k {
-    		kClique = clique
-    		return false
-    	} else if len(clique) > k {
-    		return false
-    	}
-    	return true
-	})
+	kClique, _ := BronKerboschSolver{}.FindKClique(context.Background(), pg, k)
 	return kClique
 }
 
-//ValidateClique checks that the input is a clique of the graph
+//ValidateClique checks that the input is a clique of distinct nodes of the graph, without changing it
 func (pg *ProblemGraph) ValidateClique(clique []int) bool {
-	for _, n := range clique {
-		for _, m := range clique {
-    		if n != m {
-    			if !pg.Graph.RemoveEdge(graph.NI(n), graph.NI(m)) {//return false if the edge is not present
-    				return false
-    			} else {//this is probably not important, since we dont care about this pg instance
-    				pg.Graph.AddEdge(graph.NI(n), graph.NI(m))
-    			}
-    		}
-		}	
-	}
-	return true
+	return pg.Verifier().IsClique(clique)
 }
 
 //FindClique finds all max-cliques and returns them. This scales exponentially (it's Np complete)
@@ -130,14 +152,14 @@ func (pg *ProblemGraph) FindMaxClique() [][]int {
 }
 
 //NicePrint print nicely the graph properties
-func (pg *ProblemGraph) NicePrint(bc *Blockchain) {
-	fmt.Printf("\n")
-	printBlue(fmt.Sprintf("Hash: %x\n",pg.Hash))
+func (pg *ProblemGraph) NicePrint(w io.Writer, bc *Blockchain) {
+	fmt.Fprintf(w, "\n")
+	printBlue(w, fmt.Sprintf("Hash: %x\n",pg.Hash))
 	// for fr, to := range pg.Graph.AdjacencyList {
  //    	fmt.Println(fr, to)
 	// }
 	connected := pg.Graph.IsConnected()
-	printGreen(fmt.Sprintf("Connected: %s\n", strconv.FormatBool(connected)))
+	printGreen(w, fmt.Sprintf("Connected: %s\n", strconv.FormatBool(connected)))
 	// for k := 3; k <= 8; k++ {
 	// 	kcliques := pg.FindAllKCliques(k)
 	// 	printYellow(fmt.Sprintf("%d %d-cliques:",len(kcliques), k))
@@ -146,9 +168,18 @@ func (pg *ProblemGraph) NicePrint(bc *Blockchain) {
 	// 	}
 	// 	fmt.Print("\n")
 	// }
-	bsol := bc.GetBestSolution(pg, bc.GetBestHeight())
-	printYellow(fmt.Sprintf("Best solution: %d-clique:",len(bsol)))
-	fmt.Println(bsol)
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Fprintln(w, "ERROR:", err)
+		return
+	}
+	bsol, err := bc.GetBestSolution(pg, height)
+	if err != nil {
+		fmt.Fprintln(w, "ERROR:", err)
+		return
+	}
+	printYellow(w, fmt.Sprintf("Best solution: %d-clique:",len(bsol)))
+	fmt.Fprintln(w, bsol)
 }
 
 // Serialize serializes the graph
@@ -173,6 +204,7 @@ func DeserializeProblemGraph(d []byte) *ProblemGraph {
 	if err != nil {
 		log.Panic(err)
 	}
+	g.verifier = &lazyVerifier{}
 
 	return &g
 }
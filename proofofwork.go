@@ -51,6 +51,12 @@ func (pow *ProofOfWork) prepareData(nonce int) []byte {
 		},
 		[]byte{},
 	)
+	// the problem parameters are only hashed when set, which keeps the
+	// hashes of blocks without them
+	if pow.block.Problem != nil {
+		data = append(data, IntToHex(int64(pow.block.Problem.Nodes))...)
+		data = append(data, IntToHex(int64(pow.block.Problem.Edges))...)
+	}
 
 	return data
 }
@@ -73,7 +79,6 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 			nonce++
 		}
 	}
-	fmt.Print("\n\n")
 
 	return nonce, hash[:]
 }
@@ -0,0 +1,223 @@
+package crickchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Prevout is the output an input of a raw transaction spends
+type Prevout struct {
+	Value        int
+	ScriptPubKey []byte
+}
+
+// RawTransaction is a transaction together with the outputs its inputs
+// spend, so that a node without the blockchain can sign it. Its portable form
+// is the hex encoding of its gob serialization.
+type RawTransaction struct {
+	Tx       Transaction
+	Prevouts []Prevout
+}
+
+// NewRawTransaction builds the unsigned raw transaction of a plan
+func NewRawTransaction(plan *TxPlan, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	tx, err := plan.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	raw := RawTransaction{Tx: *tx}
+
+	for _, vin := range raw.Tx.Vin {
+		prevTX, err := UTXOSet.Blockchain.FindTransaction(vin.Txid)
+		if err != nil {
+			return nil, err
+		}
+		out := prevTX.Vout[vin.Vout]
+		raw.Prevouts = append(raw.Prevouts, Prevout{out.Value, out.ScriptPubKey})
+	}
+
+	return &raw, nil
+}
+
+// Encode returns the portable form of a raw transaction
+func (raw RawTransaction) Encode() string {
+	var encoded bytes.Buffer
+
+	enc := gob.NewEncoder(&encoded)
+	err := enc.Encode(raw)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return hex.EncodeToString(encoded.Bytes())
+}
+
+// DecodeRawTransaction parses the portable form of a raw transaction
+func DecodeRawTransaction(encoded string) (*RawTransaction, error) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw RawTransaction
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Tx.Vin) == 0 {
+		return nil, errors.New("raw transaction has no inputs")
+	}
+	if len(raw.Prevouts) != len(raw.Tx.Vin) {
+		return nil, errors.New("raw transaction needs one prevout per input")
+	}
+
+	return &raw, nil
+}
+
+// prevTXs returns stand-ins for the spent transactions, holding only the spent outputs
+func (raw RawTransaction) prevTXs() map[string]Transaction {
+	prevTXs := make(map[string]Transaction)
+
+	for inID, vin := range raw.Tx.Vin {
+		key := hex.EncodeToString(vin.Txid)
+		prevTX := prevTXs[key]
+		prevTX.ID = vin.Txid
+		for len(prevTX.Vout) <= vin.Vout {
+			prevTX.Vout = append(prevTX.Vout, TXOutput{})
+		}
+		prevTX.Vout[vin.Vout] = TXOutput{raw.Prevouts[inID].Value, raw.Prevouts[inID].ScriptPubKey}
+		prevTXs[key] = prevTX
+	}
+
+	return prevTXs
+}
+
+// IsComplete checks whether the raw transaction has inputs and every one is
+// validly signed
+func (raw RawTransaction) IsComplete() bool {
+	return len(raw.Tx.Vin) > 0 && raw.Tx.Verify(raw.prevTXs())
+}
+
+// InputValue returns the value of the outputs the raw transaction spends, as
+// its prevouts claim: the signatures don't commit to it
+func (raw RawTransaction) InputValue() int {
+	total := 0
+	for _, prevout := range raw.Prevouts {
+		total += prevout.Value
+	}
+
+	return total
+}
+
+// SignRawTransaction adds the signatures the wallets can make to a raw
+// transaction. Multisig inputs keep the signatures of other signers, so that
+// several wallets can sign in turn. It returns the number of signatures added.
+func (ws *Wallets) SignRawTransaction(raw *RawTransaction) (int, error) {
+	added := 0
+
+	for inID, prevout := range raw.Prevouts {
+		script := prevout.ScriptPubKey
+		if isP2SHScript(script) {
+			redeemScript := ws.GetRedeemScript(outputAddress(TXOutput{prevout.Value, script}))
+			if redeemScript == nil {
+				continue
+			}
+			n, err := ws.signMultisigInput(&raw.Tx, inID, redeemScript)
+			if err != nil {
+				return added, err
+			}
+			added += n
+			continue
+		}
+
+		if !pubKeyHashScript(script) || len(raw.Tx.Vin[inID].ScriptSig) > 0 {
+			continue
+		}
+		lockHash := ScriptLockHash(script)
+		for _, wallet := range ws.Wallets {
+			if !bytes.Equal(HashPubKey(wallet.PublicKey), lockHash) {
+				continue
+			}
+			signature, err := raw.Tx.SignInput(inID, wallet.PrivateKey, script, SigHashAll)
+			if err != nil {
+				return added, err
+			}
+			raw.Tx.Vin[inID].ScriptSig = append(scriptPush(signature), scriptPush(wallet.PublicKey)...)
+			added++
+			break
+		}
+	}
+
+	return added, nil
+}
+
+// signMultisigInput merges the signatures of the wallet keys into the
+// signatures already in the scriptSig of a P2SH multisig input, in the order
+// of the keys in the redeem script
+func (ws *Wallets) signMultisigInput(tx *Transaction, inID int, redeemScript []byte) (int, error) {
+	m, pubKeys, ok := ParseMultisigScript(redeemScript)
+	if !ok {
+		return 0, errors.New("redeem script is not a multisig script")
+	}
+	hash, err := tx.SignatureHash(inID, redeemScript, SigHashAll)
+	if err != nil {
+		return 0, err
+	}
+
+	sigs := make([][]byte, len(pubKeys))
+	have := 0
+	if existing := tx.Vin[inID].ScriptSig; len(existing) > 0 {
+		ops, err := parseScript(existing)
+		if err != nil || len(ops) == 0 {
+			return 0, fmt.Errorf("input %d has a malformed scriptSig", inID)
+		}
+		for _, op := range ops[:len(ops)-1] {
+			_, r, s, err := parseSignature(op.data)
+			if err != nil {
+				continue
+			}
+			for i, pubKey := range pubKeys {
+				if sigs[i] == nil && verifyHashSignature(hash, r, s, pubKey) {
+					sigs[i] = op.data
+					have++
+					break
+				}
+			}
+		}
+	}
+
+	added := 0
+	for i, pubKey := range pubKeys {
+		if have+added >= m {
+			break
+		}
+		if sigs[i] != nil {
+			continue
+		}
+		for _, wallet := range ws.Wallets {
+			if !bytes.Equal(wallet.PublicKey, pubKey) {
+				continue
+			}
+			sigs[i], err = tx.SignInput(inID, wallet.PrivateKey, redeemScript, SigHashAll)
+			if err != nil {
+				return added, err
+			}
+			added++
+			break
+		}
+	}
+
+	var scriptSig []byte
+	for _, sig := range sigs {
+		if sig != nil {
+			scriptSig = append(scriptSig, scriptPush(sig)...)
+		}
+	}
+	tx.Vin[inID].ScriptSig = append(scriptSig, scriptPush(redeemScript)...)
+
+	return added, nil
+}
@@ -0,0 +1,659 @@
+package crickchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcNodeError is returned when the node refuses a request, like an
+	// invalid transaction or an unknown block
+	rpcNodeError = -32000
+)
+
+// maxRPCRequestSize bounds the body of an RPC request
+const maxRPCRequestSize = 1 << 20
+
+// RPCError is the error member of a JSON-RPC response
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcMethod answers a method call. params is a JSON object, positional
+// parameters being named after paramNames.
+type rpcMethod struct {
+	paramNames []string
+	call       func(n *Node, params json.RawMessage) (interface{}, error)
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"getbestheight":      {nil, rpcGetBestHeight},
+	"getblock":           {[]string{"block"}, rpcGetBlock},
+	"getblocks":          {[]string{"height", "count"}, rpcGetBlocks},
+	"gettransaction":     {[]string{"txid"}, rpcGetTransaction},
+	"getdifficulty":      {nil, rpcGetDifficulty},
+	"getproblem":         {[]string{"hash", "graph"}, rpcGetProblem},
+	"getproblems":        {nil, rpcGetProblems},
+	"getbalance":         {[]string{"address"}, rpcGetBalance},
+	"getaddress":         {[]string{"address"}, rpcGetAddress},
+	"sendrawtransaction": {[]string{"hex"}, rpcSendRawTransaction},
+	"getmempool":         {[]string{"verbose"}, rpcGetMempool},
+	"startmining":        {[]string{"address"}, rpcStartMining},
+	"stopmining":         {nil, rpcStopMining},
+	"getmininginfo":      {nil, rpcGetMiningInfo},
+	"getpeerinfo":        {nil, rpcGetPeerInfo},
+}
+
+// RPCServer serves the JSON-RPC 2.0 API of a node over HTTP. Every request
+// must carry the token as "Authorization: Bearer TOKEN".
+type RPCServer struct {
+	node  *Node
+	token string
+}
+
+// NewRPCServer returns the API of node, guarded by token
+func NewRPCServer(node *Node, token string) *RPCServer {
+	return &RPCServer{node, token}
+}
+
+// NewRPCToken returns a random token for the RPC server
+func NewRPCToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(token)
+}
+
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests are POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkRPCToken(r, "", s.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid RPC token", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var result interface{}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			result = rpcErrorResponse(nil, rpcInvalidRequest, "invalid batch")
+		} else {
+			var responses []*rpcResponse
+			for _, request := range batch {
+				if response := s.handle(request); response != nil {
+					responses = append(responses, response)
+				}
+			}
+			if len(responses) > 0 {
+				result = responses
+			}
+		}
+	} else if response := s.handle(body); response != nil {
+		result = response
+	}
+
+	if result == nil {
+		// only notifications, which get no response
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// checkRPCToken tells whether a request carries token, as given or else as
+// a bearer token
+func checkRPCToken(r *http.Request, given, token string) bool {
+	if given == "" {
+		given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// handle answers a single request, or returns nil for a notification
+func (s *RPCServer) handle(data []byte) *rpcResponse {
+	var request rpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return rpcErrorResponse(nil, rpcParseError, err.Error())
+		}
+		return rpcErrorResponse(nil, rpcInvalidRequest, err.Error())
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return rpcErrorResponse(request.ID, rpcInvalidRequest, "not a JSON-RPC 2.0 request")
+	}
+
+	result, err := s.call(request.Method, request.Params)
+	if request.ID == nil {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{rpcNodeError, err.Error()}
+		}
+		return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: request.ID}
+	}
+
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: request.ID}
+}
+
+func (s *RPCServer) call(name string, params json.RawMessage) (interface{}, error) {
+	method, ok := rpcMethods[name]
+	if !ok {
+		return nil, &RPCError{rpcMethodNotFound, fmt.Sprintf("method %s not found", name)}
+	}
+	params, err := namedParams(params, method.paramNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return method.call(s.node, params)
+}
+
+// namedParams turns positional params into an object keyed by names
+func namedParams(params json.RawMessage, names []string) (json.RawMessage, error) {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return json.RawMessage("{}"), nil
+	}
+	if params[0] != '[' {
+		return params, nil
+	}
+
+	var positional []json.RawMessage
+	if err := json.Unmarshal(params, &positional); err != nil {
+		return nil, &RPCError{rpcInvalidParams, err.Error()}
+	}
+	if len(positional) > len(names) {
+		return nil, &RPCError{rpcInvalidParams, fmt.Sprintf("expected at most %d params", len(names))}
+	}
+	named := make(map[string]json.RawMessage)
+	for i, param := range positional {
+		named[names[i]] = param
+	}
+
+	return json.Marshal(named)
+}
+
+func rpcErrorResponse(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &rpcResponse{JSONRPC: "2.0", Error: &RPCError{code, message}, ID: id}
+}
+
+// decodeParams decodes the params object into v
+func decodeParams(params json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &RPCError{rpcInvalidParams, err.Error()}
+	}
+
+	return nil
+}
+
+func rpcGetBestHeight(n *Node, params json.RawMessage) (interface{}, error) {
+	return n.BestHeight()
+}
+
+// rpcGetBlock finds a block by its height, given as a number, or its hash
+func rpcGetBlock(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Block json.RawMessage `json:"block"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	var block *Block
+	var height int
+	var hash string
+	var err error
+	if json.Unmarshal(p.Block, &height) == nil {
+		block, err = n.BlockAtHeight(height)
+	} else if json.Unmarshal(p.Block, &hash) == nil {
+		h, decodeErr := hex.DecodeString(hash)
+		if decodeErr != nil {
+			return nil, &RPCError{rpcInvalidParams, "block hash is not hex"}
+		}
+		block, err = n.Block(h)
+	} else {
+		return nil, &RPCError{rpcInvalidParams, "block is a height or a hash"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlockJSON(block, n.bc), nil
+}
+
+type blockSummaryJSON struct {
+	Hash         string `json:"hash"`
+	Height       int    `json:"height"`
+	Timestamp    int64  `json:"timestamp"`
+	Difficulty   string `json:"difficulty"`
+	Transactions int    `json:"transactions"`
+	SolutionHash string `json:"solutionHash,omitempty"`
+	ProblemHash  string `json:"problemHash,omitempty"`
+}
+
+// maxGetBlocks bounds the count of getblocks
+const maxGetBlocks = 100
+
+// rpcGetBlocks lists count blocks, 20 by default and at most maxGetBlocks,
+// going down from height, the tip by default
+func rpcGetBlocks(n *Node, params json.RawMessage) (interface{}, error) {
+	p := struct {
+		Height *int `json:"height"`
+		Count  int  `json:"count"`
+	}{Count: 20}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Count > maxGetBlocks {
+		return nil, &RPCError{rpcInvalidParams, fmt.Sprintf("count must be at most %d", maxGetBlocks)}
+	}
+	// the hashes of the active chain are read once, tip first
+	hashes := n.bc.GetBlockHashes()
+	height := len(hashes) - 1
+	if p.Height != nil && *p.Height < height {
+		height = *p.Height
+	}
+
+	blocks := []blockSummaryJSON{}
+	for ; height >= 0 && len(blocks) < p.Count; height-- {
+		block, err := n.bc.GetBlockFromHash(hashes[len(hashes)-1-height])
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, blockSummaryJSON{
+			Hash:         hex.EncodeToString(block.Hash),
+			Height:       block.Height,
+			Timestamp:    block.Timestamp,
+			Difficulty:   targetToDifficulty(block.Target).String(),
+			Transactions: len(block.Transactions),
+			SolutionHash: hex.EncodeToString(block.SolutionHash),
+			ProblemHash:  hex.EncodeToString(block.ProblemGraphHash),
+		})
+	}
+
+	return blocks, nil
+}
+
+// rpcGetTransaction finds a transaction of the active chain and its block
+func rpcGetTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		TxID string `json:"txid"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	id, err := hex.DecodeString(p.TxID)
+	if err != nil {
+		return nil, &RPCError{rpcInvalidParams, "txid is not hex"}
+	}
+
+	block, err := n.bc.findTransactionBlock(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range block.Transactions {
+		if Equal(tx.ID, id) {
+			return struct {
+				transactionJSON
+				BlockHash string `json:"blockHash"`
+				Height    int    `json:"height"`
+			}{newTransactionJSON(tx), hex.EncodeToString(block.Hash), block.Height}, nil
+		}
+	}
+
+	return nil, ErrTransactionNotFound
+}
+
+type addressTxJSON struct {
+	TxID     string `json:"txid"`
+	Height   int    `json:"height"`
+	Received int    `json:"received"`
+	Sent     int    `json:"sent"`
+}
+
+// rpcGetAddress returns the balance of an address and the transactions of
+// the active chain paying or spending it, newest first
+func rpcGetAddress(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Address string `json:"address"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	balance, err := n.Balance(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// the blocks are read oldest first, so that outputs come before their
+	// spends, and the transactions are reversed at the end
+	hashes := n.bc.GetBlockHashes()
+	// owned maps the outputs paying the address to their value
+	owned := make(map[string]int)
+	hash := addressHash(p.Address)
+	txs := []addressTxJSON{}
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := n.bc.GetBlockFromHash(hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			entry := addressTxJSON{TxID: hex.EncodeToString(tx.ID), Height: block.Height}
+			if !tx.IsCoinbase() {
+				for _, vin := range tx.Vin {
+					outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+					entry.Sent += owned[outpoint]
+					delete(owned, outpoint)
+				}
+			}
+			for vout, out := range tx.Vout {
+				if bytes.Equal(ScriptLockHash(out.ScriptPubKey), hash) {
+					owned[fmt.Sprintf("%x:%d", tx.ID, vout)] = out.Value
+					entry.Received += out.Value
+				}
+			}
+			if entry.Received > 0 || entry.Sent > 0 {
+				txs = append(txs, entry)
+			}
+		}
+	}
+	for i, j := 0, len(txs)-1; i < j; i, j = i+1, j-1 {
+		txs[i], txs[j] = txs[j], txs[i]
+	}
+
+	return struct {
+		Address      string          `json:"address"`
+		Balance      int             `json:"balance"`
+		Transactions []addressTxJSON `json:"transactions"`
+	}{p.Address, balance, txs}, nil
+}
+
+func rpcGetDifficulty(n *Node, params json.RawMessage) (interface{}, error) {
+	return newDifficultyJSON(n.bc)
+}
+
+func rpcGetProblem(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Hash  string `json:"hash"`
+		Graph bool   `json:"graph"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	hash, err := hex.DecodeString(p.Hash)
+	if err != nil {
+		return nil, &RPCError{rpcInvalidParams, "problem hash is not hex"}
+	}
+
+	pg, err := n.bc.GetProblemGraphFromHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	problem, err := newProblemJSON(&pg, n.bc)
+	if err != nil || !p.Graph {
+		return problem, err
+	}
+
+	// the adjacency lists of the graph, to draw it
+	adjacency := [][]int{}
+	for _, to := range pg.Graph.AdjacencyList {
+		neighbors := []int{}
+		for _, node := range to {
+			neighbors = append(neighbors, int(node))
+		}
+		adjacency = append(adjacency, neighbors)
+	}
+
+	return struct {
+		problemJSON
+		Adjacency [][]int `json:"adjacency"`
+	}{problem, adjacency}, nil
+}
+
+func rpcGetProblems(n *Node, params json.RawMessage) (interface{}, error) {
+	problems := []problemJSON{}
+	for _, hash := range n.bc.GetProblemGraphHashes() {
+		pg, err := n.bc.GetProblemGraphFromHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		problem, err := newProblemJSON(&pg, n.bc)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, problem)
+	}
+
+	return problems, nil
+}
+
+func rpcGetBalance(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Address string `json:"address"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	balance, err := n.Balance(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return balanceJSON{Address: p.Address, Balance: balance}, nil
+}
+
+// rpcSendRawTransaction submits a completely signed transaction made with
+// createrawtx and signrawtx
+func rpcSendRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Hex string `json:"hex"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	raw, err := DecodeRawTransaction(strings.TrimSpace(p.Hex))
+	if err != nil {
+		return nil, &RPCError{rpcInvalidParams, err.Error()}
+	}
+	if !raw.IsComplete() {
+		return nil, errors.New("transaction is not completely signed")
+	}
+	if err := n.Submit(&raw.Tx); err != nil {
+		return nil, err
+	}
+
+	return txIDJSON{hex.EncodeToString(raw.Tx.ID)}, nil
+}
+
+// rpcGetMempool lists the IDs of the mempool transactions, or the
+// transactions themselves when verbose
+func rpcGetMempool(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Verbose bool `json:"verbose"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	txs := []transactionJSON{}
+	for _, tx := range n.Mempool() {
+		tx := tx
+		ids = append(ids, hex.EncodeToString(tx.ID))
+		txs = append(txs, newTransactionJSON(&tx))
+	}
+	if p.Verbose {
+		return txs, nil
+	}
+
+	return ids, nil
+}
+
+func rpcStartMining(n *Node, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Address string `json:"address"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := n.StartMining(p.Address); err != nil {
+		return nil, err
+	}
+
+	return rpcGetMiningInfo(n, params)
+}
+
+func rpcStopMining(n *Node, params json.RawMessage) (interface{}, error) {
+	n.StopMining()
+
+	return rpcGetMiningInfo(n, params)
+}
+
+func rpcGetMiningInfo(n *Node, params json.RawMessage) (interface{}, error) {
+	address := n.MiningAddress()
+
+	return struct {
+		Mining  bool   `json:"mining"`
+		Address string `json:"address,omitempty"`
+	}{address != "", address}, nil
+}
+
+func rpcGetPeerInfo(n *Node, params json.RawMessage) (interface{}, error) {
+	central := n.centralNode()
+	peers := []interface{}{}
+	for _, peer := range n.Peers() {
+		peers = append(peers, struct {
+			Address string `json:"address"`
+			Central bool   `json:"central"`
+		}{peer, peer == central})
+	}
+
+	return peers, nil
+}
+
+// startRPC serves the RPC API when the node config has an RPC address
+func (n *Node) startRPC() error {
+	if n.config.RPCAddress == "" {
+		return nil
+	}
+
+	ln, err := net.Listen(protocol, n.config.RPCAddress)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/", NewRPCServer(n, n.rpcToken))
+	mux.Handle(ExplorerPath, ExplorerHandler())
+	mux.Handle(EventsPath, &eventsHandler{n, n.rpcToken, stop})
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	server.RegisterOnShutdown(func() { close(stop) })
+
+	n.mu.Lock()
+	n.rpcServer = server
+	n.rpcAddress = ln.Addr().String()
+	n.mu.Unlock()
+
+	n.handlers.Add(1)
+	go func() {
+		defer n.handlers.Done()
+		if err := server.Serve(ln); err != http.ErrServerClosed {
+			n.logf("ERROR: RPC server stopped: %s\n", err)
+		}
+	}()
+
+	return nil
+}
+
+func (n *Node) stopRPC() error {
+	n.mu.Lock()
+	server := n.rpcServer
+	n.rpcServer = nil
+	n.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+}
+
+// RPCAddress returns the address the RPC API is served at, "" when it is off
+func (n *Node) RPCAddress() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.rpcAddress
+}
+
+// RPCToken returns the token RPC requests must carry
+func (n *Node) RPCToken() string {
+	return n.rpcToken
+}
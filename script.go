@@ -0,0 +1,668 @@
+package crickchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Opcodes understood by the script interpreter. Values follow Bitcoin's
+// numbering so that scripts can be read with familiar tooling.
+const (
+	Op0                   = 0x00
+	OpPushData1           = 0x4c
+	OpPushData2           = 0x4d
+	Op1                   = 0x51
+	Op16                  = 0x60
+	OpVerify              = 0x69
+	OpDrop                = 0x75
+	OpDup                 = 0x76
+	OpEqual               = 0x87
+	OpEqualVerify         = 0x88
+	OpHash160             = 0xa9
+	OpCheckSig            = 0xac
+	OpCheckSigVerify      = 0xad
+	OpCheckMultiSig       = 0xae
+	OpCheckMultiSigVerify = 0xaf
+	OpCheckLockTimeVerify = 0xb1
+	OpCheckSequenceVerify = 0xb2
+)
+
+const (
+	maxScriptSize      = 10000
+	maxScriptPushSize  = 520
+	maxScriptStackSize = 1000
+	maxMultisigKeys    = 16
+	maxScriptNumLen    = 4
+	maxLockNumLen      = 5
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	OpVerify:              "OP_VERIFY",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpHash160:             "OP_HASH160",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// ScriptChecker supplies the transaction context a script is evaluated in
+type ScriptChecker interface {
+	// CheckSig verifies sig against pubKey. scriptCode is the script the
+	// signature commits to.
+	CheckSig(sig, pubKey, scriptCode []byte) bool
+	// CheckLockTime reports whether the transaction lock time satisfies lockTime
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence reports whether the input sequence satisfies sequence
+	CheckSequence(sequence int64) bool
+}
+
+type scriptOp struct {
+	code byte
+	data []byte
+}
+
+// NewP2PKHScript returns a pay-to-pubkey-hash locking script
+func NewP2PKHScript(pubKeyHash []byte) []byte {
+	script := []byte{OpDup, OpHash160}
+	script = append(script, scriptPush(pubKeyHash)...)
+
+	return append(script, OpEqualVerify, OpCheckSig)
+}
+
+// NewP2SHScript returns a pay-to-script-hash locking script
+func NewP2SHScript(scriptHash []byte) []byte {
+	script := []byte{OpHash160}
+	script = append(script, scriptPush(scriptHash)...)
+
+	return append(script, OpEqual)
+}
+
+// NewTimelockedP2PKHScript returns a pay-to-pubkey-hash locking script that
+// cannot be spent before lockTime, a block height or a unix timestamp
+func NewTimelockedP2PKHScript(lockTime int64, pubKeyHash []byte) []byte {
+	script := scriptPush(scriptNumBytes(lockTime))
+	script = append(script, OpCheckLockTimeVerify, OpDrop)
+
+	return append(script, NewP2PKHScript(pubKeyHash)...)
+}
+
+// NewMultisigScript returns an m-of-n multisig script over the given public keys
+func NewMultisigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n == 0 || n > maxMultisigKeys {
+		return nil, fmt.Errorf("multisig needs between 1 and %d keys", maxMultisigKeys)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("invalid multisig threshold %d of %d", m, n)
+	}
+
+	script := []byte{smallIntOp(m)}
+	for _, pubKey := range pubKeys {
+		script = append(script, scriptPush(pubKey)...)
+	}
+
+	return append(script, smallIntOp(n), OpCheckMultiSig), nil
+}
+
+// HashScript returns the hash used to lock outputs to a script
+func HashScript(script []byte) []byte {
+	return HashPubKey(script)
+}
+
+// ScriptLockHash returns the pubkey hash or script hash a P2PKH, timelocked
+// P2PKH or P2SH script locks to, or nil for any other script
+func ScriptLockHash(script []byte) []byte {
+	if _, p2pkh, ok := splitTimelockScript(script); ok {
+		script = p2pkh
+	}
+	if isP2PKHScript(script) {
+		return script[3:23]
+	}
+	if isP2SHScript(script) {
+		return script[2:22]
+	}
+
+	return nil
+}
+
+// ScriptLockTime returns the lock time of a timelocked P2PKH script
+func ScriptLockTime(script []byte) (int64, bool) {
+	lockTime, _, ok := splitTimelockScript(script)
+
+	return lockTime, ok
+}
+
+// ParseMultisigScript extracts the threshold and public keys from a multisig script
+func ParseMultisigScript(script []byte) (int, [][]byte, bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) < 4 {
+		return 0, nil, false
+	}
+	last := len(ops) - 1
+	if ops[last].code != OpCheckMultiSig {
+		return 0, nil, false
+	}
+	m, okM := opSmallInt(ops[0].code)
+	n, okN := opSmallInt(ops[last-1].code)
+	if !okM || !okN || n != last-2 || m < 1 || m > n {
+		return 0, nil, false
+	}
+
+	var pubKeys [][]byte
+	for _, op := range ops[1 : last-1] {
+		if op.data == nil {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+
+	return m, pubKeys, true
+}
+
+// DisasmScript returns a human-readable representation of a script
+func DisasmScript(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[error: %s] %x", err, script)
+	}
+
+	var parts []string
+	for _, op := range ops {
+		switch {
+		case op.data != nil && len(op.data) > 0:
+			parts = append(parts, fmt.Sprintf("%x", op.data))
+		case op.code >= Op1 && op.code <= Op16:
+			parts = append(parts, fmt.Sprintf("OP_%d", op.code-Op1+1))
+		case opcodeNames[op.code] != "":
+			parts = append(parts, opcodeNames[op.code])
+		default:
+			parts = append(parts, fmt.Sprintf("OP_UNKNOWN_%02x", op.code))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// VerifyScript runs scriptSig followed by scriptPubKey and reports whether the
+// spend is authorised. Pay-to-script-hash outputs additionally run the redeem
+// script pushed last by scriptSig.
+func VerifyScript(scriptSig, scriptPubKey []byte, checker ScriptChecker) error {
+	if !isPushOnly(scriptSig) {
+		return errors.New("scriptSig is not push-only")
+	}
+
+	engine := scriptEngine{checker: checker}
+	err := engine.execute(scriptSig, nil)
+	if err != nil {
+		return err
+	}
+	sigStack := append([][]byte{}, engine.stack...)
+
+	err = engine.execute(scriptPubKey, scriptPubKey)
+	if err != nil {
+		return err
+	}
+	if !engine.success() {
+		return errors.New("script evaluated to false")
+	}
+
+	if !isP2SHScript(scriptPubKey) {
+		return nil
+	}
+	if len(sigStack) == 0 {
+		return errors.New("missing redeem script")
+	}
+	redeemScript := sigStack[len(sigStack)-1]
+	engine.stack = sigStack[:len(sigStack)-1]
+
+	err = engine.execute(redeemScript, redeemScript)
+	if err != nil {
+		return err
+	}
+	if !engine.success() {
+		return errors.New("redeem script evaluated to false")
+	}
+
+	return nil
+}
+
+type scriptEngine struct {
+	stack   [][]byte
+	checker ScriptChecker
+}
+
+func (e *scriptEngine) success() bool {
+	return len(e.stack) > 0 && castToBool(e.stack[len(e.stack)-1])
+}
+
+func (e *scriptEngine) push(data []byte) error {
+	if len(e.stack) >= maxScriptStackSize {
+		return errors.New("script stack overflow")
+	}
+	e.stack = append(e.stack, data)
+
+	return nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("script stack underflow")
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return top, nil
+}
+
+func (e *scriptEngine) popInt() (int, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := parseScriptNum(data, maxScriptNumLen)
+
+	return int(n), err
+}
+
+// peekLockNum reads the operand of a lock time check, which stays on the stack
+func (e *scriptEngine) peekLockNum() (int64, error) {
+	if len(e.stack) == 0 {
+		return 0, errors.New("script stack underflow")
+	}
+	n, err := parseScriptNum(e.stack[len(e.stack)-1], maxLockNumLen)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("negative lock time")
+	}
+
+	return n, nil
+}
+
+func (e *scriptEngine) verify() error {
+	top, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(top) {
+		return errors.New("script verification failed")
+	}
+
+	return nil
+}
+
+// execute runs script against the current stack. scriptCode is what
+// signature checks commit to and is nil while running scriptSig.
+func (e *scriptEngine) execute(script, scriptCode []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		if op.data != nil || op.code == Op0 {
+			err = e.push(op.data)
+		} else if n, ok := opSmallInt(op.code); ok {
+			err = e.push([]byte{byte(n)})
+		} else {
+			err = e.executeOp(op.code, scriptCode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *scriptEngine) executeOp(code byte, scriptCode []byte) error {
+	switch code {
+	case OpVerify:
+		return e.verify()
+
+	case OpDrop:
+		_, err := e.pop()
+		return err
+
+	case OpDup:
+		if len(e.stack) == 0 {
+			return errors.New("script stack underflow")
+		}
+		return e.push(e.stack[len(e.stack)-1])
+
+	case OpEqual, OpEqualVerify:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		err = e.push(boolToStack(bytes.Equal(a, b)))
+		if err != nil || code == OpEqual {
+			return err
+		}
+		return e.verify()
+
+	case OpHash160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.push(HashPubKey(data))
+
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+		valid := scriptCode != nil && e.checker.CheckSig(sig, pubKey, scriptCode)
+		err = e.push(boolToStack(valid))
+		if err != nil || code == OpCheckSig {
+			return err
+		}
+		return e.verify()
+
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		valid, err := e.checkMultiSig(scriptCode)
+		if err != nil {
+			return err
+		}
+		err = e.push(boolToStack(valid))
+		if err != nil || code == OpCheckMultiSig {
+			return err
+		}
+		return e.verify()
+
+	case OpCheckLockTimeVerify:
+		lockTime, err := e.peekLockNum()
+		if err != nil {
+			return err
+		}
+		if !e.checker.CheckLockTime(lockTime) {
+			return errors.New("lock time requirement not satisfied")
+		}
+		return nil
+
+	case OpCheckSequenceVerify:
+		sequence, err := e.peekLockNum()
+		if err != nil {
+			return err
+		}
+		if !e.checker.CheckSequence(sequence) {
+			return errors.New("sequence requirement not satisfied")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown opcode 0x%02x", code)
+}
+
+// checkMultiSig pops n, n public keys, m and m signatures. Signatures must
+// appear in the same order as the keys they belong to.
+func (e *scriptEngine) checkMultiSig(scriptCode []byte) (bool, error) {
+	n, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > maxMultisigKeys {
+		return false, fmt.Errorf("invalid multisig key count %d", n)
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		pubKeys[i], err = e.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	m, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("invalid multisig threshold %d of %d", m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		sigs[i], err = e.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if scriptCode == nil {
+		return false, nil
+	}
+	k := 0
+	for _, sig := range sigs {
+		for k < n && !e.checker.CheckSig(sig, pubKeys[k], scriptCode) {
+			k++
+		}
+		if k == n {
+			return false, nil
+		}
+		k++
+	}
+
+	return true, nil
+}
+
+func parseScript(script []byte) ([]scriptOp, error) {
+	if len(script) > maxScriptSize {
+		return nil, errors.New("script is too long")
+	}
+
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		code := script[i]
+		i++
+
+		var size int
+		switch {
+		case code > Op0 && code < OpPushData1:
+			size = int(code)
+		case code == OpPushData1:
+			if i+1 > len(script) {
+				return nil, errors.New("truncated push")
+			}
+			size = int(script[i])
+			i++
+		case code == OpPushData2:
+			if i+2 > len(script) {
+				return nil, errors.New("truncated push")
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ops = append(ops, scriptOp{code, nil})
+			continue
+		}
+
+		if size > maxScriptPushSize {
+			return nil, errors.New("push exceeds maximum size")
+		}
+		if i+size > len(script) {
+			return nil, errors.New("truncated push")
+		}
+		ops = append(ops, scriptOp{code, script[i : i+size]})
+		i += size
+	}
+
+	return ops, nil
+}
+
+// scriptPush returns the shortest script fragment pushing data
+func scriptPush(data []byte) []byte {
+	size := len(data)
+	switch {
+	case size == 0:
+		return []byte{Op0}
+	case size < OpPushData1:
+		return append([]byte{byte(size)}, data...)
+	case size <= 0xff:
+		return append([]byte{OpPushData1, byte(size)}, data...)
+	}
+
+	header := []byte{OpPushData2, 0, 0}
+	binary.LittleEndian.PutUint16(header[1:], uint16(size))
+
+	return append(header, data...)
+}
+
+func isPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if _, ok := opSmallInt(op.code); op.data == nil && op.code != Op0 && !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isP2PKHScript(script []byte) bool {
+	return len(script) == 25 &&
+		script[0] == OpDup &&
+		script[1] == OpHash160 &&
+		script[2] == 20 &&
+		script[23] == OpEqualVerify &&
+		script[24] == OpCheckSig
+}
+
+// splitTimelockScript splits "<lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP <P2PKH>"
+// into its lock time and P2PKH part
+func splitTimelockScript(script []byte) (int64, []byte, bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) != 8 || ops[1].code != OpCheckLockTimeVerify || ops[2].code != OpDrop {
+		return 0, nil, false
+	}
+	lockTime, err := parseScriptNum(ops[0].data, maxLockNumLen)
+	if err != nil || lockTime < 0 {
+		return 0, nil, false
+	}
+	p2pkh := script[len(script)-25:]
+	if !isP2PKHScript(p2pkh) {
+		return 0, nil, false
+	}
+
+	return lockTime, p2pkh, true
+}
+
+// pubKeyHashScript reports whether script is spent with a signature and a public key
+func pubKeyHashScript(script []byte) bool {
+	_, _, timelocked := splitTimelockScript(script)
+
+	return timelocked || isP2PKHScript(script)
+}
+
+func isP2SHScript(script []byte) bool {
+	return len(script) == 23 &&
+		script[0] == OpHash160 &&
+		script[1] == 20 &&
+		script[22] == OpEqual
+}
+
+func smallIntOp(n int) byte {
+	if n == 0 {
+		return Op0
+	}
+
+	return byte(Op1 + n - 1)
+}
+
+func opSmallInt(code byte) (int, bool) {
+	if code >= Op1 && code <= Op16 {
+		return int(code-Op1) + 1, true
+	}
+
+	return 0, false
+}
+
+// scriptNumBytes encodes n as a minimal little-endian sign-magnitude number
+func scriptNumBytes(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var result []byte
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// parseScriptNum decodes a number encoded by scriptNumBytes of at most maxLen bytes
+func parseScriptNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, errors.New("script number overflow")
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i := len(data) - 1; i >= 0; i-- {
+		n = n<<8 | int64(data[i])
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(data)-1))
+		n = -n
+	}
+
+	return n, nil
+}
+
+func castToBool(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func boolToStack(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+
+	return []byte{}
+}
@@ -2,6 +2,7 @@ package crickchain
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
@@ -9,17 +10,29 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"time"
 )
 
 const protocol = "tcp"
 const nodeVersion = 1
 const commandLength = 12
 
-var nodeAddress string
-var miningAddress string
-var knownNodes = []string{"localhost:3000"}
-var blocksInTransit = [][]byte{}
-var mempool = make(map[string]Transaction)
+// maxPendingBlocks bounds the blocks waiting for problem graphs
+const maxPendingBlocks = 100
+
+// pendingBlockTimeout is how long a block waits for its problem graphs
+const pendingBlockTimeout = time.Minute
+
+// pendingBlock is a block received from a peer that waits for problem graphs
+type pendingBlock struct {
+	block *Block
+	from  string
+	// missing are the hashes of the graphs the block still waits for, and
+	// fetched the graphs received for it, by hash
+	missing map[string]bool
+	fetched map[string]*ProblemGraph
+	parked  time.Time
+}
 
 type addr struct {
 	AddrList []string
@@ -46,6 +59,12 @@ type inv struct {
 	Items    [][]byte
 }
 
+// problem carries a problem graph in its canonical encoding
+type problem struct {
+	AddrFrom string
+	Graph    []byte
+}
+
 type tx struct {
 	AddFrom     string
 	Transaction []byte
@@ -83,42 +102,44 @@ func extractCommand(request []byte) []byte {
 	return request[:commandLength]
 }
 
-func requestBlocks() {
-	for _, node := range knownNodes {
-		sendGetBlocks(node)
+func (n *Node) requestBlocks() {
+	for _, node := range n.Peers() {
+		n.sendGetBlocks(node)
 	}
 }
 
-func sendAddr(address string) {
-	nodes := addr{knownNodes}
-	nodes.AddrList = append(nodes.AddrList, nodeAddress)
+func (n *Node) sendAddr(address string) {
+	nodes := addr{n.Peers()}
+	nodes.AddrList = append(nodes.AddrList, n.Address())
 	payload := gobEncode(nodes)
 	request := append(commandToBytes("addr"), payload...)
 
-	sendData(address, request)
+	n.sendData(address, request)
 }
 
-func sendBlock(addr string, b *Block) {
-	data := block{nodeAddress, b.Serialize()}
+func (n *Node) sendBlock(addr string, b *Block) {
+	data := block{n.Address(), b.Serialize()}
 	payload := gobEncode(data)
 	request := append(commandToBytes("block"), payload...)
 
-	sendData(addr, request)
+	n.sendData(addr, request)
 }
 
-func sendData(addr string, data []byte) {
+func (n *Node) sendData(addr string, data []byte) {
 	conn, err := net.Dial(protocol, addr)
 	if err != nil {
-		fmt.Printf("%s is not available\n", addr)
+		n.logf("%s is not available\n", addr)
 		var updatedNodes []string
 
-		for _, node := range knownNodes {
+		n.mu.Lock()
+		for _, node := range n.knownNodes {
 			if node != addr {
 				updatedNodes = append(updatedNodes, node)
 			}
 		}
 
-		knownNodes = updatedNodes
+		n.knownNodes = updatedNodes
+		n.mu.Unlock()
 
 		return
 	}
@@ -126,319 +147,447 @@ func sendData(addr string, data []byte) {
 
 	_, err = io.Copy(conn, bytes.NewReader(data))
 	if err != nil {
-		log.Panic(err)
+		n.logf("Sending to %s failed: %s\n", addr, err)
 	}
 }
 
-func sendInv(address, kind string, items [][]byte) {
-	inventory := inv{nodeAddress, kind, items}
+func (n *Node) sendInv(address, kind string, items [][]byte) {
+	inventory := inv{n.Address(), kind, items}
 	payload := gobEncode(inventory)
 	request := append(commandToBytes("inv"), payload...)
 
-	sendData(address, request)
+	n.sendData(address, request)
 }
 
-func sendGetBlocks(address string) {
-	payload := gobEncode(getblocks{nodeAddress})
+func (n *Node) sendGetBlocks(address string) {
+	payload := gobEncode(getblocks{n.Address()})
 	request := append(commandToBytes("getblocks"), payload...)
 
-	sendData(address, request)
+	n.sendData(address, request)
 }
 
-func sendGetData(address, kind string, id []byte) {
-	payload := gobEncode(getdata{nodeAddress, kind, id})
+func (n *Node) sendGetData(address, kind string, id []byte) {
+	payload := gobEncode(getdata{n.Address(), kind, id})
 	request := append(commandToBytes("getdata"), payload...)
 
-	sendData(address, request)
+	n.sendData(address, request)
 }
 
-func sendTx(addr string, tnx *Transaction) {
-	data := tx{nodeAddress, tnx.Serialize()}
+func (n *Node) sendProblem(addr string, pg *ProblemGraph) {
+	payload := gobEncode(problem{n.Address(), pg.CanonicalEncoding()})
+	request := append(commandToBytes("problem"), payload...)
+
+	n.sendData(addr, request)
+}
+
+func (n *Node) sendTx(addr string, tnx *Transaction) {
+	data := tx{n.Address(), tnx.Serialize()}
 	payload := gobEncode(data)
 	request := append(commandToBytes("tx"), payload...)
 
-	sendData(addr, request)
+	n.sendData(addr, request)
 }
 
-func sendVersion(addr string, bc *Blockchain) {
-	bestHeight := bc.GetBestHeight()
-	payload := gobEncode(verzion{nodeVersion, bestHeight, nodeAddress})
+func (n *Node) sendVersion(addr string) {
+	bestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		n.logf("ERROR: %s\n", err)
+		return
+	}
+	payload := gobEncode(verzion{nodeVersion, bestHeight, n.Address()})
 
 	request := append(commandToBytes("version"), payload...)
 
-	sendData(addr, request)
+	n.sendData(addr, request)
 }
 
-func handleAddr(request []byte) {
-	var buff bytes.Buffer
+// decodePayload decodes the gob payload following the command of request
+func decodePayload(request []byte, payload interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(request[commandLength:])).Decode(payload)
+}
+
+func (n *Node) handleAddr(request []byte) {
 	var payload addr
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
 	}
 
-	knownNodes = append(knownNodes, payload.AddrList...)
-	fmt.Printf("There are %d known nodes now!\n", len(knownNodes))
-	requestBlocks()
+	n.mu.Lock()
+	n.knownNodes = append(n.knownNodes, payload.AddrList...)
+	count := len(n.knownNodes)
+	n.mu.Unlock()
+	n.logf("There are %d known nodes now!\n", count)
+	n.requestBlocks()
 }
 
-func handleBlock(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
+func (n *Node) handleBlock(request []byte) {
 	var payload block
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
+	}
+
+	block, err := DecodeBlock(payload.Block)
 	if err != nil {
-		log.Panic(err)
+		n.logf("ERROR: Malformed block: %s\n", err)
+		return
 	}
 
-	blockData := payload.Block
-	block := DeserializeBlock(blockData)
+	n.logf("Recevied a new block!\n")
+	n.processBlock(block, payload.AddrFrom)
+}
 
-	fmt.Println("Recevied a new block!")
-	bc.AddBlock(block)
+// processBlock adds a block received from a peer, then asks it for the next
+// block in transit. A block referring to problem graphs the node lacks waits
+// for them, since its target depends on the validity of its solution. Its
+// proof-of-work is checked first, so that peers can't park blocks for free.
+func (n *Node) processBlock(block *Block, from string) {
+	if !NewProofOfWork(block).Validate() {
+		n.logf("ERROR: Rejected block %x: proof-of-work is not valid\n", block.Hash)
+		return
+	}
 
-	fmt.Printf("Added block %x\n", block.Hash)
+	if missing := n.missingProblems(block); len(missing) > 0 {
+		if !n.parkBlock(block, from, missing) {
+			n.logf("ERROR: Too many blocks wait for problem graphs, dropping %x\n", block.Hash)
+			return
+		}
 
-	if len(blocksInTransit) > 0 {
-		blockHash := blocksInTransit[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
+		for _, hash := range missing {
+			n.logf("Block %x waits for problem graph %x\n", block.Hash, hash)
+			n.sendGetData(from, "problem", hash)
+		}
+		return
+	}
+
+	n.addReceivedBlock(block, from, nil)
+}
+
+// addReceivedBlock adds a block received from a peer, with the problem graphs
+// fetched for it, then asks the peer for the next block in transit
+func (n *Node) addReceivedBlock(block *Block, from string, fetched map[string]*ProblemGraph) {
+	if err := n.addBlock(block, fetched); err != nil {
+		n.logf("ERROR: Rejected block: %s\n", err)
+	} else {
+		n.logf("Added block %x\n", block.Hash)
+	}
+
+	n.mu.Lock()
+	var next []byte
+	if len(n.blocksInTransit) > 0 {
+		next = n.blocksInTransit[0]
+		n.blocksInTransit = n.blocksInTransit[1:]
+	}
+	n.mu.Unlock()
 
-		blocksInTransit = blocksInTransit[1:]
+	if next != nil {
+		n.sendGetData(from, "block", next)
 	} else {
-		UTXOSet := UTXOSet{bc}
-		UTXOSet.Reindex()
+		UTXOSet := UTXOSet{n.bc}
+		if err := UTXOSet.Reindex(); err != nil {
+			n.logf("ERROR: Reindexing the UTXO set failed: %s\n", err)
+		}
 	}
 }
 
-func handleInv(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
-	var payload inv
+// missingProblems returns the hashes of the problem graphs block refers to
+// that are not in the DB. A problem graph generated from the parameters of
+// the block is not missing: it is regenerated, once the proof-of-work and the
+// size of the graph are checked, and stored if the block is added.
+func (n *Node) missingProblems(block *Block) [][]byte {
+	var missing [][]byte
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+	for _, hash := range [][]byte{block.ProblemGraphHash, block.SolutionHash} {
+		if block.Problem != nil && Equal(hash, block.ProblemGraphHash) {
+			continue
+		}
+		if len(hash) > 0 && !n.bc.HasProblemGraph(hash) && (len(missing) == 0 || !Equal(missing[0], hash)) {
+			missing = append(missing, hash)
+		}
 	}
 
-	fmt.Printf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
+	return missing
+}
 
-	if payload.Type == "block" {
-		blocksInTransit = payload.Items
+// parkBlock makes a block wait for the problem graphs missing, once the
+// blocks that waited longer than pendingBlockTimeout are dropped. It tells if
+// there was room for it.
+func (n *Node) parkBlock(block *Block, from string, missing [][]byte) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	var kept []*pendingBlock
+	for _, pending := range n.pendingBlocks {
+		if now.Sub(pending.parked) < pendingBlockTimeout {
+			kept = append(kept, pending)
+		}
+	}
+	n.pendingBlocks = kept
+	if len(n.pendingBlocks) >= maxPendingBlocks {
+		return false
+	}
+
+	pending := &pendingBlock{block, from, make(map[string]bool), make(map[string]*ProblemGraph), now}
+	for _, hash := range missing {
+		pending.missing[string(hash)] = true
+	}
+	n.pendingBlocks = append(n.pendingBlocks, pending)
+
+	return true
+}
+
+// waitsForProblem tells if a parked block waits for the problem graph with
+// hash
+func (n *Node) waitsForProblem(hash []byte) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
-		blockHash := payload.Items[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
+	for _, pending := range n.pendingBlocks {
+		if pending.missing[string(hash)] {
+			return true
+		}
+	}
 
-		newInTransit := [][]byte{}
-		for _, b := range blocksInTransit {
-			if bytes.Compare(b, blockHash) != 0 {
-				newInTransit = append(newInTransit, b)
+	return false
+}
+
+// problemFetched hands a problem graph to the parked blocks waiting for it,
+// and unparks and returns the ones that no longer wait for any
+func (n *Node) problemFetched(pg *ProblemGraph) []*pendingBlock {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var ready, kept []*pendingBlock
+	for _, pending := range n.pendingBlocks {
+		if pending.missing[string(pg.Hash)] {
+			delete(pending.missing, string(pg.Hash))
+			pending.fetched[string(pg.Hash)] = pg
+		}
+		if len(pending.missing) == 0 {
+			ready = append(ready, pending)
+		} else {
+			kept = append(kept, pending)
+		}
+	}
+	n.pendingBlocks = kept
+
+	return ready
+}
+
+func (n *Node) handleInv(request []byte) {
+	var payload inv
+
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
+	}
+
+	n.logf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
+	if len(payload.Items) == 0 {
+		return
+	}
+
+	if payload.Type == "block" {
+		// inventories list the newest blocks first, and blocks are added
+		// oldest first so that they are validated against their ancestors
+		var missing [][]byte
+		for i := len(payload.Items) - 1; i >= 0; i-- {
+			if _, err := n.bc.GetBlockFromHash(payload.Items[i]); err != nil {
+				missing = append(missing, payload.Items[i])
 			}
 		}
-		blocksInTransit = newInTransit
+		if len(missing) == 0 {
+			return
+		}
+
+		n.mu.Lock()
+		n.blocksInTransit = missing[1:]
+		n.mu.Unlock()
+
+		n.sendGetData(payload.AddrFrom, "block", missing[0])
 	}
 
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if mempool[hex.EncodeToString(txID)].ID == nil {
-			sendGetData(payload.AddrFrom, "tx", txID)
+		n.mu.Lock()
+		_, known := n.mempool[hex.EncodeToString(txID)]
+		n.mu.Unlock()
+		if !known {
+			n.sendGetData(payload.AddrFrom, "tx", txID)
 		}
 	}
 }
 
-func handleGetBlocks(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
+func (n *Node) handleGetBlocks(request []byte) {
 	var payload getblocks
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
 	}
 
-	blocks := bc.GetBlockHashes()
-	sendInv(payload.AddrFrom, "block", blocks)
+	blocks := n.bc.GetBlockHashes()
+	n.sendInv(payload.AddrFrom, "block", blocks)
 }
 
-func handleGetData(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
+func (n *Node) handleGetData(request []byte) {
 	var payload getdata
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
 	}
 
 	if payload.Type == "block" {
-		block, err := bc.GetBlockFromHash([]byte(payload.ID))
+		block, err := n.bc.GetBlockFromHash([]byte(payload.ID))
 		if err != nil {
 			return
 		}
 
-		sendBlock(payload.AddrFrom, &block)
+		n.sendBlock(payload.AddrFrom, &block)
 	}
 
-	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := mempool[txID]
+	if payload.Type == "problem" {
+		pg, err := n.bc.GetProblemGraphFromHash(payload.ID)
+		if err != nil {
+			return
+		}
 
-		sendTx(payload.AddrFrom, &tx)
-		// delete(mempool, txID)
+		n.sendProblem(payload.AddrFrom, &pg)
 	}
-}
 
-func handleTx(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
-	var payload tx
+	if payload.Type == "tx" {
+		n.mu.Lock()
+		tx, ok := n.mempool[hex.EncodeToString(payload.ID)]
+		n.mu.Unlock()
+		if !ok {
+			return
+		}
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+		n.sendTx(payload.AddrFrom, &tx)
 	}
+}
 
-	txData := payload.Transaction
-	tx := DeserializeTransaction(txData)
-	mempool[hex.EncodeToString(tx.ID)] = tx
-
-	if nodeAddress == knownNodes[0] {
-		for _, node := range knownNodes {
-			if node != nodeAddress && node != payload.AddFrom {
-				sendInv(node, "tx", [][]byte{tx.ID})
-			}
-		}
-	} else {
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*Transaction
-
-			for id := range mempool {
-				tx := mempool[id]
-				if bc.VerifyTransaction(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
+// handleProblem hands a problem graph, which is identified by the hash of its
+// encoding, to the parked blocks that wait for it. The graph is stored with
+// the first of them that is added, and dropped if none waits for it.
+func (n *Node) handleProblem(request []byte) {
+	var payload problem
 
-			if len(txs) == 0 {
-				fmt.Println("All transactions are invalid! Waiting for new ones...")
-				return
-			}
-
-			cbTx := NewCoinbaseTX(miningAddress, "")
-			txs = append(txs, cbTx)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
+	}
 
-			newBlock := bc.MineBlock(txs, []byte{}, []int{}, []byte{})
-			UTXOSet := UTXOSet{bc}
-			UTXOSet.Reindex()
+	// the hash of a graph is the one of its canonical encoding, so graphs
+	// that were not asked for are dropped before being decoded
+	hash := sha256.Sum256(payload.Graph)
+	if !n.waitsForProblem(hash[:]) {
+		n.logf("ERROR: Problem graph %x was not asked for\n", hash)
+		return
+	}
+	pg, err := DecodeProblemGraph(payload.Graph)
+	if err != nil {
+		n.logf("ERROR: Malformed problem graph: %s\n", err)
+		return
+	}
+	if !bytes.Equal(pg.Hash, hash[:]) {
+		n.logf("ERROR: Problem graph %x is not canonically encoded\n", hash)
+		return
+	}
+	n.logf("Received problem graph %x\n", pg.Hash)
 
-			fmt.Println("New block is mined!")
+	for _, pending := range n.problemFetched(pg) {
+		n.addReceivedBlock(pending.block, pending.from, pending.fetched)
+	}
+}
 
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
+func (n *Node) handleTx(request []byte) {
+	var payload tx
 
-			for _, node := range knownNodes {
-				if node != nodeAddress {
-					sendInv(node, "block", [][]byte{newBlock.Hash})
-				}
-			}
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
+	}
 
-			if len(mempool) > 0 {
-				goto MineTransactions
-			}
-		}
+	tx, err := DeserializeTransaction(payload.Transaction)
+	if err != nil {
+		n.logf("ERROR: Malformed transaction: %s\n", err)
+		return
+	}
+	if err := n.acceptTransaction(&tx, payload.AddFrom); err != nil {
+		n.logf("Rejected transaction: %s\n", err)
 	}
 }
 
-func handleVersion(request []byte, bc *Blockchain) {
-	var buff bytes.Buffer
+func (n *Node) handleVersion(request []byte) {
 	var payload verzion
 
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		log.Panic(err)
+	if err := decodePayload(request, &payload); err != nil {
+		n.logf("ERROR: Malformed message: %s\n", err)
+		return
 	}
 
-	myBestHeight := bc.GetBestHeight()
+	myBestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		n.logf("ERROR: %s\n", err)
+		return
+	}
 	foreignerBestHeight := payload.BestHeight
 
 	if myBestHeight < foreignerBestHeight {
-		sendGetBlocks(payload.AddrFrom)
+		n.sendGetBlocks(payload.AddrFrom)
 	} else if myBestHeight > foreignerBestHeight {
-		sendVersion(payload.AddrFrom, bc)
+		n.sendVersion(payload.AddrFrom)
 	}
 
-	// sendAddr(payload.AddrFrom)
-	if !nodeIsKnown(payload.AddrFrom) {
-		knownNodes = append(knownNodes, payload.AddrFrom)
+	// n.sendAddr(payload.AddrFrom)
+	n.mu.Lock()
+	if !nodeIsKnown(n.knownNodes, payload.AddrFrom) {
+		n.knownNodes = append(n.knownNodes, payload.AddrFrom)
 	}
+	n.mu.Unlock()
 }
 
-func handleConnection(conn net.Conn, bc *Blockchain) {
+func (n *Node) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
 	request, err := ioutil.ReadAll(conn)
 	if err != nil {
-		log.Panic(err)
+		n.logf("ERROR: Reading request failed: %s\n", err)
+		return
+	}
+	if len(request) < commandLength {
+		n.logf("ERROR: Request is too short\n")
+		return
 	}
 	command := bytesToCommand(request[:commandLength])
-	fmt.Printf("Received %s command\n", command)
+	n.logf("Received %s command\n", command)
 
 	switch command {
 	case "addr":
-		handleAddr(request)
+		n.handleAddr(request)
 	case "block":
-		handleBlock(request, bc)
+		n.handleBlock(request)
 	case "inv":
-		handleInv(request, bc)
+		n.handleInv(request)
 	case "getblocks":
-		handleGetBlocks(request, bc)
+		n.handleGetBlocks(request)
 	case "getdata":
-		handleGetData(request, bc)
+		n.handleGetData(request)
+	case "problem":
+		n.handleProblem(request)
 	case "tx":
-		handleTx(request, bc)
+		n.handleTx(request)
 	case "version":
-		handleVersion(request, bc)
+		n.handleVersion(request)
 	default:
-		fmt.Println("Unknown command!")
-	}
-
-	conn.Close()
-}
-
-// StartServer starts a node
-func StartServer(nodeID string, dbFile string, minerAddress string) {
-	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
-	miningAddress = minerAddress
-	ln, err := net.Listen(protocol, nodeAddress)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer ln.Close()
-
-	bc := NewBlockchain(dbFile)
-
-	if nodeAddress != knownNodes[0] {
-		sendVersion(knownNodes[0], bc)
-	}
-
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			log.Panic(err)
-		}
-		go handleConnection(conn, bc)
+		n.logf("Unknown command!\n")
 	}
 }
 
@@ -454,7 +603,7 @@ func gobEncode(data interface{}) []byte {
 	return buff.Bytes()
 }
 
-func nodeIsKnown(addr string) bool {
+func nodeIsKnown(knownNodes []string, addr string) bool {
 	for _, node := range knownNodes {
 		if node == addr {
 			return true
@@ -0,0 +1,86 @@
+package crickchain
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+)
+
+const maxSigCacheEntries = 50000
+
+// sigCache holds signatures verified on mempool acceptance, so that they are
+// not checked again when the block containing them arrives
+var sigCache = NewSigCache(maxSigCacheEntries)
+
+// MempoolSigCache returns the cache of the signatures verified on mempool
+// acceptance, which block validation looks up
+func MempoolSigCache() *SigCache {
+	return sigCache
+}
+
+// SigCache remembers (sighash, signature, public key) triples that verified
+type SigCache struct {
+	mu         sync.RWMutex
+	entries    map[[32]byte]struct{}
+	maxEntries int
+	// hits counts the lookups that found their signature
+	hits uint64
+}
+
+// NewSigCache creates a SigCache holding at most maxEntries signatures
+func NewSigCache(maxEntries int) *SigCache {
+	return &SigCache{entries: make(map[[32]byte]struct{}), maxEntries: maxEntries}
+}
+
+// Exists checks whether the signature of hash by pubKey is known to be valid
+func (c *SigCache) Exists(hash, sig, pubKey []byte) bool {
+	key := sigCacheKey(hash, sig, pubKey)
+
+	c.mu.RLock()
+	_, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	}
+
+	return ok
+}
+
+// Add records a valid signature, evicting a random entry when the cache is full
+func (c *SigCache) Add(hash, sig, pubKey []byte) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	key := sigCacheKey(hash, sig, pubKey)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		// map iteration order is random, which is all the eviction policy needs
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = struct{}{}
+}
+
+// Len returns the number of cached signatures
+func (c *SigCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.entries)
+}
+
+// Hits returns the number of lookups that found their signature
+func (c *SigCache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+func sigCacheKey(hash, sig, pubKey []byte) [32]byte {
+	data := append(append(append([]byte{}, hash...), sig...), pubKey...)
+
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,227 @@
+package crickchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// SigHashType selects which parts of a transaction a signature commits to.
+// It is appended as the last byte of every signature.
+type SigHashType byte
+
+const (
+	// SigHashAll signs all inputs and outputs
+	SigHashAll SigHashType = 0x01
+	// SigHashNone signs all inputs and no outputs
+	SigHashNone SigHashType = 0x02
+	// SigHashSingle signs all inputs and the output with the same index as the signed input
+	SigHashSingle SigHashType = 0x03
+	// SigHashAnyoneCanPay can be combined with the other types to sign only the signed input
+	SigHashAnyoneCanPay SigHashType = 0x80
+
+	sigHashMask = 0x1f
+)
+
+var curveHalfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+func (hashType SigHashType) isValid() bool {
+	base := hashType &^ SigHashAnyoneCanPay
+
+	return base >= SigHashAll && base <= SigHashSingle
+}
+
+// SignatureHash returns the digest an input's signature commits to. scriptCode
+// is the locking script of the spent output, or the redeem script for P2SH.
+func (tx *Transaction) SignatureHash(inID int, scriptCode []byte, hashType SigHashType) ([]byte, error) {
+	if inID < 0 || inID >= len(tx.Vin) {
+		return nil, fmt.Errorf("input %d out of range", inID)
+	}
+	if !hashType.isValid() {
+		return nil, fmt.Errorf("invalid sighash type 0x%02x", byte(hashType))
+	}
+	base := hashType & sigHashMask
+	if base == SigHashSingle && inID >= len(tx.Vout) {
+		return nil, fmt.Errorf("no output %d for SIGHASH_SINGLE", inID)
+	}
+
+	var buff bytes.Buffer
+	writeUint64(&buff, uint64(tx.Version))
+
+	inputs := tx.Vin
+	signedInput := inID
+	if hashType&SigHashAnyoneCanPay != 0 {
+		inputs = tx.Vin[inID : inID+1]
+		signedInput = 0
+	}
+	writeUint64(&buff, uint64(len(inputs)))
+	for i, vin := range inputs {
+		writeVarBytes(&buff, vin.Txid)
+		writeUint64(&buff, uint64(int64(vin.Vout)))
+		if i == signedInput {
+			writeVarBytes(&buff, scriptCode)
+			writeUint64(&buff, uint64(vin.Sequence))
+			continue
+		}
+		writeVarBytes(&buff, nil)
+		// other inputs may update their sequence unless all outputs are signed
+		if base == SigHashAll {
+			writeUint64(&buff, uint64(vin.Sequence))
+		} else {
+			writeUint64(&buff, 0)
+		}
+	}
+
+	var outputs []TXOutput
+	switch base {
+	case SigHashAll:
+		outputs = tx.Vout
+	case SigHashSingle:
+		outputs = tx.Vout[:inID+1]
+	}
+	writeUint64(&buff, uint64(len(outputs)))
+	for i, vout := range outputs {
+		if base == SigHashSingle && i != inID {
+			writeUint64(&buff, ^uint64(0))
+			writeVarBytes(&buff, nil)
+			continue
+		}
+		writeUint64(&buff, uint64(int64(vout.Value)))
+		writeVarBytes(&buff, vout.ScriptPubKey)
+	}
+
+	writeUint64(&buff, uint64(tx.LockTime))
+	writeUint64(&buff, uint64(hashType))
+
+	first := sha256.Sum256(buff.Bytes())
+	hash := sha256.Sum256(first[:])
+
+	return hash[:], nil
+}
+
+// SignInput returns the signature of input inID by privKey, DER encoded with
+// a low S value and followed by the sighash type
+func (tx *Transaction) SignInput(inID int, privKey ecdsa.PrivateKey, scriptCode []byte, hashType SigHashType) ([]byte, error) {
+	hash, err := tx.SignatureHash(inID, scriptCode, hashType)
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cmp(curveHalfOrder) > 0 {
+		s.Sub(privKey.Curve.Params().N, s)
+	}
+
+	return append(encodeDERSignature(r, s), byte(hashType)), nil
+}
+
+// parseSignature splits a signature produced by SignInput into its sighash type and DER integers
+func parseSignature(sig []byte) (SigHashType, *big.Int, *big.Int, error) {
+	if len(sig) == 0 {
+		return 0, nil, nil, errors.New("empty signature")
+	}
+	hashType := SigHashType(sig[len(sig)-1])
+	r, s, err := parseDERSignature(sig[:len(sig)-1])
+
+	return hashType, r, s, err
+}
+
+// verifyHashSignature checks the signature (r, s) of hash against a public key
+func verifyHashSignature(hash []byte, r, s *big.Int, pubKey []byte) bool {
+	x := big.Int{}
+	y := big.Int{}
+	keyLen := len(pubKey)
+	x.SetBytes(pubKey[:(keyLen / 2)])
+	y.SetBytes(pubKey[(keyLen / 2):])
+
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+
+	return ecdsa.Verify(&rawPubKey, hash, r, s)
+}
+
+func encodeDERSignature(r, s *big.Int) []byte {
+	rBytes := derInteger(r)
+	sBytes := derInteger(s)
+
+	sig := []byte{0x30, byte(4 + len(rBytes) + len(sBytes))}
+	sig = append(sig, 0x02, byte(len(rBytes)))
+	sig = append(sig, rBytes...)
+	sig = append(sig, 0x02, byte(len(sBytes)))
+
+	return append(sig, sBytes...)
+}
+
+// derInteger returns the minimal big-endian encoding of a positive integer
+func derInteger(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0x00}, b...)
+	}
+
+	return b
+}
+
+// parseDERSignature decodes a strictly DER encoded signature with a low S value
+func parseDERSignature(sig []byte) (*big.Int, *big.Int, error) {
+	// 0x30 [total-length] 0x02 [R-length] [R] 0x02 [S-length] [S]
+	if len(sig) < 8 || len(sig) > 72 {
+		return nil, nil, errors.New("signature has invalid length")
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-2 {
+		return nil, nil, errors.New("signature is not a DER sequence")
+	}
+
+	rLen := int(sig[3])
+	if sig[2] != 0x02 || 5+rLen >= len(sig) {
+		return nil, nil, errors.New("signature R is malformed")
+	}
+	sLen := int(sig[5+rLen])
+	if sig[4+rLen] != 0x02 || 6+rLen+sLen != len(sig) {
+		return nil, nil, errors.New("signature S is malformed")
+	}
+
+	rBytes := sig[4 : 4+rLen]
+	sBytes := sig[6+rLen:]
+	if !isCanonicalDERInteger(rBytes) || !isCanonicalDERInteger(sBytes) {
+		return nil, nil, errors.New("signature integer is not canonical")
+	}
+
+	r := new(big.Int).SetBytes(rBytes)
+	s := new(big.Int).SetBytes(sBytes)
+	if r.Sign() == 0 || s.Sign() == 0 {
+		return nil, nil, errors.New("signature integer is zero")
+	}
+	if s.Cmp(curveHalfOrder) > 0 {
+		return nil, nil, errors.New("signature S is not low")
+	}
+
+	return r, s, nil
+}
+
+func isCanonicalDERInteger(b []byte) bool {
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		return false
+	}
+	// no unnecessary leading zero byte
+	return !(len(b) > 1 && b[0] == 0x00 && b[1]&0x80 == 0)
+}
+
+func writeUint64(buff *bytes.Buffer, n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	buff.Write(b[:])
+}
+
+func writeVarBytes(buff *bytes.Buffer, data []byte) {
+	writeUint64(buff, uint64(len(data)))
+	buff.Write(data)
+}
@@ -0,0 +1,236 @@
+package crickchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+
+	"github.com/boltdb/bolt"
+)
+
+// solutionIndexBucket holds a bucket per problem graph, keyed by its
+// canonical hash, with the solutions to it posted in the active chain keyed
+// by height. Its key solutionIndexTipKey is the tip the index is up to date
+// with.
+const solutionIndexBucket = "solutionIndex"
+
+var solutionIndexTipKey = []byte("t")
+
+// SolutionRecord is a solution posted in the active chain
+type SolutionRecord struct {
+	Height    int
+	BlockHash []byte
+	Clique    []int
+	// BestHeight is the height of the best solution to the problem up to
+	// this one: the largest one, the latest among the largest ones
+	BestHeight int
+}
+
+func solutionKey(height int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(height))
+}
+
+func (r SolutionRecord) serialize() ([]byte, error) {
+	var result bytes.Buffer
+	if err := gob.NewEncoder(&result).Encode(r); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+func deserializeSolutionRecord(d []byte) (SolutionRecord, error) {
+	var record SolutionRecord
+	err := gob.NewDecoder(bytes.NewReader(d)).Decode(&record)
+
+	return record, err
+}
+
+// solutionProblemHash returns the canonical hash of the problem a block posts
+// a solution to, or nil if it posts none
+func solutionProblemHash(tx *bolt.Tx, block *Block) []byte {
+	if len(block.SolutionHash) == 0 {
+		return nil
+	}
+	if aliases := tx.Bucket([]byte(problemAliasesBucket)); aliases != nil {
+		if canonical := aliases.Get(block.SolutionHash); canonical != nil {
+			return canonical
+		}
+	}
+
+	return block.SolutionHash
+}
+
+// connectSolution indexes the solution of a block added on top of the
+// active chain
+func connectSolution(tx *bolt.Tx, block *Block) error {
+	pgHash := solutionProblemHash(tx, block)
+	if pgHash == nil {
+		return nil
+	}
+	b, err := tx.Bucket([]byte(solutionIndexBucket)).CreateBucketIfNotExists(pgHash)
+	if err != nil {
+		return err
+	}
+
+	record := SolutionRecord{block.Height, block.Hash, block.Solution, block.Height}
+	if k, v := b.Cursor().Last(); k != nil {
+		last, err := deserializeSolutionRecord(v)
+		if err != nil {
+			return err
+		}
+		best, err := deserializeSolutionRecord(b.Get(solutionKey(last.BestHeight)))
+		if err != nil {
+			return err
+		}
+		if len(best.Clique) > len(block.Solution) {
+			record.BestHeight = best.Height
+		}
+	}
+	data, err := record.serialize()
+	if err != nil {
+		return err
+	}
+
+	return b.Put(solutionKey(block.Height), data)
+}
+
+// disconnectSolution removes the solution of the tip of the active chain
+// from the index
+func disconnectSolution(tx *bolt.Tx, block *Block) error {
+	pgHash := solutionProblemHash(tx, block)
+	if pgHash == nil {
+		return nil
+	}
+	b := tx.Bucket([]byte(solutionIndexBucket)).Bucket(pgHash)
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete(solutionKey(block.Height))
+}
+
+// updateSolutionIndex moves the index from the tip oldTip to newTip: the
+// blocks of the old branch are disconnected down to the fork, then the ones
+// of the new branch are connected
+func updateSolutionIndex(tx *bolt.Tx, oldTip []byte, newTip []byte) error {
+	blocks := tx.Bucket([]byte(blocksBucket))
+	oldBlock := DeserializeBlock(blocks.Get(oldTip))
+	newBlock := DeserializeBlock(blocks.Get(newTip))
+
+	var connect []*Block
+	for oldBlock.Height > newBlock.Height {
+		if err := disconnectSolution(tx, oldBlock); err != nil {
+			return err
+		}
+		oldBlock = DeserializeBlock(blocks.Get(oldBlock.PrevBlockHash))
+	}
+	for newBlock.Height > oldBlock.Height {
+		connect = append(connect, newBlock)
+		newBlock = DeserializeBlock(blocks.Get(newBlock.PrevBlockHash))
+	}
+	for !Equal(oldBlock.Hash, newBlock.Hash) {
+		if err := disconnectSolution(tx, oldBlock); err != nil {
+			return err
+		}
+		connect = append(connect, newBlock)
+		oldBlock = DeserializeBlock(blocks.Get(oldBlock.PrevBlockHash))
+		newBlock = DeserializeBlock(blocks.Get(newBlock.PrevBlockHash))
+	}
+
+	for i := len(connect) - 1; i >= 0; i-- {
+		if err := connectSolution(tx, connect[i]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket([]byte(solutionIndexBucket)).Put(solutionIndexTipKey, newTip)
+}
+
+// reindexSolutions rebuilds the solution index of the active chain if it is
+// missing or out of date, as in DBs made before it existed
+func reindexSolutions(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(blocksBucket))
+		tip := blocks.Get([]byte("l"))
+		if index := tx.Bucket([]byte(solutionIndexBucket)); index != nil {
+			if Equal(index.Get(solutionIndexTipKey), tip) {
+				return nil
+			}
+			if err := tx.DeleteBucket([]byte(solutionIndexBucket)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(solutionIndexBucket)); err != nil {
+			return err
+		}
+
+		var chain []*Block
+		for hash := tip; len(hash) > 0; {
+			block := DeserializeBlock(blocks.Get(hash))
+			chain = append(chain, block)
+			hash = block.PrevBlockHash
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			if err := connectSolution(tx, chain[i]); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket([]byte(solutionIndexBucket)).Put(solutionIndexTipKey, tip)
+	})
+}
+
+// SolutionHistory returns the solutions posted to the problem graph with
+// canonical hash pgHash in the active chain, by increasing height
+func (bc *Blockchain) SolutionHistory(pgHash []byte) ([]SolutionRecord, error) {
+	var history []SolutionRecord
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(solutionIndexBucket)).Bucket(pgHash)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			record, err := deserializeSolutionRecord(v)
+			history = append(history, record)
+			return err
+		})
+	})
+
+	return history, err
+}
+
+// bestSolution returns the best solution to the problem graph with canonical
+// hash pgHash posted up to height, with a seek in the index
+func (bc *Blockchain) bestSolution(pgHash []byte, height int) (SolutionRecord, bool, error) {
+	var best SolutionRecord
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(solutionIndexBucket)).Bucket(pgHash)
+		if b == nil || height < 0 {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.Seek(solutionKey(height + 1))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			return nil
+		}
+
+		last, err := deserializeSolutionRecord(v)
+		if err != nil {
+			return err
+		}
+		best, err = deserializeSolutionRecord(b.Get(solutionKey(last.BestHeight)))
+		found = err == nil
+		return err
+	})
+
+	return best, found, err
+}
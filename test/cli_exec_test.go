@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+// execJSON runs a one-shot command in JSON mode and returns its exit code and output
+func execJSON(args ...string) (int, []byte) {
+	var out bytes.Buffer
+	cli := crickchain.CLI{Out: &out}
+	code := cli.Exec(append([]string{"-json"}, args...))
+
+	return code, out.Bytes()
+}
+
+func TestExecExitCodesAndJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	flags := []string{"-node", "1", "-datadir", dir}
+	owner := newAddress(t)
+
+	code, _ := execJSON(append(flags, "getbalance")...)
+	assert.Equal(t, 2, code, "a missing argument is a usage error")
+	code, _ = execJSON(append(flags, "nosuchcommand")...)
+	assert.Equal(t, 2, code)
+	code, _ = execJSON(append(flags, "getdiff")...)
+	assert.Equal(t, 1, code, "there is no blockchain yet")
+
+	code, out := execJSON(append(flags, "createblockchain", owner)...)
+	assert.Equal(t, 0, code)
+	var genesis struct {
+		Hash   string
+		Height int
+	}
+	assert.Nil(t, json.Unmarshal(out, &genesis), string(out))
+	assert.Equal(t, 0, genesis.Height)
+
+	code, out = execJSON(append(flags, "getbalance", owner)...)
+	assert.Equal(t, 0, code)
+	var balance struct {
+		Address string
+		Balance int
+	}
+	assert.Nil(t, json.Unmarshal(out, &balance), string(out))
+	assert.Equal(t, owner, balance.Address)
+	assert.Equal(t, 10, balance.Balance)
+
+	code, out = execJSON(append(flags, "printblock", "0")...)
+	assert.Equal(t, 0, code)
+	var block struct {
+		Hash         string
+		Valid        bool
+		Transactions []struct {
+			Coinbase bool
+			Outputs  []struct {
+				Value   int
+				Address string
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(out, &block), string(out))
+	assert.Equal(t, genesis.Hash, block.Hash)
+	assert.Len(t, block.Transactions, 1)
+	assert.True(t, block.Transactions[0].Coinbase)
+	assert.Equal(t, owner, block.Transactions[0].Outputs[0].Address)
+
+	code, _ = execJSON(append(flags, "printblock", "x")...)
+	assert.Equal(t, 2, code)
+
+	// creategraph shows the graph of the next block without storing it
+	code, out = execJSON(append(flags, "-graphnodes", "60", "-graphedges", "885", "creategraph")...)
+	assert.Equal(t, 0, code)
+	var problem struct {
+		Hash  string
+		Nodes int
+	}
+	assert.Nil(t, json.Unmarshal(out, &problem), string(out))
+	assert.Equal(t, 60, problem.Nodes)
+	code, _ = execJSON(append(flags, "printproblem", problem.Hash)...)
+	assert.Equal(t, 1, code)
+
+	code, out = execJSON(append(flags, "listaddresses")...)
+	assert.Equal(t, 0, code, "a missing wallet file has no addresses")
+	assert.Equal(t, "[]\n", string(out))
+
+	// an encrypted wallet is unlocked for one command by -passphrase-file
+	walletFile := crickchain.Config{NodeID: "1", DataDir: dir}.WalletPath()
+	assert.Nil(t, crickchain.EncryptWallet(walletFile, "correct horse"))
+	code, _ = execJSON(append(flags, "listaddresses")...)
+	assert.Equal(t, 1, code, "the wallet is locked")
+	passphraseFile := filepath.Join(dir, "passphrase")
+	assert.Nil(t, ioutil.WriteFile(passphraseFile, []byte("correct horse\n"), 0600))
+	code, out = execJSON(append(flags, "-passphrase-file", passphraseFile, "listaddresses")...)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "[]\n", string(out))
+	_, err = crickchain.NewWallets(walletFile)
+	assert.Equal(t, crickchain.ErrWalletLocked, err, "the wallet is locked again after the command")
+	assert.Nil(t, ioutil.WriteFile(passphraseFile, []byte("wrong"), 0600))
+	code, _ = execJSON(append(flags, "-passphrase-file", passphraseFile, "listaddresses")...)
+	assert.Equal(t, 1, code)
+
+	var text bytes.Buffer
+	cli := crickchain.CLI{Out: &text}
+	assert.Equal(t, 0, cli.Exec(append(flags, "getbalance", owner)))
+	assert.Equal(t, fmt.Sprintf("Balance of '%s': 10\n", owner), text.String(), "text results go to Out too")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+// bruteForceCliques counts the k-cliques of a graph by checking every set of
+// k nodes
+func bruteForceCliques(pg *crickchain.ProblemGraph, k int) int {
+	count := 0
+	var choose func(clique []int, from int)
+	choose = func(clique []int, from int) {
+		if len(clique) == k {
+			if pg.ValidateClique(clique) {
+				count++
+			}
+			return
+		}
+		for n := from; n < pg.Graph.Order(); n++ {
+			choose(append(clique, n), n+1)
+		}
+	}
+	choose(nil, 0)
+
+	return count
+}
+
+func TestFindAllKCliques(t *testing.T) {
+	// a 5-clique with a pendant node, whose triangles are all sub-cliques
+	pg := problemGraphOf(6, [][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}, {4, 5}})
+	assert.Len(t, pg.FindAllKCliques(3), 10)
+	assert.Len(t, pg.FindAllKCliques(2), 11)
+	assert.Equal(t, [][]int{{0, 1, 2, 3, 4}}, pg.FindAllKCliques(5))
+	assert.Empty(t, pg.FindAllKCliques(6))
+
+	for seed := byte(0); seed < 10; seed++ {
+		pg, err := crickchain.GenerateProblemGraph([]byte{seed}, 12, 30+int(seed)*3)
+		assert.Nil(t, err)
+		for k := 1; k <= 6; k++ {
+			cliques := pg.FindAllKCliques(k)
+			assert.Equal(t, bruteForceCliques(pg, k), len(cliques), "seed %d, k %d", seed, k)
+			for _, clique := range cliques {
+				assert.True(t, pg.ValidateClique(clique))
+			}
+		}
+	}
+}
+
+func TestCliqueSearchSolvers(t *testing.T) {
+	for seed := byte(0); seed < 20; seed++ {
+		pg, err := crickchain.GenerateProblemGraph([]byte{seed}, 16, 40+int(seed)*3)
+		assert.Nil(t, err)
+		omega := 1
+		for len(pg.FindAllKCliques(omega+1)) > 0 {
+			omega++
+		}
+
+		for k := 1; k <= omega+1; k++ {
+			exact, err := crickchain.BranchAndBoundSolver{}.FindKClique(context.Background(), pg, k)
+			assert.Nil(t, err)
+			if k <= omega {
+				assert.True(t, len(exact) >= k && pg.ValidateClique(exact), "seed %d, k %d: %v", seed, k, exact)
+			} else {
+				assert.Empty(t, exact, "seed %d: no clique above %d nodes", seed, omega)
+			}
+
+			heuristic, err := crickchain.GreedySolver{}.FindKClique(context.Background(), pg, k)
+			assert.Nil(t, err)
+			if len(heuristic) > 0 {
+				assert.True(t, len(heuristic) >= k && pg.ValidateClique(heuristic), "seed %d, k %d: %v", seed, k, heuristic)
+			}
+			again, _ := crickchain.GreedySolver{}.FindKClique(context.Background(), pg, k)
+			assert.Equal(t, heuristic, again, "the greedy solver is reproducible")
+		}
+	}
+
+	pg, err := crickchain.GenerateProblemGraph(make([]byte, 32), 200, 17512)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = crickchain.BranchAndBoundSolver{}.FindKClique(ctx, pg, 40)
+	assert.Equal(t, context.Canceled, err)
+	_, err = crickchain.GreedySolver{}.FindKClique(ctx, pg, 40)
+	assert.Equal(t, context.Canceled, err)
+
+	loop := problemGraphOf(3, [][2]int{{0, 1}, {1, 1}})
+	for _, solver := range crickchain.BuiltinSolvers {
+		clique, err := solver.FindKClique(context.Background(), loop, 2)
+		assert.Nil(t, err)
+		assert.Empty(t, clique, "graphs with loops have no solutions")
+	}
+}
+
+func TestBuiltinSolverConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config, err := crickchain.LoadConfig(writeConfig(t, dir, "solver:\n  builtin: branchandbound\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, crickchain.BranchAndBoundSolver{}, config.CliqueSolver())
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "solver:\n  builtin: quantum\n"))
+	assert.Contains(t, err.Error(), "unknown built-in solver")
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "solver:\n  builtin: greedy\n  command: [/opt/solver]\n"))
+	assert.Contains(t, err.Error(), "both")
+}
+
+// BenchmarkCliqueSolvers compares the built-in solvers on G(n, m) graphs of
+// the density mineblockprob uses and of the default size of creategraph. The
+// small k are found by all, the large ones are past the reach of
+// bronkerbosch, the solver of ProblemGraph.FindKClique.
+func BenchmarkCliqueSolvers(b *testing.B) {
+	cases := []struct {
+		nodes, edges int
+		k            []int
+		// slowFrom is the k from which bronkerbosch is skipped
+		slowFrom int
+	}{
+		{200, 17512, []int{20, 28, 34}, 30},
+		{500, 110000, []int{30, 36, 42}, 38},
+	}
+
+	for _, c := range cases {
+		pg, err := crickchain.GenerateProblemGraph(make([]byte, 32), c.nodes, c.edges)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pg.Verifier()
+		for _, k := range c.k {
+			for _, name := range []string{"bronkerbosch", "greedy", "branchandbound"} {
+				solver := crickchain.BuiltinSolvers[name]
+				b.Run(fmt.Sprintf("G(%d,%d)/k=%d/%s", c.nodes, c.edges, k, name), func(b *testing.B) {
+					if name == "bronkerbosch" && k >= c.slowFrom {
+						b.Skip("bronkerbosch takes more than seconds")
+					}
+					for i := 0; i < b.N; i++ {
+						clique, err := solver.FindKClique(context.Background(), pg, k)
+						if err != nil || len(clique) < k {
+							b.Fatalf("no %d-clique found: %v", k, err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
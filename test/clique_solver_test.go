@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBronKerboschSolver(t *testing.T) {
+	pg := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}})
+
+	clique, err := crickchain.BronKerboschSolver{}.FindKClique(context.Background(), pg, 4)
+	assert.Nil(t, err)
+	assert.Len(t, clique, 4)
+	assert.True(t, pg.ValidateClique(clique))
+	clique, err = crickchain.BronKerboschSolver{}.FindKClique(context.Background(), pg, 5)
+	assert.Nil(t, err)
+	assert.Empty(t, clique)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = crickchain.BronKerboschSolver{}.FindKClique(ctx, pg, 5)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestProcessSolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solver")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input")
+	pg := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}})
+
+	solver := func(script string) crickchain.ProcessSolver {
+		return crickchain.ProcessSolver{Command: []string{"sh", "-c", script}, Timeout: 5 * time.Second}
+	}
+
+	clique, err := solver("cat > "+input+"; echo 'c found one'; echo '1 2'; echo '3 4'").FindKClique(context.Background(), pg, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3}, clique)
+	data, err := ioutil.ReadFile(input)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, []string{"c k 4", "p edge 5 7"}, lines[:2])
+	assert.Len(t, lines, 9)
+	assert.Contains(t, lines, "e 4 5")
+
+	clique, err = solver("echo 1 2 3").FindKClique(context.Background(), pg, 4)
+	assert.Nil(t, err)
+	assert.Empty(t, clique, "smaller cliques are not found ones")
+	clique, err = solver("true").FindKClique(context.Background(), pg, 4)
+	assert.Nil(t, err)
+	assert.Empty(t, clique)
+	_, err = solver("yes c | head -c 2000000").FindKClique(context.Background(), pg, 4)
+	assert.Contains(t, err.Error(), "printed more than")
+
+	_, err = solver("echo 1 5").FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "not a clique")
+	_, err = solver("echo 1 1").FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "not a clique")
+	_, err = solver("echo 1 9").FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "not a clique")
+	_, err = solver("echo one two").FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "invalid node")
+	_, err = solver("echo broken >&2; exit 3").FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "broken")
+
+	slow := solver("sleep 5")
+	slow.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err = slow.FindKClique(context.Background(), pg, 2)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, time.Since(start) < 4*time.Second)
+}
+
+func TestSolverConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config, err := crickchain.LoadConfig(writeConfig(t, dir, "solver:\n  command: [/opt/solver, -q]\n  timeout: 30s\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, crickchain.ProcessSolver{Command: []string{"/opt/solver", "-q"}, Timeout: 30 * time.Second}, config.CliqueSolver())
+	assert.Equal(t, crickchain.BronKerboschSolver{}, crickchain.Config{}.CliqueSolver())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/soniakeys/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyValidateClique is ValidateClique as it was before the bitset, which
+// removed and added back every edge of the clique
+func legacyValidateClique(pg *crickchain.ProblemGraph, clique []int) bool {
+	for _, n := range clique {
+		for _, m := range clique {
+			if n != m {
+				if !pg.Graph.RemoveEdge(graph.NI(n), graph.NI(m)) {
+					return false
+				}
+				pg.Graph.AddEdge(graph.NI(n), graph.NI(m))
+			}
+		}
+	}
+	return true
+}
+
+func TestCliqueVerifier(t *testing.T) {
+	pg := problemGraphOf(70, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}, {3, 65}, {4, 65}, {66, 69}})
+	encoding := pg.CanonicalEncoding()
+
+	for _, clique := range [][]int{{}, {5}, {0, 1}, {2, 0, 1}, {0, 1, 2, 3}, {3, 4, 65}, {69, 66}} {
+		assert.True(t, pg.ValidateClique(clique), "%v", clique)
+	}
+	for _, clique := range [][]int{{0, 4}, {0, 1, 2, 3, 4}, {0, 1, 1}, {3, 3}, {70}, {-1, 0}, {0, 1, 2, 3, 100}, {65, 66}} {
+		assert.False(t, pg.ValidateClique(clique), "%v", clique)
+	}
+	assert.Equal(t, encoding, pg.CanonicalEncoding(), "the graph is not changed")
+
+	verifier := pg.Verifier()
+	clique := []int{0, 1, 2, 3}
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		verifier.IsClique(clique)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if !pg.ValidateClique(clique) || pg.ValidateClique([]int{0, 4}) {
+					t.Error("concurrent validation failed")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCliqueVerifierCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verifiers")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bc, err := crickchain.CreateBlockchainWithParams(newAddress(t), filepath.Join(dir, "chain.db"), crickchain.Networks["regtest"])
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+
+	pg, err := bc.NextProblemGraph(60, 885)
+	assert.Nil(t, err)
+	copied := *pg
+	assert.Same(t, pg.Verifier(), copied.Verifier(), "copies of a graph share its verifier")
+
+	// the graphs read from the chain share the verifier of their hash
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	first, err := bc.GetProblemGraphFromHash(pg.Hash)
+	assert.Nil(t, err)
+	second, err := bc.GetProblemGraphFromHash(pg.Hash)
+	assert.Nil(t, err)
+	assert.Same(t, first.Verifier(), second.Verifier())
+	assert.NotSame(t, pg.Verifier(), first.Verifier())
+}
+
+func FuzzValidateClique(f *testing.F) {
+	f.Add(uint8(5), []byte{0, 1, 0, 2, 1, 2, 3, 4}, []byte{8, 9, 10})
+	f.Add(uint8(5), []byte{0, 1, 0, 2, 1, 2}, []byte{8, 9, 9})
+	f.Add(uint8(40), []byte{1, 39, 39, 2, 2, 1}, []byte{9, 47, 10})
+	f.Add(uint8(3), []byte{}, []byte{0, 200})
+
+	f.Fuzz(func(t *testing.T, nodes uint8, edges []byte, nodesOfClique []byte) {
+		n := int(nodes%64) + 1
+		g := graph.Undirected{AdjacencyList: make(graph.AdjacencyList, n)}
+		added := make(map[[2]int]bool)
+		for i := 0; i+1 < len(edges); i += 2 {
+			u, v := int(edges[i])%n, int(edges[i+1])%n
+			if u > v {
+				u, v = v, u
+			}
+			if u != v && !added[[2]int{u, v}] {
+				g.AddEdge(graph.NI(u), graph.NI(v))
+				added[[2]int{u, v}] = true
+			}
+		}
+		pg := &crickchain.ProblemGraph{Graph: &g}
+
+		// nodes of the clique go from -8, to test the ones out of range
+		var clique []int
+		valid := true
+		seen := make(map[int]bool)
+		for _, b := range nodesOfClique {
+			node := int(b) - 8
+			clique = append(clique, node)
+			valid = valid && node >= 0 && node < n && !seen[node]
+			seen[node] = true
+		}
+		if valid {
+			valid = legacyValidateClique(&crickchain.ProblemGraph{Graph: &g}, clique)
+		}
+
+		if got := pg.ValidateClique(clique); got != valid {
+			t.Fatalf("ValidateClique(%v) = %v, legacy check of distinct nodes in range gives %v", clique, got, valid)
+		}
+	})
+}
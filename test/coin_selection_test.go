@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCoins(values ...int) []crickchain.Coin {
+	var coins []crickchain.Coin
+	for i, value := range values {
+		coins = append(coins, crickchain.Coin{TxID: []byte{byte(i)}, Vout: 0, Value: value})
+	}
+
+	return coins
+}
+
+func coinsValue(coins []crickchain.Coin) int {
+	total := 0
+	for _, coin := range coins {
+		total += coin.Value
+	}
+
+	return total
+}
+
+func TestLargestFirst(t *testing.T) {
+	chosen, err := crickchain.LargestFirst{}.Select(testCoins(1, 8, 3, 5), 10)
+	assert.Nil(t, err)
+	assert.Len(t, chosen, 2)
+	assert.Equal(t, 13, coinsValue(chosen))
+
+	_, err = crickchain.LargestFirst{}.Select(testCoins(1, 2), 4)
+	assert.Equal(t, crickchain.ErrInsufficientFunds, err)
+}
+
+func TestBranchAndBoundAvoidsChange(t *testing.T) {
+	coins := testCoins(7, 6, 5, 4, 3, 2, 2)
+
+	chosen, err := crickchain.BranchAndBound{}.Select(coins, 11)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, coinsValue(chosen))
+	assert.Len(t, chosen, 2, "the exact match with the fewest inputs is chosen")
+
+	_, err = crickchain.BranchAndBound{}.Select(testCoins(5, 10), 7)
+	assert.Equal(t, crickchain.ErrNoExactMatch, err)
+
+	chosen, err = crickchain.BranchAndBound{Fallback: crickchain.LargestFirst{}}.Select(testCoins(5, 10), 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, coinsValue(chosen))
+
+	_, err = crickchain.BranchAndBound{}.Select(coins, 100)
+	assert.Equal(t, crickchain.ErrInsufficientFunds, err)
+}
+
+func TestRandomSelectionCoversTarget(t *testing.T) {
+	coins := testCoins(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	for i := 0; i < 50; i++ {
+		chosen, err := crickchain.RandomSelection{}.Select(coins, 20)
+		assert.Nil(t, err)
+		assert.True(t, coinsValue(chosen) >= 20)
+		assert.True(t, coinsValue(chosen)-chosen[len(chosen)-1].Value < 20, "no more coins than needed")
+	}
+}
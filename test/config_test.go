@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	filename := filepath.Join(dir, "crick.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(content), 0644))
+
+	return filename
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config, err := crickchain.LoadConfig(writeConfig(t, dir, `
+node: "3001"
+datadir: /var/crick
+network: fast
+seeds: [localhost:3000, localhost:3002]
+graphnodes: 40
+networks:
+  fast:
+    blocksPerTargetUpdate: 4
+    targetBlocksPerMinute: 600
+    eta: 0.5
+    maxTargetChange: 2
+    initialTargetBits: 3
+    initialReducedTargetBits: 1
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "3001", config.NodeID)
+	assert.Equal(t, filepath.Join("/var/crick", "blockchain_3001.db"), config.DBPath())
+	assert.Equal(t, []string{"localhost:3000", "localhost:3002"}, config.Seeds)
+	assert.Equal(t, 40, config.GraphNodes)
+	params, err := config.NetworkParams()
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", params.Name)
+	assert.Equal(t, 4, params.BlocksPerTargetUpdate)
+	assert.Equal(t, crickchain.Networks["main"].Problems, params.Problems, "profiles without problem rules get the main ones")
+
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "nodeid: 3001\n"))
+	assert.Error(t, err, "unknown keys are rejected")
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "network: nosuchnet\n"))
+	assert.Error(t, err)
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "networks:\n  main:\n    blocksPerTargetUpdate: 1\n"))
+	assert.Error(t, err, "built-in profiles can't be redefined")
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "networks:\n  broken:\n    blocksPerTargetUpdate: 0\n"))
+	assert.Error(t, err)
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "networks:\n  broken:\n    blocksPerTargetUpdate: 1\n    targetBlocksPerMinute: 1\n    eta: 0.5\n    maxTargetChange: 1\n    initialTargetBits: 2\n    initialReducedTargetBits: 1\n    problems: {minNodes: 10, maxNodes: 5}\n"))
+	assert.Error(t, err, "problem rules must admit some graphs")
+	_, err = crickchain.LoadConfig(writeConfig(t, dir, "networks:\n  huge:\n    blocksPerTargetUpdate: 1\n    targetBlocksPerMinute: 1\n    eta: 0.5\n    maxTargetChange: 1\n    initialTargetBits: 2\n    initialReducedTargetBits: 1\n    problems: {minNodes: 10, maxNodes: 100000}\n"))
+	assert.Contains(t, err.Error(), "at most")
+}
+
+func TestNetworkParamsAreStored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "chain.db")
+	owner := newAddress(t)
+
+	regtest, err := crickchain.LookupNetwork("regtest")
+	assert.Nil(t, err)
+	bc, err := crickchain.CreateBlockchainWithParams(owner, dbFile, regtest)
+	assert.Nil(t, err)
+	bc.CloseDB()
+
+	bc, err = crickchain.NewBlockchain(dbFile)
+	assert.Nil(t, err)
+	assert.Equal(t, regtest, bc.Params())
+	assert.Equal(t, regtest.BlocksPerTargetUpdate, bc.GetBlocksPerTargetUpdate())
+	target, err := bc.CalculateTarget(0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Int).Lsh(big.NewInt(1), 256-uint(regtest.InitialTargetBits)), target)
+	bc.CloseDB()
+
+	_, err = crickchain.Open(crickchain.Config{DBFile: dbFile, Network: "main"})
+	assert.Error(t, err, "the chain is not on the main network")
+	node, err := crickchain.Open(crickchain.Config{DBFile: dbFile, Network: "regtest"})
+	assert.Nil(t, err)
+	node.Close()
+}
+
+func TestExecWithConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execconfig")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := writeConfig(t, dir, fmt.Sprintf("dbfile: %s\nwalletfile: %s\nnetwork: test\n",
+		filepath.Join(dir, "chain.db"), filepath.Join(dir, "wallet.dat")))
+	owner := newAddress(t)
+
+	code, _ := execJSON("-config", filename, "-network", "nosuchnet", "getdiff")
+	assert.Equal(t, 2, code)
+	code, _ = execJSON("-config", filename, "-network", "regtest", "createblockchain", owner)
+	assert.Equal(t, 0, code, "flags override the file")
+
+	code, out := execJSON("-config", filename, "printblock", "0")
+	assert.Equal(t, 0, code)
+	var block struct{ Target string }
+	assert.Nil(t, json.Unmarshal(out, &block), string(out))
+	assert.Equal(t, fmt.Sprintf("%064x", new(big.Int).Lsh(big.NewInt(1), 256-4)), block.Target)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibraryReturnsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "chain.db")
+
+	_, err = crickchain.NewBlockchain(dbFile)
+	assert.Equal(t, crickchain.ErrNoBlockchain, err)
+
+	_, err = crickchain.CreateBlockchain("not-an-address", dbFile)
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidAddress))
+	var addressErr *crickchain.InvalidAddressError
+	assert.True(t, errors.As(err, &addressErr))
+	assert.Equal(t, "not-an-address", addressErr.Address)
+
+	owner := newAddress(t)
+	bc, err := crickchain.CreateBlockchain(owner, dbFile)
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	UTXOSet := crickchain.UTXOSet{Blockchain: bc}
+	assert.Nil(t, UTXOSet.Reindex())
+
+	_, err = crickchain.CreateBlockchain(owner, dbFile)
+	assert.Equal(t, crickchain.ErrBlockchainExists, err)
+
+	_, err = bc.GetBlockFromHeight(5)
+	assert.True(t, errors.Is(err, crickchain.ErrBlockNotFound))
+	_, err = bc.GetBlockFromHash([]byte("missing"))
+	var blockErr *crickchain.BlockNotFoundError
+	assert.True(t, errors.As(err, &blockErr))
+	assert.Equal(t, []byte("missing"), blockErr.Hash)
+
+	_, err = bc.GetNumberOfBlocks(0, 5, false)
+	assert.Error(t, err, "a range past the tip is rejected")
+
+	friend := newAddress(t)
+	_, err = UTXOSet.PlanPayments(owner, []crickchain.Payment{{Address: friend, Amount: 1000}}, crickchain.DefaultCoinSelector)
+	assert.True(t, errors.Is(err, crickchain.ErrInsufficientFunds))
+	var fundsErr *crickchain.InsufficientFundsError
+	assert.True(t, errors.As(err, &fundsErr))
+	assert.Equal(t, 1000, fundsErr.Needed)
+	assert.Equal(t, 10, fundsErr.Available)
+
+	_, err = UTXOSet.PlanPayments(owner, []crickchain.Payment{{Address: "bogus", Amount: 1}}, crickchain.DefaultCoinSelector)
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidAddress))
+}
+
+func TestLegacyBlockchainIsRefused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legacy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "chain.db")
+
+	// the checked-in chain has outputs holding pubkey hashes, not scripts
+	copyFile(t, filepath.Join("..", "main", "blockchain_3000.db"), dbFile)
+	_, err = crickchain.NewBlockchain(dbFile)
+	assert.Equal(t, crickchain.ErrLegacyBlockchain, err)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func nextEvent(t *testing.T, sub *crickchain.Subscription) crickchain.Event {
+	select {
+	case e := <-sub.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+
+	return crickchain.Event{}
+}
+
+func TestEvents(t *testing.T) {
+	owner := newWallet(t)
+	ownerAddress := string(owner.GetAddress())
+	node, closeNode := openTestNode(t, ownerAddress, crickchain.Config{
+		ListenAddress: "127.0.0.1:0",
+		RPCAddress:    "127.0.0.1:0",
+		RPCToken:      "secret",
+	})
+	defer closeNode()
+	assert.Nil(t, node.Start())
+
+	_, err := node.Subscribe(crickchain.EventFilter{Addresses: []string{"bogus"}})
+	assert.Error(t, err)
+
+	friend := newAddress(t)
+	stranger := newAddress(t)
+	all, err := node.Subscribe(crickchain.EventFilter{})
+	assert.Nil(t, err)
+	defer all.Close()
+	paid, err := node.Subscribe(crickchain.EventFilter{Addresses: []string{friend}})
+	assert.Nil(t, err)
+	defer paid.Close()
+	unrelated, err := node.Subscribe(crickchain.EventFilter{Addresses: []string{stranger}, Problems: []string{"00"}})
+	assert.Nil(t, err)
+	defer unrelated.Close()
+
+	response, err := http.Get("http://" + node.RPCAddress() + crickchain.EventsPath + "?type=tip")
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	response, err = http.Get("http://" + node.RPCAddress() + crickchain.EventsPath + "?type=tip&token=secret")
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	tx, err := crickchain.NewUTXOTransaction(owner, friend, 4, 0, &crickchain.UTXOSet{Blockchain: node.Blockchain()})
+	assert.Nil(t, err)
+	assert.Nil(t, node.Submit(tx))
+	e := nextEvent(t, all)
+	assert.Equal(t, crickchain.EventTx, e.Type)
+	assert.Equal(t, hex.EncodeToString(tx.ID), e.TxID)
+	assert.Equal(t, crickchain.EventTx, nextEvent(t, paid).Type)
+
+	block, err := node.MineBlock(ownerAddress)
+	assert.Nil(t, err)
+	e = nextEvent(t, all)
+	assert.Equal(t, crickchain.EventTip, e.Type)
+	assert.Equal(t, 1, e.Height)
+	assert.Equal(t, hex.EncodeToString(block.Hash), e.BlockHash)
+	assert.Equal(t, crickchain.EventTip, nextEvent(t, paid).Type, "the block pays the address")
+
+	stream := bufio.NewReader(response.Body)
+	line, err := stream.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "event: tip\n", line)
+	line, err = stream.ReadString('\n')
+	assert.Nil(t, err)
+	var streamed crickchain.Event
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &streamed))
+	assert.Equal(t, e.BlockHash, streamed.BlockHash)
+
+	select {
+	case e := <-unrelated.Events():
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestSolutionEvents(t *testing.T) {
+	node, closeNode := openTestNode(t, newAddress(t), crickchain.Config{ListenAddress: "127.0.0.1:0"})
+	defer closeNode()
+	assert.Nil(t, node.Start())
+	bc := node.Blockchain()
+	solutions, err := node.Subscribe(crickchain.EventFilter{Types: []string{crickchain.EventSolution}})
+	assert.Nil(t, err)
+	defer solutions.Close()
+
+	receive := func(block *crickchain.Block) {
+		sendMessage(t, node.Address(), "block", struct {
+			AddrFrom string
+			Block    []byte
+		}{"127.0.0.1:1", block.Serialize()})
+		deadline := time.Now().Add(5 * time.Second)
+		for height, _ := node.BestHeight(); height < block.Height && time.Now().Before(deadline); height, _ = node.BestHeight() {
+			time.Sleep(20 * time.Millisecond)
+		}
+		height, err := node.BestHeight()
+		assert.Nil(t, err)
+		assert.Equal(t, block.Height, height)
+	}
+
+	// a clique of a graph no block introduced is no solution
+	stored := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {1, 2}})
+	assert.Nil(t, bc.AddProblemGraph(stored))
+	block, err := bc.MineBlock(nil, stored.Hash, []int{0, 1, 2}, []byte{})
+	assert.Nil(t, err)
+	receive(block)
+
+	pg, err := bc.NextProblemGraph(60, 885)
+	assert.Nil(t, err)
+	clique := pg.FindKClique(3)
+	block, err = bc.MineProblemBlock(nil, pg, clique[:2])
+	assert.Nil(t, err)
+	receive(block)
+	e := nextEvent(t, solutions)
+	assert.Equal(t, 2, e.Height, "the initial solution is the first")
+	assert.Equal(t, hex.EncodeToString(pg.Hash), e.ProblemHash)
+	assert.Equal(t, clique[:2], e.Solution)
+
+	block, err = bc.MineBlock(nil, pg.Hash, clique, []byte{})
+	assert.Nil(t, err)
+	receive(block)
+	e = nextEvent(t, solutions)
+	assert.Equal(t, 3, e.Height)
+	assert.Equal(t, clique, e.Solution)
+}
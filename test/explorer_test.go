@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplorer(t *testing.T) {
+	owner := newWallet(t)
+	ownerAddress := string(owner.GetAddress())
+	node, closeNode := openTestNode(t, ownerAddress, crickchain.Config{
+		ListenAddress: "127.0.0.1:0",
+		RPCAddress:    "127.0.0.1:0",
+		RPCToken:      "secret",
+	})
+	defer closeNode()
+	assert.Nil(t, node.Start())
+	url := "http://" + node.RPCAddress()
+	assert.Equal(t, url+crickchain.ExplorerPath+"?token=secret", node.ExplorerURL())
+
+	for _, file := range []string{"", "explorer.js", "explorer.css"} {
+		response, err := http.Get(url + crickchain.ExplorerPath + file)
+		assert.Nil(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode, file)
+	}
+
+	friend := newAddress(t)
+	tx, err := crickchain.NewUTXOTransaction(owner, friend, 4, 0, &crickchain.UTXOSet{Blockchain: node.Blockchain()})
+	assert.Nil(t, err)
+	assert.Nil(t, node.Submit(tx))
+	_, err = node.MineBlock(friend)
+	assert.Nil(t, err)
+
+	var blocks []struct {
+		Height       int
+		Transactions int
+	}
+	assert.Nil(t, rpcCall(t, url, "getblocks", nil, &blocks))
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, 1, blocks[0].Height, "newest first")
+	assert.Equal(t, 2, blocks[0].Transactions)
+	assert.Nil(t, rpcCall(t, url, "getblocks", []int{0, 5}, &blocks))
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, 0, blocks[0].Height)
+	assert.NotNil(t, rpcCall(t, url, "getblocks", []int{1, 101}, &blocks), "at most 100 blocks")
+
+	var found struct {
+		ID     string
+		Height int
+	}
+	assert.Nil(t, rpcCall(t, url, "gettransaction", []string{hex.EncodeToString(tx.ID)}, &found))
+	assert.Equal(t, 1, found.Height)
+	assert.NotNil(t, rpcCall(t, url, "gettransaction", []string{"00"}, nil))
+
+	var address struct {
+		Balance      int
+		Transactions []struct {
+			TxID           string
+			Height         int
+			Received, Sent int
+		}
+	}
+	assert.Nil(t, rpcCall(t, url, "getaddress", []string{ownerAddress}, &address))
+	assert.Equal(t, 6, address.Balance)
+	assert.Len(t, address.Transactions, 2)
+	assert.Equal(t, hex.EncodeToString(tx.ID), address.Transactions[0].TxID)
+	assert.Equal(t, 10, address.Transactions[0].Sent)
+	assert.Equal(t, 6, address.Transactions[0].Received, "the change")
+	assert.Equal(t, 0, address.Transactions[1].Height, "the genesis coinbase comes last")
+	assert.Equal(t, 10, address.Transactions[1].Received)
+
+	pg, err := crickchain.NewProblemGraph(10, 20)
+	assert.Nil(t, err)
+	assert.Nil(t, node.Blockchain().AddProblemGraph(pg))
+	var problem struct {
+		Nodes     int
+		Adjacency [][]int
+	}
+	assert.Nil(t, rpcCall(t, url, "getproblem", []interface{}{hex.EncodeToString(pg.Hash), true}, &problem))
+	assert.Equal(t, 10, problem.Nodes)
+	assert.Len(t, problem.Adjacency, 10)
+	var problems []struct{ Hash string }
+	assert.Nil(t, rpcCall(t, url, "getproblems", nil, &problems))
+}
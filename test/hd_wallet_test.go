@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHDWalletRestore(t *testing.T) {
+	mnemonic, err := crickchain.NewMnemonic()
+	assert.Nil(t, err)
+
+	wallets := crickchain.Wallets{Wallets: make(map[string]*crickchain.Wallet)}
+	assert.Nil(t, wallets.SetHDWallet(mnemonic))
+	assert.NotNil(t, wallets.SetHDWallet(mnemonic), "the seed of a wallet is never replaced")
+	first, second := createWallet(t, &wallets), createWallet(t, &wallets)
+	assert.NotEqual(t, first, second)
+
+	restored, err := crickchain.NewHDWallet(mnemonic)
+	assert.Nil(t, err)
+	assert.Equal(t, first, string(restored.DeriveWallet(0).GetAddress()))
+	assert.Equal(t, second, string(restored.DeriveWallet(1).GetAddress()))
+
+	_, err = crickchain.NewHDWallet("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+	assert.NotNil(t, err, "mnemonics with a bad checksum are rejected")
+}
+
+func TestHDWalletKeysSign(t *testing.T) {
+	mnemonic, _ := crickchain.NewMnemonic()
+	hd, _ := crickchain.NewHDWallet(mnemonic)
+	owner := hd.DeriveWallet(7)
+	assert.Len(t, owner.PublicKey, 64)
+
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	tx, prevTXs := spendingTx(prev, string(owner.GetAddress()))
+	tx.Sign(owner.PrivateKey, prevTXs)
+	assert.True(t, tx.Verify(prevTXs))
+}
+
+func TestScanHDAddressesGapLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdscan")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	mnemonic, _ := crickchain.NewMnemonic()
+	hd, _ := crickchain.NewHDWallet(mnemonic)
+	address := func(index uint32) string {
+		return string(hd.DeriveWallet(index).GetAddress())
+	}
+
+	// addresses 0 and 4 are paid, 1 to 3 are not
+	bc, err := crickchain.CreateBlockchain(address(0), filepath.Join(dir, "chain.db"))
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	genesis := bc.Iterator().Next()
+	target, err := bc.GetBlockTarget(genesis.Height, []byte{}, []int{}, []byte{})
+	assert.Nil(t, err)
+	coinbase := newCoinbase(t, address(4), "")
+	assert.Nil(t, bc.AddBlock(crickchain.NewBlock([]*crickchain.Transaction{coinbase}, genesis.Hash, 1, target, []byte{}, []int{}, []byte{})))
+	UTXOSet := crickchain.UTXOSet{Blockchain: bc}
+	assert.Nil(t, UTXOSet.Reindex())
+
+	wallets := newTestWallets()
+	assert.Nil(t, wallets.SetHDWallet(mnemonic))
+	found, err := wallets.ScanHDAddresses(&UTXOSet, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{address(0)}, found, "the scan stops after 3 unused addresses")
+	assert.Equal(t, uint32(1), wallets.HD.NextIndex)
+	assert.Len(t, wallets.GetAddresses(), 1)
+
+	wallets = newTestWallets()
+	assert.Nil(t, wallets.SetHDWallet(mnemonic))
+	found, err = wallets.ScanHDAddresses(&UTXOSet, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{address(0), address(4)}, found, "address 4 is past a gap of 3")
+	assert.Equal(t, uint32(5), wallets.HD.NextIndex)
+	assert.Len(t, wallets.GetAddresses(), 5, "the addresses of the gap are kept")
+	assert.Equal(t, address(5), createWallet(t, wallets))
+}
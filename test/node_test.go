@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeSubmitAndMine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	_, err = crickchain.Open(crickchain.Config{DBFile: filepath.Join(dir, "chain.db")})
+	assert.Equal(t, crickchain.ErrNoBlockchain, err)
+
+	owner := newWallet(t)
+	ownerAddress := string(owner.GetAddress())
+	node, closeNode := openTestNode(t, ownerAddress, crickchain.Config{ListenAddress: "127.0.0.1:0"})
+	defer closeNode()
+	assert.Nil(t, node.Start())
+	assert.NotEqual(t, "127.0.0.1:0", node.Address(), "the node reports the port it got")
+	assert.Error(t, node.Start())
+
+	friend := newAddress(t)
+	tx, err := crickchain.NewUTXOTransaction(owner, friend, 4, 0, &crickchain.UTXOSet{Blockchain: node.Blockchain()})
+	assert.Nil(t, err)
+	assert.Nil(t, node.Submit(tx))
+	assert.Len(t, node.Mempool(), 1)
+
+	tampered, err := crickchain.DeserializeTransaction(tx.Serialize())
+	assert.Nil(t, err)
+	tampered.Vout[0].Value = 9
+	assert.Error(t, node.Submit(&tampered), "a tampered transaction is rejected")
+
+	block, err := node.MineBlock(friend)
+	assert.Nil(t, err)
+	height, err := node.BestHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, height)
+	assert.Empty(t, node.Mempool())
+
+	mined, err := node.BlockAtHeight(1)
+	assert.Nil(t, err)
+	assert.Equal(t, block.Hash, mined.Hash)
+	found, err := node.Transaction(tx.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, found.Vout[0].Value)
+
+	balance, err := node.Balance(friend)
+	assert.Nil(t, err)
+	assert.Equal(t, 4+10, balance)
+	balance, err = node.Balance(ownerAddress)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, balance)
+
+	assert.Error(t, node.StartMining("bogus"))
+	assert.Nil(t, node.StartMining(friend))
+	assert.Equal(t, friend, node.MiningAddress())
+	node.StopMining()
+	assert.Equal(t, "", node.MiningAddress())
+
+	assert.Nil(t, node.Stop())
+}
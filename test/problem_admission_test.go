@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemRulesCheckSize(t *testing.T) {
+	rules := crickchain.Networks["main"].Problems
+	assert.Nil(t, rules.CheckSize(500, 110000))
+	for _, size := range [][2]int{{10, 30}, {3000, 3000000}, {100, 100}, {100, 4900}} {
+		err := rules.CheckSize(size[0], size[1])
+		assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem), "%v", size)
+	}
+}
+
+func TestProblemAdmission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admission")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bc, err := crickchain.CreateBlockchain(newAddress(t), filepath.Join(dir, "chain.db"))
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+
+	// mining checks the rules before the proof-of-work
+	small, err := bc.NextProblemGraph(20, 100)
+	assert.Nil(t, err)
+	_, err = bc.MineProblemBlock(nil, small, small.FindKClique(3))
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem))
+	assert.Contains(t, err.Error(), "20 nodes")
+
+	pg, err := bc.NextProblemGraph(60, 885)
+	assert.Nil(t, err)
+	_, err = bc.MineProblemBlock(nil, pg, []int{0})
+	assert.Contains(t, err.Error(), "less than 2 nodes")
+	clique := pg.FindKClique(3)
+	_, err = bc.MineProblemBlock(nil, pg, []int{clique[0], clique[1], clique[1]})
+	assert.Contains(t, err.Error(), "duplicate or unknown node")
+	_, err = bc.MineProblemBlock(nil, pg, []int{clique[0], 60})
+	assert.Contains(t, err.Error(), "duplicate or unknown node")
+
+	// blocks mined elsewhere are checked when added, and must commit to the
+	// parameters of the graph they introduce, even if it is stored
+	height, err := bc.GetBestHeight()
+	assert.Nil(t, err)
+	tip, err := bc.GetBlockFromHeight(height)
+	assert.Nil(t, err)
+	target, err := bc.CurrentTarget(false)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	hashed := crickchain.NewBlock(nil, tip.Hash, tip.Height+1, target, pg.Hash, clique, pg.Hash)
+	err = bc.AddBlock(hashed)
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidBlock))
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem))
+	assert.Contains(t, err.Error(), "doesn't commit to the parameters")
+
+	// the proof-of-work is checked before the problem graph is generated
+	huge := *hashed
+	huge.Problem = &crickchain.ProblemParams{Nodes: math.MaxInt32, Edges: math.MaxInt32}
+	err = bc.AddBlock(&huge)
+	assert.Contains(t, err.Error(), "proof-of-work is not valid")
+
+	block, err := bc.MineProblemBlock(nil, pg, clique)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(block))
+}
+
+func TestHashedProblemAdmission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admission")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// graphs are introduced by their hash below height 3
+	params := hashedProblems()
+	params.SeededProblemsFrom = 3
+	bc, err := crickchain.CreateBlockchainWithParams(newAddress(t), filepath.Join(dir, "chain.db"), params)
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+
+	pg := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}})
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	tip, err := bc.GetBlockFromHeight(0)
+	assert.Nil(t, err)
+	target, err := bc.CurrentTarget(false)
+	assert.Nil(t, err)
+	bad := crickchain.NewBlock(nil, tip.Hash, tip.Height+1, target, pg.Hash, []int{0, 4}, pg.Hash)
+	err = bc.AddBlock(bad)
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem))
+	assert.Contains(t, err.Error(), "not a clique")
+	assert.False(t, bad.Validate(bc))
+
+	block, err := bc.MineBlock(nil, pg.Hash, []int{0, 1, 2}, pg.Hash)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(block))
+
+	// a problem can be introduced once
+	_, err = bc.MineBlock(nil, pg.Hash, []int{0, 1}, pg.Hash)
+	assert.Contains(t, err.Error(), "already in the chain")
+
+	// problem graphs must be simple
+	loops := problemGraphOf(5, [][2]int{{0, 0}, {0, 1}, {1, 2}, {2, 3}, {3, 4}})
+	assert.Nil(t, bc.AddProblemGraph(loops))
+	_, err = bc.MineBlock(nil, loops.Hash, []int{0, 1}, loops.Hash)
+	assert.Contains(t, err.Error(), "loops or parallel edges")
+
+	// from height 3 on, graphs are generated from seeds
+	other := problemGraphOf(5, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}})
+	assert.Nil(t, bc.AddProblemGraph(other))
+	block, err = bc.MineBlock(nil, other.Hash, []int{0, 1}, other.Hash)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(block))
+	empty, err := bc.MineBlock(nil, []byte{}, []int{}, []byte{})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(empty))
+	late := problemGraphOf(5, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 0}})
+	assert.Nil(t, bc.AddProblemGraph(late))
+	_, err = bc.MineBlock(nil, late.Hash, []int{0, 1}, late.Hash)
+	assert.Contains(t, err.Error(), "doesn't commit to the parameters")
+}
+
+func TestSolutionOfStoredProblem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admission")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bc, err := crickchain.CreateBlockchainWithParams(newAddress(t), filepath.Join(dir, "chain.db"), crickchain.Networks["regtest"])
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+
+	// a graph no block introduced doesn't lower the target of its solutions
+	pg, err := bc.NextProblemGraph(20, 100)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	clique := pg.FindKClique(3)
+	normal, err := bc.CurrentTarget(false)
+	assert.Nil(t, err)
+	solved, err := bc.MineBlock(nil, pg.Hash, clique, []byte{})
+	assert.Nil(t, err)
+	assert.False(t, solved.HasValidSolution(bc))
+	assert.Equal(t, 0, normal.Cmp(solved.Target))
+
+	posted, err := bc.MineProblemBlock(nil, pg, clique[:2])
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(posted))
+	reduced, err := bc.CurrentTarget(true)
+	assert.Nil(t, err)
+	solved, err = bc.MineBlock(nil, pg.Hash, clique, []byte{})
+	assert.Nil(t, err)
+	assert.True(t, solved.HasValidSolution(bc))
+	assert.Equal(t, 0, reduced.Cmp(solved.Target))
+	assert.Nil(t, bc.AddBlock(solved))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateProblemGraph(t *testing.T) {
+	seed := crickchain.ProblemSeed([]byte("parent"))
+	pg, err := crickchain.GenerateProblemGraph(seed, 30, 200)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, pg.Graph.Order())
+	assert.Equal(t, 200, pg.Graph.Size())
+	simple, _ := pg.Graph.IsSimple()
+	assert.True(t, simple)
+	assert.Equal(t, seed, pg.Seed)
+
+	again, err := crickchain.GenerateProblemGraph(seed, 30, 200)
+	assert.Nil(t, err)
+	assert.Equal(t, pg.Hash, again.Hash, "the same parameters give the same graph")
+	other, err := crickchain.GenerateProblemGraph(crickchain.ProblemSeed([]byte("uncle")), 30, 200)
+	assert.Nil(t, err)
+	assert.NotEqual(t, pg.Hash, other.Hash)
+
+	complete, err := crickchain.GenerateProblemGraph(seed, 12, 66)
+	assert.Nil(t, err)
+	assert.Equal(t, 66, complete.Graph.Size(), "all the pairs can be picked")
+
+	// the generator is part of consensus, this pins its output
+	known, err := crickchain.GenerateProblemGraph(bytes.Repeat([]byte{0}, 32), 8, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, knownProblemHash, hex.EncodeToString(known.Hash))
+
+	for _, params := range [][2]int{{1, 0}, {10, 46}, {10, -1}} {
+		_, err := crickchain.GenerateProblemGraph(seed, params[0], params[1])
+		assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem), "%v", params)
+	}
+}
+
+const knownProblemHash = "829740caeb45d86b47500709cbba604a0abf6e3626986e8badac6bd591f2d83d"
+
+func TestMineProblemBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	owner := newAddress(t)
+	minerDB := filepath.Join(dir, "miner.db")
+	peerDB := filepath.Join(dir, "peer.db")
+
+	bc, err := crickchain.CreateBlockchain(owner, minerDB)
+	assert.Nil(t, err)
+	bc.CloseDB()
+	copyFile(t, minerDB, peerDB)
+
+	bc, err = crickchain.NewBlockchain(minerDB)
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	pg, err := bc.NextProblemGraph(60, 885)
+	assert.Nil(t, err)
+	block, err := bc.MineProblemBlock(nil, pg, pg.FindKClique(3))
+	assert.Nil(t, err)
+	assert.Equal(t, &crickchain.ProblemParams{Nodes: 60, Edges: 885}, block.Problem)
+	assert.Equal(t, crickchain.ProblemSeed(block.PrevBlockHash), pg.Seed)
+	assert.True(t, block.Validate(bc))
+
+	// the parameters are covered by the proof-of-work and must generate the
+	// graph the block refers to
+	tampered := *block
+	tampered.Problem = &crickchain.ProblemParams{Nodes: 60, Edges: 886}
+	assert.False(t, tampered.Validate(bc))
+
+	other, err := crickchain.NewProblemGraph(60, 885)
+	assert.Nil(t, err)
+	_, err = bc.MineProblemBlock(nil, other, []int{})
+	assert.True(t, errors.Is(err, crickchain.ErrInvalidProblem), "a graph not generated from the tip")
+	assert.False(t, bc.HasProblemGraph(pg.Hash), "the graph is stored with its block")
+	assert.Nil(t, bc.AddBlock(block))
+	assert.True(t, bc.HasProblemGraph(pg.Hash))
+
+	// another node regenerates the graph instead of downloading it, and
+	// stores it only once the block is added
+	peer, err := crickchain.NewBlockchain(peerDB)
+	assert.Nil(t, err)
+	defer peer.CloseDB()
+	assert.True(t, block.Validate(peer))
+	assert.NotNil(t, peer.AddBlock(&tampered))
+	assert.False(t, peer.HasProblemGraph(pg.Hash))
+	assert.Nil(t, peer.AddBlock(block))
+	assert.True(t, peer.HasProblemGraph(pg.Hash))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func copyFile(t *testing.T, from, to string) {
+	data, err := ioutil.ReadFile(from)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(to, data, 0600))
+}
+
+func TestProblemGraphRelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	owner := newAddress(t)
+	minerDB := filepath.Join(dir, "miner.db")
+	peerDB := filepath.Join(dir, "peer.db")
+
+	// regtest admits problem graphs as small as the one below, and peers
+	// fetch the graphs introduced by their hash
+	bc, err := crickchain.CreateBlockchainWithParams(owner, minerDB, hashedProblems())
+	assert.Nil(t, err)
+	bc.CloseDB()
+	copyFile(t, minerDB, peerDB)
+
+	// the miner posts a problem with a 3-clique, then solves it with a
+	// 4-clique, which lowers the target of the block
+	bc, err = crickchain.NewBlockchain(minerDB)
+	assert.Nil(t, err)
+	pg := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}})
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	posted, err := bc.MineBlock(nil, pg.Hash, []int{0, 1, 2}, pg.Hash)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(posted))
+	solved, err := bc.MineBlock(nil, pg.Hash, []int{0, 1, 2, 3}, []byte{})
+	assert.Nil(t, err)
+	assert.True(t, solved.HasValidSolution(bc))
+	assert.Nil(t, bc.AddBlock(solved))
+	assert.Nil(t, (crickchain.UTXOSet{Blockchain: bc}).Reindex())
+	bc.CloseDB()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	miner, err := crickchain.Open(crickchain.Config{DBFile: minerDB, ListenAddress: "127.0.0.1:0", Seeds: []string{}, Logger: logger})
+	assert.Nil(t, err)
+	defer miner.Close()
+	assert.Nil(t, miner.Start())
+
+	peer, err := crickchain.Open(crickchain.Config{DBFile: peerDB, ListenAddress: "127.0.0.1:0", Seeds: []string{miner.Address()}, Logger: logger})
+	assert.Nil(t, err)
+	defer peer.Close()
+	assert.False(t, peer.Blockchain().HasProblemGraph(pg.Hash))
+	assert.Nil(t, peer.Start())
+
+	deadline := time.Now().Add(20 * time.Second)
+	height, err := peer.BestHeight()
+	for err == nil && height < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		height, err = peer.BestHeight()
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, 2, height, "the blocks are added once the problem graph is fetched")
+	received, err := peer.Blockchain().GetProblemGraphFromHash(pg.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, pg.CanonicalEncoding(), received.CanonicalEncoding())
+	tip, err := peer.BlockAtHeight(2)
+	assert.Nil(t, err)
+	assert.Equal(t, solved.Hash, tip.Hash)
+
+	// graphs no parked block waits for are dropped
+	unsolicited := problemGraphOf(6, [][2]int{{0, 1}, {1, 2}, {2, 3}})
+	sendMessage(t, peer.Address(), "problem", struct {
+		AddrFrom string
+		Graph    []byte
+	}{miner.Address(), unsolicited.CanonicalEncoding()})
+	time.Sleep(500 * time.Millisecond)
+	assert.False(t, peer.Blockchain().HasProblemGraph(unsolicited.Hash))
+}
+
+// sendMessage sends a message of the node protocol, a command padded to 12
+// bytes followed by the gob encoded payload, to the node at address
+func sendMessage(t *testing.T, address string, command string, payload interface{}) {
+	var message bytes.Buffer
+	var name [12]byte
+	copy(name[:], command)
+	message.Write(name[:])
+	assert.Nil(t, gob.NewEncoder(&message).Encode(payload))
+
+	conn, err := net.Dial("tcp", address)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write(message.Bytes())
+	assert.Nil(t, err)
+}
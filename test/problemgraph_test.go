@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/soniakeys/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+func problemGraphOf(nodes int, edges [][2]int) *crickchain.ProblemGraph {
+	g := graph.Undirected{AdjacencyList: make(graph.AdjacencyList, nodes)}
+	for _, edge := range edges {
+		g.AddEdge(graph.NI(edge[0]), graph.NI(edge[1]))
+	}
+	pg := crickchain.ProblemGraph{Graph: &g}
+	pg.Hash = pg.GetHash()
+
+	return &pg
+}
+
+// hashedProblems returns the regtest parameters with problem graphs
+// introduced by their hash, as before they were generated from seeds
+func hashedProblems() crickchain.NetworkParams {
+	params := crickchain.Networks["regtest"]
+	params.SeededProblemsFrom = math.MaxInt32
+
+	return params
+}
+
+func TestProblemGraphCanonicalHash(t *testing.T) {
+	edges := [][2]int{{0, 1}, {1, 2}, {2, 0}, {3, 1}}
+	pg := problemGraphOf(5, edges)
+	reordered := problemGraphOf(5, [][2]int{{1, 3}, {0, 2}, {2, 1}, {1, 0}})
+	assert.Equal(t, pg.Hash, reordered.Hash, "the order of the edges does not matter")
+	assert.Equal(t, pg.CanonicalEncoding(), reordered.CanonicalEncoding())
+	assert.NotEqual(t, pg.Hash, problemGraphOf(6, edges).Hash, "isolated nodes count")
+	assert.NotEqual(t, pg.Hash, problemGraphOf(5, edges[:3]).Hash)
+
+	roundTrip := crickchain.DeserializeProblemGraph(pg.Serialize())
+	assert.Equal(t, pg.Hash, roundTrip.GetHash())
+
+	decoded, err := crickchain.DecodeProblemGraph(pg.CanonicalEncoding())
+	assert.Nil(t, err)
+	assert.Equal(t, pg.Hash, decoded.Hash)
+	assert.Equal(t, 5, decoded.Graph.Order())
+	assert.Equal(t, 4, decoded.Graph.Size())
+
+	encoding := pg.CanonicalEncoding()
+	swapped := append([]byte{}, encoding...)
+	copy(swapped[9:17], encoding[17:25])
+	copy(swapped[17:25], encoding[9:17])
+	_, err = crickchain.DecodeProblemGraph(swapped)
+	assert.Error(t, err, "unsorted edges are not canonical")
+	_, err = crickchain.DecodeProblemGraph(encoding[:len(encoding)-1])
+	assert.Error(t, err)
+	huge := append([]byte{}, encoding...)
+	binary.BigEndian.PutUint32(huge[1:], 1<<31)
+	_, err = crickchain.DecodeProblemGraph(huge)
+	assert.Contains(t, err.Error(), "more than any network admits")
+}
+
+func TestProblemGraphMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "problems")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "chain.db")
+	bc, err := crickchain.CreateBlockchain(newAddress(t), dbFile)
+	assert.Nil(t, err)
+
+	pg := problemGraphOf(4, [][2]int{{0, 1}, {1, 2}})
+	canonical := pg.Hash
+	pg.Hash = []byte("hash before canonical hashing")
+	assert.Error(t, bc.AddProblemGraph(pg))
+	bc.CloseDB()
+
+	// store the graph as an old DB did
+	db, err := bolt.Open(dbFile, 0600, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte("problemAliases")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("problems")).Put(pg.Hash, pg.Serialize())
+	}))
+	db.Close()
+
+	bc, err = crickchain.NewBlockchain(dbFile)
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	assert.Equal(t, 1, bc.RehashedProblemGraphs())
+	migrated, err := bc.GetProblemGraphFromHash(canonical)
+	assert.Nil(t, err)
+	assert.Equal(t, canonical, migrated.Hash)
+	byOldHash, err := bc.GetProblemGraphFromHash([]byte("hash before canonical hashing"))
+	assert.Nil(t, err, "blocks can still refer to the old hash")
+	assert.Equal(t, canonical, byOldHash.Hash)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+// unsignedRawTx spends the first output of prev without the blockchain
+func unsignedRawTx(prev *crickchain.Transaction, to string) *crickchain.RawTransaction {
+	tx, _ := spendingTx(prev, to)
+
+	return &crickchain.RawTransaction{
+		Tx:       *tx,
+		Prevouts: []crickchain.Prevout{{Value: prev.Vout[0].Value, ScriptPubKey: prev.Vout[0].ScriptPubKey}},
+	}
+}
+
+func TestRawTransactionRoundTrip(t *testing.T) {
+	signer := newTestWallets()
+	owner := createWallet(t, signer)
+	prev := newCoinbase(t, owner, "")
+
+	raw := unsignedRawTx(prev, newAddress(t))
+	assert.False(t, raw.IsComplete())
+
+	decoded, err := crickchain.DecodeRawTransaction(raw.Encode())
+	assert.Nil(t, err)
+	added, err := signer.SignRawTransaction(decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, added)
+	assert.True(t, decoded.IsComplete())
+
+	added, _ = newTestWallets().SignRawTransaction(decoded)
+	assert.Equal(t, 0, added, "a wallet without the key signs nothing")
+
+	_, err = crickchain.DecodeRawTransaction("zz")
+	assert.NotNil(t, err)
+
+	// a transaction without inputs is never complete
+	empty := crickchain.RawTransaction{Tx: crickchain.Transaction{Version: 2, Vout: decoded.Tx.Vout}}
+	assert.False(t, empty.IsComplete())
+	_, err = crickchain.DecodeRawTransaction(empty.Encode())
+	assert.Contains(t, err.Error(), "no inputs")
+}
+
+func TestRawTransactionMultisigSignersInTurn(t *testing.T) {
+	alice, bob, carol := newTestWallets(), newTestWallets(), newTestWallets()
+	var pubKeys [][]byte
+	for _, ws := range []*crickchain.Wallets{alice, bob, carol} {
+		pubKeys = append(pubKeys, ws.GetWallet(createWallet(t, ws)).PublicKey)
+	}
+	var address string
+	for _, ws := range []*crickchain.Wallets{alice, bob, carol} {
+		address, _ = ws.AddMultisig(2, pubKeys)
+	}
+	prev := newCoinbase(t, address, "")
+	encoded := unsignedRawTx(prev, newAddress(t)).Encode()
+
+	// carol signs first, then alice, each on the output of the previous signer
+	for i, signer := range []*crickchain.Wallets{carol, alice} {
+		raw, err := crickchain.DecodeRawTransaction(encoded)
+		assert.Nil(t, err)
+		added, err := signer.SignRawTransaction(raw)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, added)
+		assert.Equal(t, i == 1, raw.IsComplete())
+		encoded = raw.Encode()
+	}
+
+	raw, _ := crickchain.DecodeRawTransaction(encoded)
+	added, _ := bob.SignRawTransaction(raw)
+	assert.Equal(t, 0, added, "a complete multisig input takes no more signatures")
+	assert.True(t, raw.IsComplete())
+}
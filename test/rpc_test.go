@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+type rpcReply struct {
+	Result json.RawMessage
+	Error  *crickchain.RPCError
+	ID     json.RawMessage
+}
+
+func rpcPost(t *testing.T, url, token, body string) (int, []byte) {
+	request, _ := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	data, _ := ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, data
+}
+
+func rpcCall(t *testing.T, url, method string, params interface{}, result interface{}) *crickchain.RPCError {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	status, data := rpcPost(t, url, "secret", string(body))
+	assert.Equal(t, http.StatusOK, status)
+	var reply rpcReply
+	assert.Nil(t, json.Unmarshal(data, &reply), string(data))
+	if reply.Error == nil && result != nil {
+		assert.Nil(t, json.Unmarshal(reply.Result, result))
+	}
+
+	return reply.Error
+}
+
+func TestRPCServer(t *testing.T) {
+	signer := newTestWallets()
+	owner := createWallet(t, signer)
+	node, closeNode := openTestNode(t, owner, crickchain.Config{})
+	defer closeNode()
+
+	server := httptest.NewServer(crickchain.NewRPCServer(node, "secret"))
+	defer server.Close()
+	url := server.URL
+
+	status, _ := rpcPost(t, url, "wrong", `{"jsonrpc":"2.0","id":1,"method":"getbestheight"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	response, err := http.Get(url)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+
+	var height int
+	assert.Nil(t, rpcCall(t, url, "getbestheight", nil, &height))
+	assert.Equal(t, 0, height)
+
+	var block struct {
+		Hash   string
+		Height int
+	}
+	assert.Nil(t, rpcCall(t, url, "getblock", []interface{}{0}, &block))
+	var byHash struct{ Height int }
+	assert.Nil(t, rpcCall(t, url, "getblock", map[string]interface{}{"block": block.Hash}, &byHash))
+	assert.Equal(t, 0, byHash.Height)
+	assert.Equal(t, -32000, rpcCall(t, url, "getblock", []interface{}{7}, nil).Code)
+	assert.Equal(t, -32602, rpcCall(t, url, "getblock", []interface{}{1, 2}, nil).Code)
+	assert.Equal(t, -32601, rpcCall(t, url, "nosuchmethod", nil, nil).Code)
+
+	var difficulty struct{ Difficulty, ReducedDifficulty string }
+	assert.Nil(t, rpcCall(t, url, "getdifficulty", nil, &difficulty))
+	assert.NotEmpty(t, difficulty.Difficulty)
+
+	var balance struct{ Balance int }
+	assert.Nil(t, rpcCall(t, url, "getbalance", []string{owner}, &balance))
+	assert.Equal(t, 10, balance.Balance)
+	assert.NotNil(t, rpcCall(t, url, "getbalance", []string{"bogus"}, nil))
+
+	friend := newAddress(t)
+	UTXOSet := crickchain.UTXOSet{Blockchain: node.Blockchain()}
+	plan, err := UTXOSet.PlanPayments(owner, []crickchain.Payment{{Address: friend, Amount: 3}}, crickchain.DefaultCoinSelector)
+	assert.Nil(t, err)
+	raw, err := crickchain.NewRawTransaction(plan, &UTXOSet)
+	assert.Nil(t, err)
+	assert.NotNil(t, rpcCall(t, url, "sendrawtransaction", []string{raw.Encode()}, nil), "unsigned transactions are refused")
+	_, err = signer.SignRawTransaction(raw)
+	assert.Nil(t, err)
+	var sent struct{ TxID string }
+	assert.Nil(t, rpcCall(t, url, "sendrawtransaction", []string{raw.Encode()}, &sent))
+	var mempool []string
+	assert.Nil(t, rpcCall(t, url, "getmempool", nil, &mempool))
+	assert.Equal(t, []string{sent.TxID}, mempool)
+
+	var mining struct {
+		Mining  bool
+		Address string
+	}
+	assert.Nil(t, rpcCall(t, url, "startmining", []string{friend}, &mining))
+	assert.True(t, mining.Mining)
+	assert.Equal(t, friend, mining.Address)
+	assert.Nil(t, rpcCall(t, url, "stopmining", nil, &mining))
+	assert.False(t, mining.Mining)
+
+	var peers []struct{ Address string }
+	assert.Nil(t, rpcCall(t, url, "getpeerinfo", nil, &peers))
+	assert.Empty(t, peers)
+
+	status, data := rpcPost(t, url, "secret", `[{"jsonrpc":"2.0","id":1,"method":"getbestheight"},{"jsonrpc":"2.0","method":"stopmining"},{"jsonrpc":"2.0","id":2,"method":"nosuchmethod"}]`)
+	assert.Equal(t, http.StatusOK, status)
+	var batch []rpcReply
+	assert.Nil(t, json.Unmarshal(data, &batch), string(data))
+	assert.Len(t, batch, 2, "notifications get no response")
+	assert.Equal(t, json.RawMessage("0"), batch[0].Result)
+	assert.Equal(t, -32601, batch[1].Error.Code)
+
+	_, data = rpcPost(t, url, "secret", `{"jsonrpc":`)
+	var reply rpcReply
+	assert.Nil(t, json.Unmarshal(data, &reply))
+	assert.Equal(t, -32700, reply.Error.Code)
+}
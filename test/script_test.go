@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func spendingTx(prev *crickchain.Transaction, to string) (*crickchain.Transaction, map[string]crickchain.Transaction) {
+	tx := crickchain.Transaction{
+		Vin:  []crickchain.TXInput{{Txid: prev.ID, Vout: 0}},
+		Vout: []crickchain.TXOutput{*crickchain.NewTXOutput(prev.Vout[0].Value, to)},
+	}
+	tx.ID = tx.Hash()
+	prevTXs := map[string]crickchain.Transaction{hex.EncodeToString(prev.ID): *prev}
+
+	return &tx, prevTXs
+}
+
+func TestP2PKHSpend(t *testing.T) {
+	owner := newWallet(t)
+	other := newWallet(t)
+
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	tx, prevTXs := spendingTx(prev, string(other.GetAddress()))
+
+	tx.Sign(other.PrivateKey, prevTXs)
+	assert.False(t, tx.Verify(prevTXs), "signature by the wrong key is rejected")
+
+	tx.Sign(owner.PrivateKey, prevTXs)
+	assert.True(t, tx.Verify(prevTXs), "signature by the owner is accepted")
+}
+
+func TestMultisigSpend(t *testing.T) {
+	keys := []*crickchain.Wallet{newWallet(t), newWallet(t), newWallet(t)}
+	pubKeys := [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey}
+
+	redeemScript, err := crickchain.NewMultisigScript(2, pubKeys)
+	assert.Nil(t, err)
+	m, parsed, ok := crickchain.ParseMultisigScript(redeemScript)
+	assert.True(t, ok)
+	assert.Equal(t, 2, m)
+	assert.Equal(t, pubKeys, parsed)
+
+	address := string(crickchain.ScriptAddress(redeemScript))
+	assert.True(t, crickchain.ValidateAddress(address))
+	assert.True(t, crickchain.IsScriptAddress(address))
+
+	prev := newCoinbase(t, address, "")
+	assert.True(t, prev.Vout[0].IsLockedWithKey(crickchain.HashScript(redeemScript)))
+
+	tx, prevTXs := spendingTx(prev, string(keys[0].GetAddress()))
+
+	assert.Nil(t, tx.SignMultisig([]ecdsa.PrivateKey{keys[0].PrivateKey, keys[2].PrivateKey}, redeemScript, prevTXs))
+	assert.True(t, tx.Verify(prevTXs), "2 of 3 signatures are accepted")
+
+	err = tx.SignMultisig([]ecdsa.PrivateKey{keys[1].PrivateKey}, redeemScript, prevTXs)
+	assert.Error(t, err, "signing with fewer than m keys fails")
+
+	other, _ := crickchain.NewMultisigScript(1, pubKeys[:1])
+	assert.Nil(t, tx.SignMultisig([]ecdsa.PrivateKey{keys[0].PrivateKey}, other, prevTXs))
+	assert.True(t, tx.Verify(prevTXs), "inputs locked to other scripts are left untouched")
+}
+
+func TestTimelockedSpend(t *testing.T) {
+	owner := newWallet(t)
+	ownerHash := crickchain.HashPubKey(owner.PublicKey)
+
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	locked, err := crickchain.NewTimelockedTXOutput(prev.Vout[0].Value, string(owner.GetAddress()), 100)
+	assert.Nil(t, err)
+	prev.Vout[0] = *locked
+	assert.True(t, prev.Vout[0].IsLockedWithKey(ownerHash))
+
+	tx, prevTXs := spendingTx(prev, string(owner.GetAddress()))
+	tx.Sign(owner.PrivateKey, prevTXs)
+	assert.False(t, tx.Verify(prevTXs), "a spend without lock time is rejected")
+
+	tx.LockTime = 100
+	tx.Vin[0].Sequence = 0xfffffffe
+	tx.Sign(owner.PrivateKey, prevTXs)
+	assert.True(t, tx.Verify(prevTXs), "a spend with a matching lock time is accepted")
+	assert.False(t, tx.IsFinal(100, 0), "the spend can't be mined at the lock height")
+	assert.True(t, tx.IsFinal(101, 0), "the spend can be mined after the lock height")
+}
+
+type acceptAll struct{}
+
+func (acceptAll) CheckSig(sig, pubKey, scriptCode []byte) bool { return true }
+func (acceptAll) CheckLockTime(lockTime int64) bool            { return true }
+func (acceptAll) CheckSequence(sequence int64) bool            { return true }
+
+func TestScriptRejectsNonPushScriptSig(t *testing.T) {
+	wallet := newWallet(t)
+	scriptPubKey := crickchain.NewP2PKHScript(crickchain.HashPubKey(wallet.PublicKey))
+
+	scriptSig := []byte{crickchain.Op1, crickchain.OpDup}
+	assert.NotNil(t, crickchain.VerifyScript(scriptSig, scriptPubKey, acceptAll{}))
+}
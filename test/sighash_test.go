@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func p2pkhScriptSig(sig, pubKey []byte) []byte {
+	scriptSig := append([]byte{byte(len(sig))}, sig...)
+	scriptSig = append(scriptSig, byte(len(pubKey)))
+
+	return append(scriptSig, pubKey...)
+}
+
+func TestSignatureCommitsToOutputs(t *testing.T) {
+	owner := newWallet(t)
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	tx, prevTXs := spendingTx(prev, string(owner.GetAddress()))
+
+	tx.Sign(owner.PrivateKey, prevTXs)
+	assert.True(t, tx.Verify(prevTXs))
+
+	tx.Vout[0].Value++
+	assert.False(t, tx.Verify(prevTXs), "changing an output invalidates a SIGHASH_ALL signature")
+}
+
+func TestSigHashTypes(t *testing.T) {
+	owner := newWallet(t)
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	tx, prevTXs := spendingTx(prev, string(owner.GetAddress()))
+	scriptCode := prev.Vout[0].ScriptPubKey
+
+	sig, err := tx.SignInput(0, owner.PrivateKey, scriptCode, crickchain.SigHashNone)
+	assert.Nil(t, err)
+	tx.Vin[0].ScriptSig = p2pkhScriptSig(sig, owner.PublicKey)
+	tx.Vout[0].Value++
+	assert.True(t, tx.Verify(prevTXs), "SIGHASH_NONE does not cover outputs")
+
+	sig, err = tx.SignInput(0, owner.PrivateKey, scriptCode, crickchain.SigHashSingle|crickchain.SigHashAnyoneCanPay)
+	assert.Nil(t, err)
+	tx.Vin[0].ScriptSig = p2pkhScriptSig(sig, owner.PublicKey)
+	tx.Vout = append(tx.Vout, *crickchain.NewTXOutput(1, string(owner.GetAddress())))
+	assert.True(t, tx.Verify(prevTXs), "SIGHASH_SINGLE ignores the other outputs")
+	tx.Vout[0].Value++
+	assert.False(t, tx.Verify(prevTXs), "SIGHASH_SINGLE covers the output of the signed input")
+
+	_, err = tx.SignInput(0, owner.PrivateKey, scriptCode, crickchain.SigHashType(0x04))
+	assert.NotNil(t, err, "undefined sighash types are refused")
+}
+
+func TestSignaturesAreCanonical(t *testing.T) {
+	owner := newWallet(t)
+	prev := newCoinbase(t, string(owner.GetAddress()), "")
+	tx, prevTXs := spendingTx(prev, string(owner.GetAddress()))
+	scriptCode := prev.Vout[0].ScriptPubKey
+	n := elliptic.P256().Params().N
+	halfOrder := new(big.Int).Rsh(n, 1)
+
+	// signatures whose R and S differ in length used to break verification
+	for i := 0; i < 64; i++ {
+		sig, err := tx.SignInput(0, owner.PrivateKey, scriptCode, crickchain.SigHashAll)
+		assert.Nil(t, err)
+
+		var parsed ecdsaSignature
+		rest, err := asn1.Unmarshal(sig[:len(sig)-1], &parsed)
+		assert.Nil(t, err)
+		assert.Empty(t, rest)
+		assert.True(t, parsed.S.Cmp(halfOrder) <= 0, "S is normalised to the lower half")
+
+		tx.Vin[0].ScriptSig = p2pkhScriptSig(sig, owner.PublicKey)
+		assert.True(t, tx.Verify(prevTXs))
+	}
+
+	sig, _ := tx.SignInput(0, owner.PrivateKey, scriptCode, crickchain.SigHashAll)
+	var parsed ecdsaSignature
+	asn1.Unmarshal(sig[:len(sig)-1], &parsed)
+
+	highS, _ := asn1.Marshal(ecdsaSignature{parsed.R, new(big.Int).Sub(n, parsed.S)})
+	tx.Vin[0].ScriptSig = p2pkhScriptSig(append(highS, sig[len(sig)-1]), owner.PublicKey)
+	assert.False(t, tx.Verify(prevTXs), "high S signatures are rejected")
+
+	raw := append(parsed.R.Bytes(), parsed.S.Bytes()...)
+	tx.Vin[0].ScriptSig = p2pkhScriptSig(append(raw, sig[len(sig)-1]), owner.PublicKey)
+	assert.False(t, tx.Verify(prevTXs), "raw r||s signatures are rejected")
+
+	padded := append([]byte{}, sig...)
+	padded[1]++
+	padded[3]++
+	padded = append(padded[:4], append([]byte{0x00}, padded[4:]...)...)
+	if padded[5]&0x80 == 0 {
+		tx.Vin[0].ScriptSig = p2pkhScriptSig(padded, owner.PublicKey)
+		assert.False(t, tx.Verify(prevTXs), "zero padded integers are rejected")
+	}
+}
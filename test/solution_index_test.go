@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func bestSolution(t *testing.T, bc *crickchain.Blockchain, pg *crickchain.ProblemGraph, height int) []int {
+	solution, err := bc.GetBestSolution(pg, height)
+	assert.Nil(t, err)
+
+	return solution
+}
+
+func allSolutions(t *testing.T, bc *crickchain.Blockchain, pg *crickchain.ProblemGraph) [][]int {
+	solutions, err := bc.GetAllSolutions(pg)
+	assert.Nil(t, err)
+
+	return solutions
+}
+
+func TestSolutionIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solutions")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "chain.db")
+	owner := newAddress(t)
+
+	bc, err := crickchain.CreateBlockchainWithParams(owner, dbFile, hashedProblems())
+	assert.Nil(t, err)
+	genesis, err := bc.GetBlockFromHeight(0)
+	assert.Nil(t, err)
+
+	pg := problemGraphOf(5, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}, {3, 4}})
+	assert.Nil(t, bc.AddProblemGraph(pg))
+	posted, err := bc.MineBlock(nil, pg.Hash, []int{0, 1, 2}, pg.Hash)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(posted))
+	solved, err := bc.MineBlock(nil, pg.Hash, []int{0, 1, 2, 3}, []byte{})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(solved))
+	empty, err := bc.MineBlock(nil, []byte{}, []int{}, []byte{})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(empty))
+
+	history, err := bc.SolutionHistory(pg.Hash)
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].Height)
+	assert.Equal(t, posted.Hash, history[0].BlockHash)
+	assert.Equal(t, []int{0, 1, 2, 3}, history[1].Clique)
+	assert.Equal(t, []int{}, bestSolution(t, bc, pg, 0))
+	assert.Equal(t, []int{0, 1, 2}, bestSolution(t, bc, pg, 1))
+	assert.Equal(t, []int{0, 1, 2, 3}, bestSolution(t, bc, pg, 2))
+	assert.Equal(t, []int{0, 1, 2, 3}, bestSolution(t, bc, pg, 10))
+	assert.Equal(t, [][]int{{0, 1, 2, 3}, {0, 1, 2}}, allSolutions(t, bc, pg))
+	assert.True(t, solved.HasValidSolution(bc))
+	bc.CloseDB()
+
+	// DBs made before the index have it built when opened
+	db, err := bolt.Open(dbFile, 0600, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("solutionIndex"))
+	}))
+	db.Close()
+	bc, err = crickchain.NewBlockchain(dbFile)
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	assert.Equal(t, []int{0, 1, 2, 3}, bestSolution(t, bc, pg, 3))
+
+	// a longer branch from the genesis block disconnects the solutions
+	target, err := bc.CalculateTarget(1, false)
+	assert.Nil(t, err)
+	prev := &genesis
+	for height := 1; height <= 4; height++ {
+		coinbase := newCoinbase(t, owner, "")
+		prev = crickchain.NewBlock([]*crickchain.Transaction{coinbase}, prev.Hash, height, target, []byte{}, []int{}, []byte{})
+		assert.Nil(t, bc.AddBlock(prev))
+	}
+	height, err := bc.GetBestHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, height)
+	history, err = bc.SolutionHistory(pg.Hash)
+	assert.Nil(t, err)
+	assert.Len(t, history, 0)
+	assert.Equal(t, []int{}, bestSolution(t, bc, pg, 4))
+	assert.Equal(t, [][]int{}, allSolutions(t, bc, pg))
+}
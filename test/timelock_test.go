@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelativeLocksFollowTheBlockAncestry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timelock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	owner := newWallet(t)
+	ownerAddress := string(owner.GetAddress())
+	bc, err := crickchain.CreateBlockchainWithParams(ownerAddress, filepath.Join(dir, "chain.db"), crickchain.Networks["regtest"])
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	UTXOSet := crickchain.UTXOSet{Blockchain: bc}
+	assert.Nil(t, UTXOSet.Reindex())
+	genesis, err := bc.GetBlockFromHeight(0)
+	assert.Nil(t, err)
+
+	// the genesis coinbase is spent 2 blocks after it
+	plan, err := UTXOSet.PlanPayments(ownerAddress, []crickchain.Payment{{Address: newAddress(t), Amount: 3}}, crickchain.LargestFirst{})
+	assert.Nil(t, err)
+	tx, err := plan.Transaction()
+	assert.Nil(t, err)
+	tx.Vin[0].Sequence = crickchain.NewRelativeLockSequence(2, false)
+	tx.ID = tx.Hash()
+	assert.Nil(t, bc.SignTransaction(tx, owner.PrivateKey))
+	assert.Error(t, bc.CheckTransactionLocksAtTip(tx))
+
+	target, err := bc.CurrentTarget(false)
+	assert.Nil(t, err)
+	early := crickchain.NewBlock([]*crickchain.Transaction{tx}, genesis.Hash, 1, target, []byte{}, []int{}, []byte{})
+	assert.Contains(t, early.Check(bc).Error(), "locked until height 2")
+
+	// the height is the one of the checked block, not of the tip: the
+	// chain grows, but a block on the genesis block is still too early
+	for height := 1; height <= 2; height++ {
+		block, err := bc.MineBlock(nil, []byte{}, []int{}, []byte{})
+		assert.Nil(t, err)
+		assert.Nil(t, bc.AddBlock(block))
+	}
+	assert.Nil(t, bc.CheckTransactionLocksAtTip(tx))
+	assert.Contains(t, early.Check(bc).Error(), "locked until height 2")
+
+	first, err := bc.GetBlockFromHeight(1)
+	assert.Nil(t, err)
+	target, err = bc.GetBlockTarget(1, []byte{}, []int{}, []byte{})
+	assert.Nil(t, err)
+	onTime := crickchain.NewBlock([]*crickchain.Transaction{tx}, first.Hash, 2, target, []byte{}, []int{}, []byte{})
+	assert.Nil(t, onTime.Check(bc))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedSpend pays the first output of prev to to, signed by owner
+func signedSpend(t *testing.T, owner *crickchain.Wallet, prev *crickchain.Transaction, to string, value int) *crickchain.Transaction {
+	tx := &crickchain.Transaction{
+		Vin:  []crickchain.TXInput{{Txid: prev.ID, Vout: 0}},
+		Vout: []crickchain.TXOutput{*crickchain.NewTXOutput(value, to)},
+	}
+	tx.ID = tx.Hash()
+	assert.Nil(t, tx.Sign(owner.PrivateKey, map[string]crickchain.Transaction{hex.EncodeToString(prev.ID): *prev}))
+
+	return tx
+}
+
+func TestVerifyTransactionsInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	owner := newWallet(t)
+	other := newWallet(t)
+	bc, err := crickchain.CreateBlockchain(string(owner.GetAddress()), filepath.Join(dir, "chain.db"))
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	genesis := bc.Iterator().Next().Transactions[0]
+
+	// the spends of the genesis output pay different amounts, so that they
+	// are different transactions, and every third one is tampered with
+	var txs []*crickchain.Transaction
+	var expected []bool
+	for i := 0; i < 24; i++ {
+		tx := signedSpend(t, owner, genesis, string(other.GetAddress()), i+1)
+		if i%3 == 2 {
+			tx.Vout[0].Value += 100
+		}
+		txs = append(txs, tx)
+		expected = append(expected, i%3 != 2)
+	}
+	// a spend of a transaction of the same batch, signed by the wrong key
+	txs = append(txs, signedSpend(t, owner, txs[0], string(owner.GetAddress()), 1))
+	expected = append(expected, false)
+	// and one signed by the right one
+	txs = append(txs, signedSpend(t, other, txs[1], string(owner.GetAddress()), 2))
+	expected = append(expected, true)
+
+	assert.Equal(t, expected, bc.VerifyTransactions(txs))
+}
+
+func TestBlockVerificationUsesMempoolSigCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	owner := newWallet(t)
+	bc, err := crickchain.CreateBlockchain(string(owner.GetAddress()), filepath.Join(dir, "chain.db"))
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	genesis := bc.Iterator().Next().Transactions[0]
+	cache := crickchain.MempoolSigCache()
+
+	tx := signedSpend(t, owner, genesis, newAddress(t), 7)
+	assert.True(t, bc.VerifyTransaction(tx), "accepted in the mempool")
+	hits := cache.Hits()
+	assert.Equal(t, []bool{true}, bc.VerifyTransactions([]*crickchain.Transaction{tx}))
+	assert.Equal(t, hits+1, cache.Hits(), "the block finds the signature of the mempool")
+
+	// the same signature over another sighash is not a hit
+	changed := *tx
+	changed.Vout = []crickchain.TXOutput{*crickchain.NewTXOutput(8, string(owner.GetAddress()))}
+	hits = cache.Hits()
+	assert.Equal(t, []bool{false}, bc.VerifyTransactions([]*crickchain.Transaction{&changed}))
+	assert.Equal(t, hits, cache.Hits())
+}
+
+func TestSigCache(t *testing.T) {
+	cache := crickchain.NewSigCache(2)
+	hash, sig, pubKey := []byte("hash"), []byte("sig"), []byte("key")
+
+	cache.Add(hash, sig, pubKey)
+	assert.True(t, cache.Exists(hash, sig, pubKey))
+	assert.False(t, cache.Exists([]byte("hasi"), sig, pubKey), "another sighash is not a hit")
+	assert.False(t, cache.Exists(hash, sig, []byte("other")))
+	assert.Equal(t, uint64(1), cache.Hits())
+
+	cache.Add([]byte("b"), sig, pubKey)
+	cache.Add([]byte("c"), sig, pubKey)
+	assert.Equal(t, 2, cache.Len(), "a full cache evicts")
+	assert.False(t, crickchain.NewSigCache(0).Exists(hash, sig, pubKey))
+}
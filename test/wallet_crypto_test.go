@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	walletFile := filepath.Join(dir, "wallet.dat")
+
+	key1, key2 := newWallet(t), newWallet(t)
+	wallets, _ := crickchain.NewWallets(walletFile)
+	address, err := wallets.AddMultisig(1, [][]byte{key1.PublicKey, key2.PublicKey})
+	assert.Nil(t, err)
+	assert.Nil(t, wallets.SaveToFile(walletFile))
+	redeemScript := wallets.GetRedeemScript(address)
+
+	assert.Nil(t, crickchain.EncryptWallet(walletFile, "correct horse"))
+	assert.Equal(t, crickchain.ErrWalletEncrypted, crickchain.EncryptWallet(walletFile, "again"))
+	assert.True(t, crickchain.IsWalletEncrypted(walletFile))
+
+	content, _ := ioutil.ReadFile(walletFile)
+	assert.False(t, bytes.Contains(content, redeemScript), "wallet content is not stored in clear")
+	info, _ := os.Stat(walletFile)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = crickchain.NewWallets(walletFile)
+	assert.Equal(t, crickchain.ErrWalletLocked, err)
+	assert.Equal(t, crickchain.ErrWrongPassphrase, crickchain.UnlockWallet(walletFile, "wrong", time.Minute))
+
+	assert.Nil(t, crickchain.UnlockWallet(walletFile, "correct horse", time.Minute))
+	wallets, err = crickchain.NewWallets(walletFile)
+	assert.Nil(t, err)
+	assert.Equal(t, redeemScript, wallets.GetRedeemScript(address))
+
+	// saving an unlocked wallet keeps it encrypted
+	second, _ := wallets.AddMultisig(2, [][]byte{key1.PublicKey, key2.PublicKey})
+	assert.Nil(t, wallets.SaveToFile(walletFile))
+	crickchain.LockWallet(walletFile)
+	_, err = crickchain.NewWallets(walletFile)
+	assert.Equal(t, crickchain.ErrWalletLocked, err)
+
+	assert.Equal(t, crickchain.ErrWrongPassphrase, crickchain.ChangeWalletPassphrase(walletFile, "wrong", "new"))
+	assert.Nil(t, crickchain.ChangeWalletPassphrase(walletFile, "correct horse", "battery staple"))
+	assert.Equal(t, crickchain.ErrWrongPassphrase, crickchain.UnlockWallet(walletFile, "correct horse", time.Minute))
+
+	assert.Nil(t, crickchain.UnlockWallet(walletFile, "battery staple", 50*time.Millisecond))
+	wallets, err = crickchain.NewWallets(walletFile)
+	assert.Nil(t, err)
+	assert.Len(t, wallets.GetAddresses(), 2)
+	assert.Contains(t, wallets.GetAddresses(), second)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = crickchain.NewWallets(walletFile)
+	assert.Equal(t, crickchain.ErrWalletLocked, err, "the wallet locks itself after the timeout")
+
+	// a corrupt wallet file is not encrypted
+	corruptFile := filepath.Join(dir, "corrupt.dat")
+	assert.Nil(t, ioutil.WriteFile(corruptFile, []byte("not a wallet"), 0600))
+	assert.Contains(t, crickchain.EncryptWallet(corruptFile, "correct horse").Error(), "is corrupt")
+	content, _ = ioutil.ReadFile(corruptFile)
+	assert.Equal(t, []byte("not a wallet"), content)
+}
+
+func TestWalletScryptParametersAreBounded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	walletFile := filepath.Join(dir, "wallet.dat")
+	assert.Nil(t, crickchain.EncryptWallet(walletFile, "pass"))
+	content, _ := ioutil.ReadFile(walletFile)
+
+	// N, r and p follow the 12 bytes of the magic, 4 bytes big endian each
+	for _, params := range [][3]uint32{{1 << 30, 8, 1}, {1 << 15, 1 << 20, 1}, {1 << 15, 8, 1 << 30}, {1000, 8, 1}, {1 << 20, 32, 1}} {
+		crafted := append([]byte{}, content...)
+		for i, param := range params {
+			binary.BigEndian.PutUint32(crafted[12+4*i:], param)
+		}
+		assert.Nil(t, ioutil.WriteFile(walletFile, crafted, 0600))
+		start := time.Now()
+		err := crickchain.UnlockWallet(walletFile, "pass", time.Minute)
+		assert.Contains(t, err.Error(), "scrypt parameters", "%v", params)
+		assert.True(t, time.Since(start) < time.Second)
+	}
+}
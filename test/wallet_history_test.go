@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryFollowsReorg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	wallets, _ := crickchain.NewWallets(filepath.Join(dir, "wallet.dat"))
+	owner := createWallet(t, wallets)
+	friend := newAddress(t)
+	assert.Nil(t, wallets.SetLabel(friend, "friend"))
+
+	bc, err := crickchain.CreateBlockchain(owner, filepath.Join(dir, "chain.db"))
+	assert.Nil(t, err)
+	defer bc.CloseDB()
+	UTXOSet := crickchain.UTXOSet{Blockchain: bc}
+	assert.Nil(t, UTXOSet.Reindex())
+	genesis := bc.Iterator().Next()
+
+	plan, err := UTXOSet.PlanPayments(owner, []crickchain.Payment{{Address: friend, Amount: 3}}, crickchain.LargestFirst{})
+	assert.Nil(t, err)
+	tx, err := crickchain.NewPlannedTransaction(wallets, plan, &UTXOSet)
+	assert.Nil(t, err)
+	block, err := bc.MineBlock([]*crickchain.Transaction{tx}, []byte{}, []int{}, []byte{})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(block))
+
+	history, err := wallets.History(bc, crickchain.HistoryFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, crickchain.TxCategorySend, history[0].Category)
+	assert.Equal(t, -3, history[0].Amount)
+	assert.Equal(t, []string{friend}, history[0].Addresses)
+	assert.Equal(t, "friend", history[0].Label)
+	assert.Equal(t, 1, history[0].Confirmations)
+	assert.Equal(t, crickchain.TxCategoryGenerate, history[1].Category)
+	assert.Equal(t, 2, history[1].Confirmations)
+
+	paged, _ := wallets.History(bc, crickchain.HistoryFilter{Skip: 1, Count: 1})
+	assert.Equal(t, history[1:], paged)
+	none, _ := wallets.History(bc, crickchain.HistoryFilter{MinConfirmations: 3})
+	assert.Empty(t, none)
+	assert.Equal(t, block.Hash, wallets.TxHistory.Tip, "the history is recorded up to the tip")
+
+	// the recorded history is saved with the wallets
+	var buff bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&buff).Encode(wallets.TxHistory))
+	var recorded crickchain.RecordedHistory
+	assert.Nil(t, gob.NewDecoder(&buff).Decode(&recorded))
+	assert.Equal(t, *wallets.TxHistory, recorded)
+
+	// a longer fork from the genesis block drops the payment
+	other := newAddress(t)
+	prev := genesis
+	for height := 1; height <= 2; height++ {
+		target, err := bc.GetBlockTarget(prev.Height, []byte{}, []int{}, []byte{})
+		assert.Nil(t, err)
+		coinbase := newCoinbase(t, other, string(rune('a'+height)))
+		prev = crickchain.NewBlock([]*crickchain.Transaction{coinbase}, prev.Hash, height, target, []byte{}, []int{}, []byte{})
+		assert.Nil(t, bc.AddBlock(prev))
+	}
+
+	history, err = wallets.History(bc, crickchain.HistoryFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, genesis.Transactions[0].ID, history[0].TxID)
+	assert.Equal(t, 3, history[0].Confirmations)
+	assert.Equal(t, prev.Hash, wallets.TxHistory.Tip)
+
+	// a new address is looked for in the blocks already recorded
+	assert.Nil(t, wallets.AddWatchOnly(other))
+	history, err = wallets.History(bc, crickchain.HistoryFilter{Address: other})
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+
+	// the recorded history is kept in the wallet file
+	watchFile := filepath.Join(dir, "watch.dat")
+	watching, _ := crickchain.NewWallets(watchFile)
+	assert.Nil(t, watching.AddWatchOnly(other))
+	_, err = watching.History(bc, crickchain.HistoryFilter{})
+	assert.Nil(t, err)
+	assert.Nil(t, watching.SaveToFile(watchFile))
+	loaded, err := crickchain.NewWallets(watchFile)
+	assert.Nil(t, err)
+	assert.NotNil(t, loaded.TxHistory)
+	assert.Equal(t, watching.TxHistory, loaded.TxHistory)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delphicrypto/blockchain_go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWallets() *crickchain.Wallets {
+	return &crickchain.Wallets{
+		Wallets:   make(map[string]*crickchain.Wallet),
+		Scripts:   make(map[string][]byte),
+		WatchOnly: make(map[string]bool),
+		Labels:    make(map[string]string),
+		TxLabels:  make(map[string]string),
+	}
+}
+
+func newWallet(t testing.TB) *crickchain.Wallet {
+	wallet, err := crickchain.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wallet
+}
+
+func newAddress(t testing.TB) string {
+	return string(newWallet(t).GetAddress())
+}
+
+func createWallet(t testing.TB, ws *crickchain.Wallets) string {
+	address, err := ws.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+func newCoinbase(t testing.TB, to, data string) *crickchain.Transaction {
+	tx, err := crickchain.NewCoinbaseTX(to, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// openTestNode creates a blockchain rewarding owner in a temporary directory
+// and opens a node on it with config, whose DBFile, Seeds and Logger it sets.
+// The returned function closes the node and removes the directory.
+func openTestNode(t *testing.T, owner string, config crickchain.Config) (*crickchain.Node, func()) {
+	dir, err := ioutil.TempDir("", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DBFile = filepath.Join(dir, "chain.db")
+	config.Seeds = []string{}
+	config.Logger = log.New(ioutil.Discard, "", 0)
+
+	bc, err := crickchain.CreateBlockchain(owner, config.DBFile)
+	if err == nil {
+		err = (crickchain.UTXOSet{Blockchain: bc}).Reindex()
+		bc.CloseDB()
+	}
+	var node *crickchain.Node
+	if err == nil {
+		node, err = crickchain.Open(config)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return node, func() {
+		node.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExportImportKey(t *testing.T) {
+	source := newTestWallets()
+	address := createWallet(t, source)
+	key, err := source.ExportKey(address)
+	assert.Nil(t, err)
+
+	target := newTestWallets()
+	assert.Nil(t, target.AddWatchOnly(address))
+	assert.True(t, target.IsWatchOnly(address))
+
+	imported, err := target.ImportKey(key)
+	assert.Nil(t, err)
+	assert.Equal(t, address, imported)
+	assert.False(t, target.IsWatchOnly(address), "importing the key makes a watch-only address spendable")
+	assert.Equal(t, source.GetWallet(address).PublicKey, target.GetWallet(address).PublicKey)
+
+	tampered := []byte(key)
+	if tampered[5] == 'a' {
+		tampered[5] = 'b'
+	} else {
+		tampered[5] = 'a'
+	}
+	_, err = target.ImportKey(string(tampered))
+	assert.NotNil(t, err, "keys with a bad checksum are rejected")
+	_, err = target.ImportKey(address)
+	assert.NotNil(t, err, "addresses are not keys")
+	_, err = target.ImportKey("0OIl")
+	assert.NotNil(t, err)
+}
+
+func TestWatchOnlyAddresses(t *testing.T) {
+	ws := newTestWallets()
+	watched := newAddress(t)
+
+	assert.Nil(t, ws.AddWatchOnly(watched))
+	assert.Contains(t, ws.GetAddresses(), watched)
+	_, err := ws.ExportKey(watched)
+	assert.NotNil(t, err, "watch-only addresses have no key")
+
+	assert.NotNil(t, ws.AddWatchOnly("not-an-address"))
+	assert.NotNil(t, ws.AddWatchOnly(createWallet(t, ws)), "owned addresses are not watch-only")
+}
+
+func TestBase58KeepsLeadingZeros(t *testing.T) {
+	payload := []byte{0x00, 0x00, 0x00, 0x2a}
+	assert.Equal(t, payload, crickchain.Base58Decode(crickchain.Base58Encode(payload)))
+}
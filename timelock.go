@@ -0,0 +1,218 @@
+package crickchain
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	txVersion = 2
+	// lock times below this are block heights, above it unix timestamps
+	lockTimeThreshold = 500000000
+	medianTimeBlocks  = 11
+
+	maxSequence = 0xffffffff
+	// an input with this bit set has no relative lock
+	sequenceLockDisableFlag = 1 << 31
+	// an input with this bit set is locked by time rather than by blocks
+	sequenceLockTypeFlag = 1 << 22
+	// time based relative locks count in units of 512 seconds
+	sequenceLockGranularity = 9
+	sequenceLockMask        = 0x0000ffff
+)
+
+// NewRelativeLockSequence returns an input sequence that keeps the input from
+// being spent until value blocks, or value*512 seconds when byTime is set,
+// have passed since the spent output was mined
+func NewRelativeLockSequence(value int, byTime bool) uint32 {
+	sequence := uint32(value) & sequenceLockMask
+	if byTime {
+		sequence |= sequenceLockTypeFlag
+	}
+
+	return sequence
+}
+
+// IsFinal checks whether the transaction lock time allows it in a block at
+// height whose parent has median time past mtp
+func (tx *Transaction) IsFinal(height int, mtp int64) bool {
+	if isFinalLockTime(tx.LockTime, height, mtp) {
+		return true
+	}
+	for _, vin := range tx.Vin {
+		if vin.Sequence != maxSequence {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isFinalLockTime(lockTime int64, height int, mtp int64) bool {
+	if lockTime == 0 {
+		return true
+	}
+	if lockTime < lockTimeThreshold {
+		return lockTime < int64(height)
+	}
+
+	return lockTime < mtp
+}
+
+// MedianTimePast returns the median timestamp, in seconds, of the last
+// medianTimeBlocks blocks ending with the block blockHash
+func (bc *Blockchain) MedianTimePast(blockHash []byte) int64 {
+	var timestamps []int64
+
+	for len(blockHash) > 0 && len(timestamps) < medianTimeBlocks {
+		block, err := bc.GetBlockFromHash(blockHash)
+		if err != nil {
+			break
+		}
+		timestamps = append(timestamps, block.Timestamp/1e9)
+		blockHash = block.PrevBlockHash
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+// lockContext is what the locks of the transactions of a block are checked
+// against: the height of the block, the median time past of its parent, and
+// the blocks confirming the outputs spent, looked for in the block and then
+// in its ancestry, read once for all its transactions
+type lockContext struct {
+	bc     *Blockchain
+	height int
+	mtp    int64
+	// inBlock are the IDs of the transactions of the block itself
+	inBlock map[string]bool
+	// next is the next ancestor to read, and confirmed the ancestors read so
+	// far by the IDs of their transactions
+	next      []byte
+	confirmed map[string]*Block
+}
+
+// newLockContext returns the lock context of a block at height on top of the
+// block prevBlockHash, with the transactions txs
+func (bc *Blockchain) newLockContext(prevBlockHash []byte, height int, txs []*Transaction) *lockContext {
+	c := &lockContext{
+		bc:        bc,
+		height:    height,
+		mtp:       bc.MedianTimePast(prevBlockHash),
+		inBlock:   make(map[string]bool),
+		next:      prevBlockHash,
+		confirmed: make(map[string]*Block),
+	}
+	for _, tx := range txs {
+		c.inBlock[string(tx.ID)] = true
+	}
+
+	return c
+}
+
+// confirmation returns the height of the block confirming the transaction
+// with the given ID and the median time past of its parent. A transaction of
+// the block itself is confirmed at its height, after its parent.
+func (c *lockContext) confirmation(ID []byte) (int, int64, error) {
+	if c.inBlock[string(ID)] {
+		return c.height, c.mtp, nil
+	}
+	for c.confirmed[string(ID)] == nil && len(c.next) > 0 {
+		block, err := c.bc.GetBlockFromHash(c.next)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, tx := range block.Transactions {
+			c.confirmed[string(tx.ID)] = &block
+		}
+		c.next = block.PrevBlockHash
+	}
+
+	block := c.confirmed[string(ID)]
+	if block == nil {
+		return 0, 0, ErrTransactionNotFound
+	}
+
+	return block.Height, c.bc.MedianTimePast(block.PrevBlockHash), nil
+}
+
+// check checks the lock time and the relative input locks of tx
+func (c *lockContext) check(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if !tx.IsFinal(c.height, c.mtp) {
+		return fmt.Errorf("transaction %x is locked until %d", tx.ID, tx.LockTime)
+	}
+	if tx.Version < 2 {
+		return nil
+	}
+
+	for _, vin := range tx.Vin {
+		if vin.Sequence&sequenceLockDisableFlag != 0 {
+			continue
+		}
+		prevHeight, prevMTP, err := c.confirmation(vin.Txid)
+		if err != nil {
+			return err
+		}
+
+		value := int64(vin.Sequence & sequenceLockMask)
+		if vin.Sequence&sequenceLockTypeFlag != 0 {
+			minTime := prevMTP + value<<sequenceLockGranularity
+			if c.mtp < minTime {
+				return fmt.Errorf("input %x:%d is locked until time %d", vin.Txid, vin.Vout, minTime)
+			}
+		} else if int64(c.height) < int64(prevHeight)+value {
+			return fmt.Errorf("input %x:%d is locked until height %d", vin.Txid, vin.Vout, int64(prevHeight)+value)
+		}
+	}
+
+	return nil
+}
+
+// CheckTransactionLocksAtTip checks whether the locks of tx allow it in the next block
+func (bc *Blockchain) CheckTransactionLocksAtTip(tx *Transaction) error {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	return bc.newLockContext(bc.tip, height+1, nil).check(tx)
+}
+
+// nextBlockLockContext returns the height and median time past locks are checked against for the next block
+func (bc *Blockchain) nextBlockLockContext() (int, int64, error) {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return height + 1, bc.MedianTimePast(bc.tip), nil
+}
+
+// findTransactionBlock finds the block containing the transaction with the given ID
+func (bc *Blockchain) findTransactionBlock(ID []byte) (*Block, error) {
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			if Equal(tx.ID, ID) {
+				return block, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, ErrTransactionNotFound
+}
@@ -3,14 +3,13 @@ package crickchain
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"math/big"
 	"strings"
 
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 )
@@ -19,9 +18,11 @@ const subsidy = 10
 
 // Transaction represents a Bitcoin transaction
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
+	ID       []byte
+	Version  int
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime int64
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -54,36 +55,99 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-// Sign signs each input of a Transaction
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+// Sign signs each pay-to-pubkey-hash input of a Transaction
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
 
-	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)].ID == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
-		}
+	if err := tx.checkPrevTXs(prevTXs); err != nil {
+		return err
 	}
 
-	txCopy := tx.TrimmedCopy()
+	pubKey := encodePubKey(privKey.PublicKey)
 
-	for inID, vin := range txCopy.Vin {
+	for inID, vin := range tx.Vin {
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-
-		dataToSign := fmt.Sprintf("%x\n", txCopy)
+		scriptPubKey := prevTx.Vout[vin.Vout].ScriptPubKey
+		if !pubKeyHashScript(scriptPubKey) {
+			continue
+		}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, []byte(dataToSign))
+		signature, err := tx.SignInput(inID, privKey, scriptPubKey, SigHashAll)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
+		scriptSig := append(scriptPush(signature), scriptPush(pubKey)...)
+
+		tx.Vin[inID].ScriptSig = scriptSig
+	}
+
+	return nil
+}
+
+// SignMultisig signs each input spending the P2SH multisig redeemScript with
+// the given keys, taking signatures in the order the keys appear in the script
+func (tx *Transaction) SignMultisig(privKeys []ecdsa.PrivateKey, redeemScript []byte, prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	m, pubKeys, ok := ParseMultisigScript(redeemScript)
+	if !ok {
+		return errors.New("redeem script is not a multisig script")
+	}
+	scriptHash := HashScript(redeemScript)
+	if err := tx.checkPrevTXs(prevTXs); err != nil {
+		return err
+	}
+
+	for inID, vin := range tx.Vin {
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		scriptPubKey := prevTx.Vout[vin.Vout].ScriptPubKey
+		if !isP2SHScript(scriptPubKey) || !bytes.Equal(ScriptLockHash(scriptPubKey), scriptHash) {
+			continue
+		}
+
+		var scriptSig []byte
+		signed := 0
+		for _, pubKey := range pubKeys {
+			if signed == m {
+				break
+			}
+			for _, privKey := range privKeys {
+				keyBytes := encodePubKey(privKey.PublicKey)
+				if bytes.Equal(keyBytes, pubKey) {
+					signature, err := tx.SignInput(inID, privKey, redeemScript, SigHashAll)
+					if err != nil {
+						return err
+					}
+					scriptSig = append(scriptSig, scriptPush(signature)...)
+					signed++
+					break
+				}
+			}
+		}
+		if signed < m {
+			return fmt.Errorf("need %d signatures, only have keys for %d", m, signed)
+		}
+
+		tx.Vin[inID].ScriptSig = append(scriptSig, scriptPush(redeemScript)...)
+	}
+
+	return nil
+}
 
-		tx.Vin[inID].Signature = signature
-		txCopy.Vin[inID].PubKey = nil
+// checkPrevTXs checks that prevTXs holds the outputs spent by every input
+func (tx *Transaction) checkPrevTXs(prevTXs map[string]Transaction) error {
+	for _, vin := range tx.Vin {
+		prevTx, ok := prevTXs[hex.EncodeToString(vin.Txid)]
+		if !ok || prevTx.ID == nil || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return fmt.Errorf("previous transaction of input %x:%d is not correct", vin.Txid, vin.Vout)
+		}
 	}
+
+	return nil
 }
 
 // String returns a human-readable representation of a transaction
@@ -91,20 +155,28 @@ func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+	lines = append(lines, fmt.Sprintf("     Version:  %d", tx.Version))
+	if tx.LockTime > 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
 
 	for i, input := range tx.Vin {
 
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		lines = append(lines, fmt.Sprintf("       Sequence:  %08x", input.Sequence))
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Data:      %x", input.ScriptSig))
+		} else {
+			lines = append(lines, fmt.Sprintf("       ScriptSig: %s", DisasmScript(input.ScriptSig)))
+		}
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       Script: %s", DisasmScript(output.ScriptPubKey)))
 	}
 
 	return strings.Join(lines, "\n")
@@ -116,130 +188,200 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TXOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, nil})
+		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, vin.Sequence})
 	}
 
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TXOutput{vout.Value, vout.PubKeyHash})
+		outputs = append(outputs, TXOutput{vout.Value, vout.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, tx.Version, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
-// Verify verifies signatures of Transaction inputs
+// Verify runs the scripts of every Transaction input against the outputs they spend
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
-	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)].ID == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
+	if tx.checkPrevTXs(prevTXs) != nil {
+		return false
+	}
+
+	for inID := range tx.Vin {
+		if !tx.verifyInput(inID, prevTXs, nil, false) {
+			return false
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	return true
+}
 
-	for inID, vin := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+// verifyInput runs the scripts of one input against the output it spends.
+// Signatures found in sigCache are not checked again, and newly verified ones
+// are added to it when cacheSigs is set.
+func (tx *Transaction) verifyInput(inID int, prevTXs map[string]Transaction, sigCache *SigCache, cacheSigs bool) bool {
+	vin := tx.Vin[inID]
+	prevTx, ok := prevTXs[hex.EncodeToString(vin.Txid)]
+	if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+		return false
+	}
 
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
+	checker := txInputChecker{tx, inID, sigCache, cacheSigs}
+	err := VerifyScript(vin.ScriptSig, prevTx.Vout[vin.Vout].ScriptPubKey, checker)
 
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
+	return err == nil
+}
 
-		dataToVerify := fmt.Sprintf("%x\n", txCopy)
+// txInputChecker evaluates scripts in the context of one transaction input
+type txInputChecker struct {
+	tx        *Transaction
+	inID      int
+	sigCache  *SigCache
+	cacheSigs bool
+}
 
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if ecdsa.Verify(&rawPubKey, []byte(dataToVerify), &r, &s) == false {
-			return false
-		}
-		txCopy.Vin[inID].PubKey = nil
+func (c txInputChecker) CheckSig(sig, pubKey, scriptCode []byte) bool {
+	if len(pubKey) == 0 {
+		return false
+	}
+	hashType, r, s, err := parseSignature(sig)
+	if err != nil {
+		return false
+	}
+	hash, err := c.tx.SignatureHash(c.inID, scriptCode, hashType)
+	if err != nil {
+		return false
+	}
+
+	if c.sigCache != nil && c.sigCache.Exists(hash, sig, pubKey) {
+		return true
+	}
+	if !verifyHashSignature(hash, r, s, pubKey) {
+		return false
+	}
+	if c.sigCache != nil && c.cacheSigs {
+		c.sigCache.Add(hash, sig, pubKey)
 	}
 
 	return true
 }
 
+func (c txInputChecker) CheckLockTime(lockTime int64) bool {
+	// both lock times have to count the same unit
+	if (lockTime < lockTimeThreshold) != (c.tx.LockTime < lockTimeThreshold) {
+		return false
+	}
+	if lockTime > c.tx.LockTime {
+		return false
+	}
+
+	// a final input would disable the transaction lock time
+	return c.tx.Vin[c.inID].Sequence != maxSequence
+}
+
+func (c txInputChecker) CheckSequence(sequence int64) bool {
+	if sequence&sequenceLockDisableFlag != 0 {
+		return true
+	}
+	txSequence := int64(c.tx.Vin[c.inID].Sequence)
+	if c.tx.Version < 2 || txSequence&sequenceLockDisableFlag != 0 {
+		return false
+	}
+	if sequence&sequenceLockTypeFlag != txSequence&sequenceLockTypeFlag {
+		return false
+	}
+
+	return sequence&sequenceLockMask <= txSequence&sequenceLockMask
+}
+
 // NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) *Transaction {
+func NewCoinbaseTX(to, data string) (*Transaction, error) {
 	if data == "" {
 		randData := make([]byte, 20)
 		_, err := rand.Read(randData)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
+	txin := TXInput{[]byte{}, -1, []byte(data), maxSequence}
 	txout := NewTXOutput(subsidy, to)
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
+	tx := Transaction{nil, txVersion, []TXInput{txin}, []TXOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 
-	return &tx
+	return &tx, nil
 }
 
-// NewUTXOTransaction creates a new transaction
-func NewUTXOTransaction(wallet *Wallet, to string, amount int, UTXOSet *UTXOSet) *Transaction {
-	var inputs []TXInput
-	var outputs []TXOutput
-
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	acc, validOutputs := UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
+// NewUTXOTransaction creates a new transaction. A non-zero lockTime locks the
+// payment so that to can't spend it before that block height or unix time.
+func NewUTXOTransaction(wallet *Wallet, to string, amount int, lockTime int64, UTXOSet *UTXOSet) (*Transaction, error) {
+	from := fmt.Sprintf("%s", wallet.GetAddress())
+	plan, err := UTXOSet.PlanPayments(from, []Payment{{to, amount, lockTime}}, DefaultCoinSelector)
+	if err != nil {
+		return nil, err
+	}
 
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+	tx, err := plan.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	if err := UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey); err != nil {
+		return nil, err
 	}
 
-	// Build a list of inputs
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
-		}
+	return tx, nil
+}
 
-		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
-			inputs = append(inputs, input)
-		}
+// NewMultisigTransaction creates a new transaction spending from a P2SH multisig
+// address, signed with the keys the wallets hold for its redeem script
+func NewMultisigTransaction(wallets *Wallets, from, to string, amount int, lockTime int64, UTXOSet *UTXOSet) (*Transaction, error) {
+	plan, err := UTXOSet.PlanPayments(from, []Payment{{to, amount, lockTime}}, DefaultCoinSelector)
+	if err != nil {
+		return nil, err
 	}
 
-	// Build a list of outputs
-	from := fmt.Sprintf("%s", wallet.GetAddress())
-	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from)) // a change
+	return NewPlannedTransaction(wallets, plan, UTXOSet)
+}
+
+// NewPlannedTransaction signs the transaction of a plan with the keys the
+// wallets hold for its sender, a pubkey hash or a multisig address
+func NewPlannedTransaction(wallets *Wallets, plan *TxPlan, UTXOSet *UTXOSet) (*Transaction, error) {
+	tx, err := plan.Transaction()
+	if err != nil {
+		return nil, err
 	}
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.ID = tx.Hash()
-	UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
+	if IsScriptAddress(plan.From) {
+		redeemScript := wallets.GetRedeemScript(plan.From)
+		if redeemScript == nil {
+			return nil, fmt.Errorf("redeem script of %s is not in the wallet file", plan.From)
+		}
+		err = UTXOSet.Blockchain.SignMultisigTransaction(tx, wallets.GetKeysForScript(redeemScript), redeemScript)
+	} else {
+		wallet, ok := wallets.Wallets[plan.From]
+		if !ok {
+			return nil, fmt.Errorf("sender address %s has no private key in the wallet file", plan.From)
+		}
+		err = UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return &tx
+	return tx, nil
 }
 
 // DeserializeTransaction deserializes a transaction
-func DeserializeTransaction(data []byte) Transaction {
+func DeserializeTransaction(data []byte) (Transaction, error) {
 	var transaction Transaction
 
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 	err := decoder.Decode(&transaction)
-	if err != nil {
-		log.Panic(err)
-	}
 
-	return transaction
+	return transaction, err
 }
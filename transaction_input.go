@@ -6,13 +6,18 @@ import "bytes"
 type TXInput struct {
 	Txid      []byte
 	Vout      int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
+	Sequence  uint32
 }
 
 // UsesKey checks whether the address initiated the transaction
 func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := HashPubKey(in.PubKey)
+	ops, err := parseScript(in.ScriptSig)
+	if err != nil || len(ops) == 0 {
+		return false
+	}
+	// the last push is the public key for P2PKH and the redeem script for P2SH
+	lockingHash := HashPubKey(ops[len(ops)-1].data)
 
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
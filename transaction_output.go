@@ -3,25 +3,46 @@ package crickchain
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"log"
 )
 
 // TXOutput represents a transaction output
 type TXOutput struct {
-	Value      int
-	PubKeyHash []byte
+	Value        int
+	ScriptPubKey []byte
 }
 
-// Lock signs the output
+// Lock locks the output to a pubkey hash or script hash address
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	out.PubKeyHash = pubKeyHash
+	payload := Base58Decode(address)
+	hash := payload[1 : len(payload)-addressChecksumLen]
+	if payload[0] == scriptVersion {
+		out.ScriptPubKey = NewP2SHScript(hash)
+	} else {
+		out.ScriptPubKey = NewP2PKHScript(hash)
+	}
 }
 
 // IsLockedWithKey checks if the output can be used by the owner of the pubkey
-func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+// or redeem script hashing to lockHash
+func (out *TXOutput) IsLockedWithKey(lockHash []byte) bool {
+	hash := ScriptLockHash(out.ScriptPubKey)
+
+	return hash != nil && bytes.Compare(hash, lockHash) == 0
+}
+
+// outputAddress returns the address an output pays, or "" for a non standard script
+func outputAddress(out TXOutput) string {
+	hash := ScriptLockHash(out.ScriptPubKey)
+	if hash == nil {
+		return ""
+	}
+	if isP2SHScript(out.ScriptPubKey) {
+		return string(encodeAddress(scriptVersion, hash))
+	}
+
+	return string(encodeAddress(version, hash))
 }
 
 // NewTXOutput create a new TXOutput
@@ -32,6 +53,21 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
+// NewTimelockedTXOutput creates a new TXOutput to a pubkey hash address that
+// can't be spent before lockTime, a block height or a unix timestamp
+func NewTimelockedTXOutput(value int, address string, lockTime int64) (*TXOutput, error) {
+	if err := checkAddress(address); err != nil {
+		return nil, err
+	}
+	payload := Base58Decode([]byte(address))
+	if payload[0] != version {
+		return nil, fmt.Errorf("timelocked payment to %s needs a pubkey hash recipient", address)
+	}
+	pubKeyHash := payload[1 : len(payload)-addressChecksumLen]
+
+	return &TXOutput{value, NewTimelockedP2PKHScript(lockTime, pubKeyHash)}, nil
+}
+
 // TXOutputs collects TXOutput
 type TXOutputs struct {
 	Outputs []TXOutput
@@ -51,14 +87,11 @@ func (outs TXOutputs) Serialize() []byte {
 }
 
 // DeserializeOutputs deserializes TXOutputs
-func DeserializeOutputs(data []byte) TXOutputs {
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
 	var outputs TXOutputs
 
 	dec := gob.NewDecoder(bytes.NewReader(data))
 	err := dec.Decode(&outputs)
-	if err != nil {
-		log.Panic(err)
-	}
 
-	return outputs
+	return outputs, err
 }
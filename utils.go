@@ -3,6 +3,7 @@ package crickchain
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"log"
 	"math/big"
 	"strconv"
@@ -69,20 +70,28 @@ func bigIntToBigFloat (i *big.Int) *big.Float {
 	return new(big.Float).SetInt(i)
 }
 
-func printGreen(text string) {
-	color.Green(text)
+// printColor prints a line of text to w in color c
+func printColor(w io.Writer, c color.Attribute, text string) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	color.New(c).Fprint(w, text)
+}
+
+func printGreen(w io.Writer, text string) {
+	printColor(w, color.FgGreen, text)
 }
 
-func printRed(text string) {
-	color.Red(text)
+func printRed(w io.Writer, text string) {
+	printColor(w, color.FgRed, text)
 }
 
-func printBlue(text string) {
-	color.Blue(text)
+func printBlue(w io.Writer, text string) {
+	printColor(w, color.FgBlue, text)
 }
 
-func printYellow(text string) {
-	color.Yellow(text)
+func printYellow(w io.Writer, text string) {
+	printColor(w, color.FgYellow, text)
 }
 
 func check(e error) {
@@ -91,19 +100,17 @@ func check(e error) {
     }
 }
 
-func WriteToFile(filename string, text string) {
-	f, _ := os.Create(filename)
-
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+// WriteToFile replaces the content of a file with text
+func WriteToFile(filename string, text string) error {
+	f, err := os.Create(filename)
 	if err != nil {
-	    panic(err)
+		return err
 	}
 
 	defer f.Close()
 
-	if _, err = f.WriteString(text); err != nil {
-	    panic(err)
-	}
+	_, err = f.WriteString(text)
+	return err
 }
 
 func ProblemToString(pg ProblemGraph) string {
@@ -2,7 +2,6 @@ package crickchain
 
 import (
 	"encoding/hex"
-	"log"
 
 	"github.com/boltdb/bolt"
 )
@@ -14,39 +13,47 @@ type UTXOSet struct {
 	Blockchain *Blockchain
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	accumulated := 0
+// FindSpendableCoins returns the unspent outputs locked to lockHash. Timelocked
+// outputs are skipped until they can be spent in the next block.
+func (u UTXOSet) FindSpendableCoins(lockHash []byte) ([]Coin, error) {
+	var coins []Coin
 	db := u.Blockchain.db
+	height, mtp, err := u.Blockchain.nextBlockLockContext()
+	if err != nil {
+		return nil, err
+	}
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			txID := hex.EncodeToString(k)
-			outs := DeserializeOutputs(v)
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
 
 			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+				if !out.IsLockedWithKey(lockHash) {
+					continue
 				}
+				lockTime, _ := ScriptLockTime(out.ScriptPubKey)
+				if !isFinalLockTime(lockTime, height, mtp) {
+					continue
+				}
+				txID := append([]byte{}, k...)
+				coins = append(coins, Coin{txID, outIdx, out.Value, lockTime})
 			}
 		}
 
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
 
-	return accumulated, unspentOutputs
+	return coins, err
 }
 
 // FindUTXO finds UTXO for a public key hash
-func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]TXOutput, error) {
 	var UTXOs []TXOutput
 	db := u.Blockchain.db
 
@@ -55,7 +62,10 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			outs := DeserializeOutputs(v)
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
 
 			for _, out := range outs.Outputs {
 				if out.IsLockedWithKey(pubKeyHash) {
@@ -66,15 +76,34 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
 
-	return UTXOs
+	return UTXOs, err
+}
+
+// forEachOutput calls fn for every unspent output
+func (u UTXOSet) forEachOutput(fn func(out TXOutput)) error {
+	db := u.Blockchain.db
+
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			for _, out := range outs.Outputs {
+				fn(out)
+			}
+		}
+
+		return nil
+	})
 }
 
 // CountTransactions returns the number of transactions in the UTXO set
-func (u UTXOSet) CountTransactions() int {
+func (u UTXOSet) CountTransactions() (int, error) {
 	db := u.Blockchain.db
 	counter := 0
 
@@ -88,49 +117,42 @@ func (u UTXOSet) CountTransactions() int {
 
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
 
-	return counter
+	return counter, err
 }
 
 // Reindex rebuilds the UTXO set
-func (u UTXOSet) Reindex() {
+func (u UTXOSet) Reindex() error {
 	db := u.Blockchain.db
 	bucketName := []byte(utxoBucket)
 
 	err := db.Update(func(tx *bolt.Tx) error {
 		err := tx.DeleteBucket(bucketName)
 		if err != nil && err != bolt.ErrBucketNotFound {
-			log.Panic(err)
+			return err
 		}
 
 		_, err = tx.CreateBucket(bucketName)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		return nil
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
 	UTXO := u.Blockchain.FindUTXO()
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketName)
 
 		for txID, outs := range UTXO {
 			key, err := hex.DecodeString(txID)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 
 			err = b.Put(key, outs.Serialize())
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
 
@@ -140,10 +162,10 @@ func (u UTXOSet) Reindex() {
 
 // Update updates the UTXO set with transactions from the Block
 // The Block is considered to be the tip of a blockchain
-func (u UTXOSet) Update(block *Block) {
+func (u UTXOSet) Update(block *Block) error {
 	db := u.Blockchain.db
 
-	err := db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 
 		for _, tx := range block.Transactions {
@@ -151,7 +173,10 @@ func (u UTXOSet) Update(block *Block) {
 				for _, vin := range tx.Vin {
 					updatedOuts := TXOutputs{}
 					outsBytes := b.Get(vin.Txid)
-					outs := DeserializeOutputs(outsBytes)
+					outs, err := DeserializeOutputs(outsBytes)
+					if err != nil {
+						return err
+					}
 
 					for outIdx, out := range outs.Outputs {
 						if outIdx != vin.Vout {
@@ -162,12 +187,12 @@ func (u UTXOSet) Update(block *Block) {
 					if len(updatedOuts.Outputs) == 0 {
 						err := b.Delete(vin.Txid)
 						if err != nil {
-							log.Panic(err)
+							return err
 						}
 					} else {
 						err := b.Put(vin.Txid, updatedOuts.Serialize())
 						if err != nil {
-							log.Panic(err)
+							return err
 						}
 					}
 
@@ -181,13 +206,10 @@ func (u UTXOSet) Update(block *Block) {
 
 			err := b.Put(tx.ID, newOutputs.Serialize())
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
 
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
 }
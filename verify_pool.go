@@ -0,0 +1,62 @@
+package crickchain
+
+import (
+	"runtime"
+	"sync"
+)
+
+// inputJob is a single transaction input whose scripts have to run
+type inputJob struct {
+	txIndex int
+	inID    int
+}
+
+// verifyInputsParallel runs the scripts of every input of txs on a pool of
+// workers and reports, for each transaction, whether all its inputs are valid.
+// Coinbase transactions are always valid.
+func verifyInputsParallel(txs []*Transaction, prevTXs map[string]Transaction, cache *SigCache, cacheSigs bool) []bool {
+	valid := make([]bool, len(txs))
+	var jobs []inputJob
+
+	for i, tx := range txs {
+		valid[i] = true
+		if tx.IsCoinbase() {
+			continue
+		}
+		for inID := range tx.Vin {
+			jobs = append(jobs, inputJob{i, inID})
+		}
+	}
+	if len(jobs) == 0 {
+		return valid
+	}
+
+	workers := runtime.NumCPU()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	jobsCh := make(chan inputJob)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobsCh {
+				if !txs[job.txIndex].verifyInput(job.inID, prevTXs, cache, cacheSigs) {
+					mu.Lock()
+					valid[job.txIndex] = false
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		jobsCh <- job
+	}
+	close(jobsCh)
+	wg.Wait()
+
+	return valid
+}
@@ -6,12 +6,12 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"log"
 
 	"golang.org/x/crypto/ripemd160"
 )
 
 const version = byte(0x00)
+const scriptVersion = byte(0x05)
 const addressChecksumLen = 4
 
 // Wallet stores private and public keys
@@ -21,18 +21,30 @@ type Wallet struct {
 }
 
 // NewWallet creates and returns a Wallet
-func NewWallet() *Wallet {
-	private, public := newKeyPair()
+func NewWallet() (*Wallet, error) {
+	private, public, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
 	wallet := Wallet{private, public}
 
-	return &wallet
+	return &wallet, nil
 }
 
 // GetAddress returns wallet address
 func (w Wallet) GetAddress() []byte {
 	pubKeyHash := HashPubKey(w.PublicKey)
 
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+	return encodeAddress(version, pubKeyHash)
+}
+
+// ScriptAddress returns the pay-to-script-hash address of a redeem script
+func ScriptAddress(redeemScript []byte) []byte {
+	return encodeAddress(scriptVersion, HashScript(redeemScript))
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedPayload := append([]byte{version}, hash...)
 	checksum := checksum(versionedPayload)
 
 	fullPayload := append(versionedPayload, checksum...)
@@ -45,11 +57,9 @@ func (w Wallet) GetAddress() []byte {
 func HashPubKey(pubKey []byte) []byte {
 	publicSHA256 := sha256.Sum256(pubKey)
 
+	// writing to a hash never fails
 	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
-	if err != nil {
-		log.Panic(err)
-	}
+	RIPEMD160Hasher.Write(publicSHA256[:])
 	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
 
 	return publicRIPEMD160
@@ -57,7 +67,13 @@ func HashPubKey(pubKey []byte) []byte {
 
 // ValidateAddress check if address if valid
 func ValidateAddress(address string) bool {
+	if !isBase58(address) {
+		return false
+	}
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= addressChecksumLen {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
 	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
@@ -66,6 +82,13 @@ func ValidateAddress(address string) bool {
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
 
+// IsScriptAddress checks whether a valid address is a pay-to-script-hash address
+func IsScriptAddress(address string) bool {
+	payload := Base58Decode([]byte(address))
+
+	return payload[0] == scriptVersion
+}
+
 // Checksum generates a checksum for a public key
 func checksum(payload []byte) []byte {
 	firstSHA := sha256.Sum256(payload)
@@ -74,13 +97,21 @@ func checksum(payload []byte) []byte {
 	return secondSHA[:addressChecksumLen]
 }
 
-func newKeyPair() (ecdsa.PrivateKey, []byte) {
+func newKeyPair() (ecdsa.PrivateKey, []byte, error) {
 	curve := elliptic.P256()
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
-		log.Panic(err)
+		return ecdsa.PrivateKey{}, nil, err
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
 
-	return *private, pubKey
+	return *private, encodePubKey(private.PublicKey), nil
+}
+
+// encodePubKey returns the fixed size X || Y encoding of a public key
+func encodePubKey(pubKey ecdsa.PublicKey) []byte {
+	pub := make([]byte, 64)
+	pubKey.X.FillBytes(pub[:32])
+	pubKey.Y.FillBytes(pub[32:])
+
+	return pub
 }
@@ -0,0 +1,336 @@
+package crickchain
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted wallet files start with walletMagic followed by the scrypt
+// parameters, the salt and the AES-GCM nonce. The header is authenticated
+// together with the gob encoded wallets.
+var walletMagic = []byte("CRICKWALLET1")
+
+const (
+	walletSaltLen  = 16
+	walletKeyLen   = 32
+	walletScryptN  = 1 << 15
+	walletScryptR  = 8
+	walletScryptP  = 1
+	walletFileMode = 0600
+	// Bounds of the scrypt parameters read from wallet files, well above the
+	// ones written, so that a crafted file can't exhaust memory or CPU on
+	// unlock. scrypt takes 128*N*r bytes.
+	walletMaxScryptN      = 1 << 20
+	walletMaxScryptR      = 32
+	walletMaxScryptP      = 16
+	walletMaxScryptMemory = 256 << 20
+)
+
+var (
+	// ErrWalletLocked is returned when an encrypted wallet is used before being unlocked
+	ErrWalletLocked = errors.New("wallet is locked")
+	// ErrWrongPassphrase is returned when a passphrase does not decrypt the wallet
+	ErrWrongPassphrase = errors.New("wrong wallet passphrase")
+	// ErrWalletEncrypted is returned when encrypting an already encrypted wallet
+	ErrWalletEncrypted = errors.New("wallet is already encrypted")
+	// ErrWalletNotEncrypted is returned when unlocking a plaintext wallet
+	ErrWalletNotEncrypted = errors.New("wallet is not encrypted")
+)
+
+// walletKey is the passphrase derived key of an encrypted wallet file
+type walletKey struct {
+	key     []byte
+	salt    []byte
+	n, r, p uint32
+}
+
+type unlockedWallet struct {
+	key   *walletKey
+	timer *time.Timer
+}
+
+// unlockedWallets holds the keys of unlocked wallet files until they time out
+var unlockedWallets = struct {
+	sync.Mutex
+	files map[string]*unlockedWallet
+}{files: make(map[string]*unlockedWallet)}
+
+func newWalletKey(passphrase string) (*walletKey, error) {
+	salt := make([]byte, walletSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return deriveWalletKey(passphrase, salt, walletScryptN, walletScryptR, walletScryptP)
+}
+
+func deriveWalletKey(passphrase string, salt []byte, n, r, p uint32) (*walletKey, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, int(n), int(r), int(p), walletKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletKey{key, salt, n, r, p}, nil
+}
+
+func (k *walletKey) wipe() {
+	for i := range k.key {
+		k.key[i] = 0
+	}
+}
+
+func (k *walletKey) header() []byte {
+	var buff bytes.Buffer
+
+	buff.Write(walletMagic)
+	binary.Write(&buff, binary.BigEndian, [3]uint32{k.n, k.r, k.p})
+	buff.Write(k.salt)
+
+	return buff.Bytes()
+}
+
+func (k *walletKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the gob encoded wallets under a fresh nonce
+func (k *walletKey) seal(plaintext []byte) ([]byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append(k.header(), nonce...)
+
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// open decrypts an encrypted wallet file written with this key
+func (k *walletKey) open(data []byte) ([]byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := k.header()
+	if len(data) < len(header)+aead.NonceSize() || !bytes.Equal(data[:len(header)], header) {
+		return nil, ErrWrongPassphrase
+	}
+	headerLen := len(header) + aead.NonceSize()
+	nonce := data[len(header):headerLen]
+
+	plaintext, err := aead.Open(nil, nonce, data[headerLen:], data[:headerLen])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+// keyFromPassphrase derives the key of an encrypted wallet file from its header
+func keyFromPassphrase(data []byte, passphrase string) (*walletKey, error) {
+	paramsLen := len(walletMagic) + 12
+	if !isEncryptedWallet(data) || len(data) < paramsLen+walletSaltLen {
+		return nil, errors.New("wallet file header is malformed")
+	}
+	var params [3]uint32
+	binary.Read(bytes.NewReader(data[len(walletMagic):paramsLen]), binary.BigEndian, &params)
+	n, r, p := params[0], params[1], params[2]
+	if n < 2 || n&(n-1) != 0 || n > walletMaxScryptN || r == 0 || r > walletMaxScryptR || p == 0 || p > walletMaxScryptP ||
+		128*uint64(n)*uint64(r) > walletMaxScryptMemory {
+		return nil, fmt.Errorf("wallet file header has unsupported scrypt parameters N=%d r=%d p=%d", n, r, p)
+	}
+	salt := append([]byte{}, data[paramsLen:paramsLen+walletSaltLen]...)
+
+	return deriveWalletKey(passphrase, salt, n, r, p)
+}
+
+func isEncryptedWallet(data []byte) bool {
+	return bytes.HasPrefix(data, walletMagic)
+}
+
+// IsWalletEncrypted checks whether a wallet file is encrypted with a passphrase
+func IsWalletEncrypted(walletFile string) bool {
+	data, err := ioutil.ReadFile(walletFile)
+
+	return err == nil && isEncryptedWallet(data)
+}
+
+// EncryptWallet encrypts a plaintext wallet file with a passphrase and leaves it
+// locked. A missing wallet file is created empty, a corrupt one is refused.
+func EncryptWallet(walletFile, passphrase string) error {
+	data, err := ioutil.ReadFile(walletFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if isEncryptedWallet(data) {
+		return ErrWalletEncrypted
+	}
+	wallets, err := NewWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		data, err = wallets.encode()
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := newWalletKey(passphrase)
+	if err != nil {
+		return err
+	}
+	defer key.wipe()
+	encrypted, err := key.seal(data)
+	if err != nil {
+		return err
+	}
+
+	return writeWalletFile(walletFile, encrypted)
+}
+
+// UnlockWallet keeps the key of an encrypted wallet file in memory for timeout
+func UnlockWallet(walletFile, passphrase string, timeout time.Duration) error {
+	data, err := ioutil.ReadFile(walletFile)
+	if err != nil {
+		return err
+	}
+	if !isEncryptedWallet(data) {
+		return ErrWalletNotEncrypted
+	}
+	key, err := keyFromPassphrase(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := key.open(data); err != nil {
+		key.wipe()
+		return err
+	}
+
+	LockWallet(walletFile)
+
+	unlockedWallets.Lock()
+	defer unlockedWallets.Unlock()
+	unlocked := &unlockedWallet{key: key}
+	unlocked.timer = time.AfterFunc(timeout, func() {
+		unlockedWallets.Lock()
+		defer unlockedWallets.Unlock()
+		if unlockedWallets.files[walletFile] == unlocked {
+			delete(unlockedWallets.files, walletFile)
+			key.wipe()
+		}
+	})
+	unlockedWallets.files[walletFile] = unlocked
+
+	return nil
+}
+
+// LockWallet forgets the key of an unlocked wallet file
+func LockWallet(walletFile string) {
+	unlockedWallets.Lock()
+	defer unlockedWallets.Unlock()
+
+	if unlocked, ok := unlockedWallets.files[walletFile]; ok {
+		unlocked.timer.Stop()
+		unlocked.key.wipe()
+		delete(unlockedWallets.files, walletFile)
+	}
+}
+
+// ChangeWalletPassphrase re-encrypts a wallet file under a new passphrase and locks it
+func ChangeWalletPassphrase(walletFile, oldPassphrase, newPassphrase string) error {
+	data, err := ioutil.ReadFile(walletFile)
+	if err != nil {
+		return err
+	}
+	if !isEncryptedWallet(data) {
+		return ErrWalletNotEncrypted
+	}
+	oldKey, err := keyFromPassphrase(data, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer oldKey.wipe()
+	plaintext, err := oldKey.open(data)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := newWalletKey(newPassphrase)
+	if err != nil {
+		return err
+	}
+	defer newKey.wipe()
+	encrypted, err := newKey.seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	LockWallet(walletFile)
+
+	return writeWalletFile(walletFile, encrypted)
+}
+
+// unlockedWalletKey returns a copy of the key of an unlocked wallet file, or nil.
+// The caller wipes it after use.
+func unlockedWalletKey(walletFile string) *walletKey {
+	unlockedWallets.Lock()
+	defer unlockedWallets.Unlock()
+
+	unlocked, ok := unlockedWallets.files[walletFile]
+	if !ok {
+		return nil
+	}
+	key := *unlocked.key
+	key.key = append([]byte{}, unlocked.key.key...)
+
+	return &key
+}
+
+// writeWalletFile replaces a wallet file atomically, readable by its owner only
+func writeWalletFile(walletFile string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(walletFile), filepath.Base(walletFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(walletFileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), walletFile)
+}
@@ -0,0 +1,322 @@
+package crickchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Categories of wallet transactions
+const (
+	TxCategoryGenerate = "generate"
+	TxCategoryReceive  = "receive"
+	TxCategorySend     = "send"
+	TxCategorySelf     = "self"
+)
+
+// WalletTx is a transaction of the active chain that changes the wallet balance
+type WalletTx struct {
+	TxID          []byte
+	BlockHash     []byte
+	Height        int
+	Timestamp     int64
+	Confirmations int
+	Category      string
+	// Amount is the change of the wallet balance, negative for payments
+	Amount int
+	// Addresses are the receiving wallet addresses, or the recipients of a payment
+	Addresses []string
+	Label     string
+}
+
+// HistoryFilter selects and pages wallet transactions. Zero values don't filter.
+type HistoryFilter struct {
+	Address          string
+	Category         string
+	MinConfirmations int
+	Skip             int
+	Count            int
+}
+
+// RecordedHistory is the history of a wallet recorded in its file, up to a
+// block of the chain. SyncHistory brings it up to date by connecting the
+// blocks after it and disconnecting the ones a reorganisation removed, so
+// that the chain is scanned in full only the first time and when the
+// addresses of the wallet change.
+type RecordedHistory struct {
+	// Tip is the block the history is up to date with
+	Tip []byte
+	// Owned are the pubkey and script hashes of the addresses it was
+	// recorded for
+	Owned map[string]bool
+	// Entries are the wallet transactions, oldest first, without their
+	// confirmations and labels, which are found when read
+	Entries []WalletTx
+	// Outputs are the values of the outputs paying the wallet, by
+	// transaction ID and index, to value spends
+	Outputs map[string]map[int]int
+}
+
+// History returns the wallet transactions matching filter, newest first,
+// after bringing the recorded history up to date with the active chain:
+// transactions of blocks removed by a reorganisation disappear and
+// confirmations follow the current tip. Save the wallets to keep the update.
+func (ws *Wallets) History(bc *Blockchain, filter HistoryFilter) ([]WalletTx, error) {
+	if err := ws.SyncHistory(bc); err != nil {
+		return nil, err
+	}
+	tip, err := bc.GetBlockFromHash(bc.tip)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []WalletTx
+	entries := ws.TxHistory.Entries
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		entry.Confirmations = tip.Height - entry.Height + 1
+		entry.Label = ws.txLabel(entry)
+		if filter.matches(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	if filter.Skip >= len(matching) {
+		return nil, nil
+	}
+	matching = matching[filter.Skip:]
+	if filter.Count > 0 && filter.Count < len(matching) {
+		matching = matching[:filter.Count]
+	}
+
+	return matching, nil
+}
+
+// SyncHistory brings the recorded history up to date with the active chain
+func (ws *Wallets) SyncHistory(bc *Blockchain) error {
+	owned := make(map[string]bool)
+	for _, address := range ws.GetAddresses() {
+		owned[string(addressHash(address))] = true
+	}
+	recorded := ws.TxHistory
+	if recorded == nil || !sameKeys(recorded.Owned, owned) {
+		recorded = &RecordedHistory{Owned: owned, Outputs: make(map[string]map[int]int)}
+	}
+
+	// the blocks to connect, newest first, down to the last block the
+	// recorded history and the active chain have in common
+	var connect [][]byte
+	forkHeight := -1
+	block, err := bc.GetBlockFromHash(bc.tip)
+	if err != nil {
+		return err
+	}
+	if recorded.Tip != nil {
+		old, err := bc.GetBlockFromHash(recorded.Tip)
+		if err != nil {
+			// the history was recorded on another chain
+			recorded = &RecordedHistory{Owned: owned, Outputs: make(map[string]map[int]int)}
+		} else {
+			for !bytes.Equal(old.Hash, block.Hash) {
+				if old.Height >= block.Height {
+					if old, err = bc.GetBlockFromHash(old.PrevBlockHash); err != nil {
+						return err
+					}
+					continue
+				}
+				connect = append(connect, block.Hash)
+				if block, err = bc.GetBlockFromHash(block.PrevBlockHash); err != nil {
+					return err
+				}
+			}
+			forkHeight = block.Height
+		}
+	}
+	if forkHeight < 0 {
+		for {
+			connect = append(connect, block.Hash)
+			if len(block.PrevBlockHash) == 0 {
+				break
+			}
+			if block, err = bc.GetBlockFromHash(block.PrevBlockHash); err != nil {
+				return err
+			}
+		}
+	}
+
+	recorded.disconnect(forkHeight)
+	for i := len(connect) - 1; i >= 0; i-- {
+		block, err := bc.GetBlockFromHash(connect[i])
+		if err != nil {
+			return err
+		}
+		recorded.connect(&block)
+	}
+	recorded.Tip = append([]byte{}, bc.tip...)
+	ws.TxHistory = recorded
+
+	return nil
+}
+
+// connect records the wallet transactions of a block added to the chain
+func (h *RecordedHistory) connect(block *Block) {
+	for _, tx := range block.Transactions {
+		entry, ok := walletTx(tx, h.Owned, h.Outputs)
+		if !ok {
+			continue
+		}
+		entry.BlockHash = block.Hash
+		entry.Height = block.Height
+		entry.Timestamp = block.Timestamp / int64(time.Second)
+		h.Entries = append(h.Entries, entry)
+	}
+}
+
+// disconnect forgets the wallet transactions of the blocks above height,
+// removed from the active chain
+func (h *RecordedHistory) disconnect(height int) {
+	keep := len(h.Entries)
+	for keep > 0 && h.Entries[keep-1].Height > height {
+		keep--
+		delete(h.Outputs, hex.EncodeToString(h.Entries[keep].TxID))
+	}
+	h.Entries = h.Entries[:keep]
+}
+
+// txLabel returns the label of a wallet transaction, or the one of its
+// first labelled address
+func (ws *Wallets) txLabel(entry WalletTx) string {
+	if label := ws.TxLabels[hex.EncodeToString(entry.TxID)]; label != "" {
+		return label
+	}
+	for _, address := range entry.Addresses {
+		if label := ws.Labels[address]; label != "" {
+			return label
+		}
+	}
+
+	return ""
+}
+
+func sameKeys(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if !b[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// walletTx sums what tx takes from and pays to the wallet, and records the
+// outputs it pays to the wallet in ownedOutputs
+func walletTx(tx *Transaction, owned map[string]bool, ownedOutputs map[string]map[int]int) (WalletTx, bool) {
+	sent, received := 0, 0
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			if outs, ok := ownedOutputs[hex.EncodeToString(vin.Txid)]; ok {
+				sent += outs[vin.Vout]
+			}
+		}
+	}
+
+	var receivers, recipients []string
+	txID := hex.EncodeToString(tx.ID)
+	for outIdx, out := range tx.Vout {
+		address := outputAddress(out)
+		if owned[string(ScriptLockHash(out.ScriptPubKey))] {
+			received += out.Value
+			receivers = appendUnique(receivers, address)
+			if ownedOutputs[txID] == nil {
+				ownedOutputs[txID] = make(map[int]int)
+			}
+			ownedOutputs[txID][outIdx] = out.Value
+		} else if address != "" {
+			recipients = appendUnique(recipients, address)
+		}
+	}
+	if sent == 0 && received == 0 {
+		return WalletTx{}, false
+	}
+
+	entry := WalletTx{TxID: tx.ID, Amount: received - sent}
+	switch {
+	case tx.IsCoinbase():
+		entry.Category, entry.Addresses = TxCategoryGenerate, receivers
+	case sent == 0:
+		entry.Category, entry.Addresses = TxCategoryReceive, receivers
+	case len(recipients) == 0:
+		entry.Category, entry.Addresses = TxCategorySelf, receivers
+	default:
+		entry.Category, entry.Addresses = TxCategorySend, recipients
+	}
+
+	return entry, true
+}
+
+func (filter HistoryFilter) matches(entry WalletTx) bool {
+	if filter.Category != "" && entry.Category != filter.Category {
+		return false
+	}
+	if entry.Confirmations < filter.MinConfirmations {
+		return false
+	}
+	if filter.Address == "" {
+		return true
+	}
+	for _, address := range entry.Addresses {
+		if address == filter.Address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetLabel names an address, or removes its name if label is empty
+func (ws *Wallets) SetLabel(address, label string) error {
+	if err := checkAddress(address); err != nil {
+		return err
+	}
+	if label == "" {
+		delete(ws.Labels, address)
+	} else {
+		ws.Labels[address] = label
+	}
+
+	return nil
+}
+
+// SetTxLabel names a transaction, or removes its name if label is empty
+func (ws *Wallets) SetTxLabel(txID, label string) error {
+	if _, err := hex.DecodeString(txID); err != nil || txID == "" {
+		return fmt.Errorf("transaction ID %s is not valid", txID)
+	}
+	if label == "" {
+		delete(ws.TxLabels, txID)
+	} else {
+		ws.TxLabels[txID] = label
+	}
+
+	return nil
+}
+
+// addressHash returns the pubkey or script hash an address encodes
+func addressHash(address string) []byte {
+	payload := Base58Decode([]byte(address))
+
+	return payload[1 : len(payload)-addressChecksumLen]
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
@@ -0,0 +1,97 @@
+package crickchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Private keys are exported like WIF keys: the Base58Check encoding of
+// privateKeyVersion followed by the 32 byte big-endian P-256 scalar and a
+// 4 byte checksum, the start of the double SHA-256 of the rest.
+const privateKeyVersion = byte(0x80)
+const privateKeyLen = 32
+
+// EncodePrivateKey returns the text encoding of a private key
+func EncodePrivateKey(privKey ecdsa.PrivateKey) string {
+	payload := append([]byte{privateKeyVersion}, privKey.D.FillBytes(make([]byte, privateKeyLen))...)
+	payload = append(payload, checksum(payload)...)
+
+	return string(Base58Encode(payload))
+}
+
+// DecodePrivateKey parses a private key produced by EncodePrivateKey
+func DecodePrivateKey(encoded string) (*Wallet, error) {
+	if !isBase58(encoded) {
+		return nil, errors.New("private key is not Base58 encoded")
+	}
+	payload := Base58Decode([]byte(encoded))
+	if len(payload) != 1+privateKeyLen+addressChecksumLen || payload[0] != privateKeyVersion {
+		return nil, errors.New("not a private key")
+	}
+	body := payload[:1+privateKeyLen]
+	if !bytes.Equal(checksum(body), payload[1+privateKeyLen:]) {
+		return nil, errors.New("private key checksum mismatch")
+	}
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(body[1:])
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+	private := ecdsa.PrivateKey{D: d}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(body[1:])
+
+	return &Wallet{private, encodePubKey(private.PublicKey)}, nil
+}
+
+// ExportKey returns the encoded private key of a wallet address
+func (ws Wallets) ExportKey(address string) (string, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return "", fmt.Errorf("no private key for address %s", address)
+	}
+
+	return EncodePrivateKey(wallet.PrivateKey), nil
+}
+
+// ImportKey adds an encoded private key and returns its address. A watch-only
+// address becomes spendable.
+func (ws *Wallets) ImportKey(encoded string) (string, error) {
+	wallet, err := DecodePrivateKey(encoded)
+	if err != nil {
+		return "", err
+	}
+	address := string(wallet.GetAddress())
+
+	ws.Wallets[address] = wallet
+	delete(ws.WatchOnly, address)
+
+	return address, nil
+}
+
+// AddWatchOnly tracks an address whose private key the wallet does not hold
+func (ws *Wallets) AddWatchOnly(address string) error {
+	if err := checkAddress(address); err != nil {
+		return err
+	}
+	if _, ok := ws.Wallets[address]; ok {
+		return errors.New("address is already in the wallet")
+	}
+	if _, ok := ws.Scripts[address]; ok {
+		return errors.New("address is already in the wallet")
+	}
+
+	ws.WatchOnly[address] = true
+
+	return nil
+}
+
+// IsWatchOnly checks whether an address is tracked without its private key
+func (ws Wallets) IsWatchOnly(address string) bool {
+	return ws.WatchOnly[address]
+}
@@ -2,39 +2,75 @@ package crickchain
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 )
 
 const walletFile = "wallet_%s.dat"
 
-// Wallets stores a collection of wallets
+// Wallets stores a collection of wallets, the redeem scripts of multisig
+// addresses, the seed of HD addresses, watch-only addresses, the labels of
+// addresses and transactions and the transaction history
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets   map[string]*Wallet
+	Scripts   map[string][]byte
+	HD        *HDWallet
+	WatchOnly map[string]bool
+	Labels    map[string]string
+	TxLabels  map[string]string
+	// TxHistory is the recorded transaction history, see History
+	TxHistory *RecordedHistory
 }
 
-// NewWallets creates Wallets and fills it from a file if it exists
+// NewWallets creates Wallets and fills it from a file if it exists. A missing
+// wallet file is not an error, the wallets are empty then.
 func NewWallets(walletFile string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Scripts = make(map[string][]byte)
+	wallets.WatchOnly = make(map[string]bool)
+	wallets.Labels = make(map[string]string)
+	wallets.TxLabels = make(map[string]string)
 
 	err := wallets.LoadFromFile(walletFile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
 
 	return &wallets, err
 }
 
-// CreateWallet adds a Wallet to Wallets
-func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
+// CreateWallet adds a Wallet to Wallets, derived from the HD seed if there is one
+func (ws *Wallets) CreateWallet() (string, error) {
+	if ws.HD != nil {
+		return ws.NewHDAddress(), nil
+	}
+	wallet, err := NewWallet()
+	if err != nil {
+		return "", err
+	}
 	address := fmt.Sprintf("%s", wallet.GetAddress())
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
+}
+
+// AddMultisig stores an m-of-n multisig redeem script and returns its P2SH address
+func (ws *Wallets) AddMultisig(m int, pubKeys [][]byte) (string, error) {
+	redeemScript, err := NewMultisigScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	address := fmt.Sprintf("%s", ScriptAddress(redeemScript))
+
+	ws.Scripts[address] = redeemScript
+
+	return address, nil
 }
 
 // GetAddresses returns an array of addresses stored in the wallet file
@@ -44,24 +80,64 @@ func (ws *Wallets) GetAddresses() []string {
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	for address := range ws.Scripts {
+		addresses = append(addresses, address)
+	}
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
 
 	return addresses
 }
 
+// GetRedeemScript returns the redeem script of a multisig address, or nil if unknown
+func (ws Wallets) GetRedeemScript(address string) []byte {
+	return ws.Scripts[address]
+}
+
+// GetKeysForScript returns the private keys held for the public keys of a multisig redeem script
+func (ws Wallets) GetKeysForScript(redeemScript []byte) []ecdsa.PrivateKey {
+	var keys []ecdsa.PrivateKey
+
+	_, pubKeys, _ := ParseMultisigScript(redeemScript)
+	for _, pubKey := range pubKeys {
+		for _, wallet := range ws.Wallets {
+			if bytes.Equal(wallet.PublicKey, pubKey) {
+				keys = append(keys, wallet.PrivateKey)
+				break
+			}
+		}
+	}
+
+	return keys
+}
+
 // GetWallet returns a Wallet by its address
 func (ws Wallets) GetWallet(address string) Wallet {
 	return *ws.Wallets[address]
 }
 
-// LoadFromFile loads wallets from the file
+// LoadFromFile loads wallets from the file. An encrypted wallet file must be
+// unlocked first, otherwise ErrWalletLocked is returned.
 func (ws *Wallets) LoadFromFile(walletFile string) error {
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
-	fmt.Println("Wallet file ", walletFile)
 	fileContent, err := ioutil.ReadFile(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	if isEncryptedWallet(fileContent) {
+		key := unlockedWalletKey(walletFile)
+		if key == nil {
+			return ErrWalletLocked
+		}
+		defer key.wipe()
+		fileContent, err = key.open(fileContent)
+		if err != nil {
+			return err
+		}
 	}
 
 	var wallets Wallets
@@ -69,28 +145,59 @@ func (ws *Wallets) LoadFromFile(walletFile string) error {
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
-		log.Panic(err)
+		return fmt.Errorf("wallet file %s is corrupt: %w", walletFile, err)
 	}
 
 	ws.Wallets = wallets.Wallets
+	if wallets.Scripts != nil {
+		ws.Scripts = wallets.Scripts
+	}
+	ws.HD = wallets.HD
+	if wallets.WatchOnly != nil {
+		ws.WatchOnly = wallets.WatchOnly
+	}
+	if wallets.Labels != nil {
+		ws.Labels = wallets.Labels
+	}
+	if wallets.TxLabels != nil {
+		ws.TxLabels = wallets.TxLabels
+	}
+	ws.TxHistory = wallets.TxHistory
 
 	return nil
 }
 
-// SaveToFile saves wallets to a file
-func (ws Wallets) SaveToFile(walletFile string) {
+// SaveToFile saves wallets to a file, encrypted if the wallet file is. It
+// fails with ErrWalletLocked if the wallet file is encrypted and locked.
+func (ws Wallets) SaveToFile(walletFile string) error {
+	content, err := ws.encode()
+	if err != nil {
+		return err
+	}
+
+	if key := unlockedWalletKey(walletFile); key != nil {
+		defer key.wipe()
+		encrypted, err := key.seal(content)
+		if err != nil {
+			return err
+		}
+		content = encrypted
+	} else if IsWalletEncrypted(walletFile) {
+		return ErrWalletLocked
+	}
+
+	return writeWalletFile(walletFile, content)
+}
+
+func (ws Wallets) encode() ([]byte, error) {
 	var content bytes.Buffer
 
 	gob.Register(elliptic.P256())
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
-	if err != nil {
-		log.Panic(err)
+	if err := encoder.Encode(ws); err != nil {
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
-	if err != nil {
-		log.Panic(err)
-	}
+	return content.Bytes(), nil
 }